@@ -0,0 +1,99 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/accounts"
+)
+
+// accountFiles are polled for changes by the account collector
+var accountFiles = []string{
+	"/" + accounts.PasswdFile,
+	"/" + accounts.ShadowFile,
+	"/" + accounts.GroupFile,
+	"/" + accounts.SudoersFile,
+	"/" + accounts.SudoersDir,
+}
+
+// collectAccounts reports user, group, password and sudo rule changes,
+// including those made while the agent was not running
+func (sc *SecurityCollector) collectAccounts() {
+	log.Printf("👤 Starting account monitoring...")
+
+	stateFile := filepath.Join(*stateDir, "accounts.json")
+	var previous *accounts.Snapshot
+	if saved := new(accounts.Snapshot); loadState(stateFile, saved) {
+		previous = saved
+	}
+
+	ticker := time.NewTicker(*accountsInterval)
+	defer ticker.Stop()
+
+	var lastState string
+	for {
+		if state := accountFilesState(); state != lastState {
+			if snap, err := accounts.Read("/"); err != nil {
+				log.Printf("Failed to read accounts: %v", err)
+			} else {
+				lastState = state
+				if previous != nil {
+					for _, change := range accounts.Diff(previous, snap) {
+						sc.sendAccountChange(change)
+					}
+				} else {
+					log.Printf("👤 Account baseline: %d users, %d groups, %d sudo rules",
+						len(snap.Users), len(snap.Groups), len(snap.Sudo))
+				}
+				// Only fingerprints of password hashes are stored
+				saveState(stateFile, snap)
+				previous = snap
+			}
+		}
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendAccountChange sends one account change on the accounts stream
+func (sc *SecurityCollector) sendAccountChange(change accounts.Change) {
+	labels := map[string]string{
+		"event_type": change.Type,
+		"severity":   change.Severity,
+	}
+	for k, v := range change.Labels {
+		labels[k] = v
+	}
+
+	log.Printf("👤 %s", change.Message)
+	sc.sendEvent("accounts", change.Message, labels)
+}
+
+// accountFilesState fingerprints the account files' sizes and modification
+// times, including each file in sudoers.d
+func accountFilesState() string {
+	var state string
+	for _, path := range accountFiles {
+		paths := []string{path}
+		if entries, err := os.ReadDir(path); err == nil {
+			for _, entry := range entries {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+		for _, p := range paths {
+			if info, err := os.Stat(p); err == nil {
+				state += fmt.Sprintf("%s:%d:%d;", p, info.Size(), info.ModTime().UnixNano())
+			}
+		}
+	}
+	return state
+}
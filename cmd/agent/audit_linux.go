@@ -0,0 +1,245 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/auditlog"
+)
+
+// auditEventTimeout bounds how long records wait for their EOE record
+const auditEventTimeout = 2 * time.Second
+
+// auditMaxArgv caps the joined command line attached to exec events
+const auditMaxArgv = 4096
+
+// collectAuditLog tails the auditd log and sends one event per serial
+func (sc *SecurityCollector) collectAuditLog() {
+	if _, err := os.Stat(*auditLog); err != nil {
+		log.Printf("ℹ️ Audit log %s not available, audit collection disabled", *auditLog)
+		return
+	}
+	log.Printf("📜 Assembling audit events from %s", *auditLog)
+
+	assembler := auditlog.NewAssembler(auditEventTimeout)
+	users := make(map[string]string)
+	lines := make(chan string, 256)
+	go sc.followFile(*auditLog, lines)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sc.ctx.Done():
+			return
+		case line := <-lines:
+			rec, ok := auditlog.ParseRecord(line)
+			if !ok {
+				continue
+			}
+			for _, ev := range assembler.Add(rec) {
+				sc.sendAuditEvent(ev, users)
+			}
+		case <-ticker.C:
+			for _, ev := range assembler.Flush(false) {
+				sc.sendAuditEvent(ev, users)
+			}
+		}
+	}
+}
+
+// followFile sends new lines of path, reopening it after rotation or truncation
+func (sc *SecurityCollector) followFile(path string, lines chan<- string) {
+	var (
+		file   *os.File
+		reader *bufio.Reader
+		offset int64
+		inode  uint64
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	open := func(atEnd bool) bool {
+		f, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		if file != nil {
+			file.Close()
+		}
+		file, offset, inode = f, 0, 0
+		if st, err := f.Stat(); err == nil {
+			inode = st.Sys().(*syscall.Stat_t).Ino
+			if atEnd {
+				offset, _ = f.Seek(0, io.SeekEnd)
+			}
+		}
+		reader = bufio.NewReader(f)
+		return true
+	}
+
+	if !open(true) {
+		log.Printf("Failed to open %s", path)
+		return
+	}
+
+	var partial string
+	for {
+		if sc.ctx.Err() != nil {
+			return
+		}
+
+		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+		if err == nil {
+			select {
+			case lines <- partial + line:
+			case <-sc.ctx.Done():
+				return
+			}
+			partial = ""
+			continue
+		}
+		partial += line
+
+		// At EOF: check whether the file was rotated or truncated
+		if st, err := os.Stat(path); err == nil {
+			rotated := st.Sys().(*syscall.Stat_t).Ino != inode
+			if rotated || st.Size() < offset {
+				if open(false) {
+					partial = ""
+					continue
+				}
+			}
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// sendAuditEvent converts an assembled audit event into a log event
+func (sc *SecurityCollector) sendAuditEvent(ev *auditlog.Event, users map[string]string) {
+	loginUser := lookupAuditUser(ev, users)
+
+	labels := map[string]string{
+		"event_type":   "audit_" + strings.ToLower(ev.Type),
+		"audit_type":   ev.Type,
+		"audit_serial": strconv.FormatUint(ev.Serial, 10),
+		"audit_time":   ev.Time.UTC().Format(time.RFC3339Nano),
+		"login_user":   loginUser,
+		"source":       "auditd",
+		"severity":     "info",
+	}
+	set := func(key, value string) {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	set("audit_key", ev.Key)
+	set("syscall", ev.Syscall)
+	set("success", ev.Success)
+	set("exit", ev.Exit)
+	set("uid", ev.UID)
+	set("auid", ev.AUID)
+	set("session_id", ev.Session)
+	set("tty", ev.TTY)
+	set("comm", ev.Comm)
+	set("exe", ev.Exe)
+	set("cwd", ev.Cwd)
+	set("proctitle", ev.Proctitle)
+	if ev.PID > 0 {
+		labels["pid"] = strconv.Itoa(ev.PID)
+	}
+	if ev.PPID > 0 {
+		labels["ppid"] = strconv.Itoa(ev.PPID)
+	}
+
+	var paths []string
+	for _, p := range ev.Paths {
+		if p.Name != "" && p.Name != "(null)" {
+			paths = append(paths, p.Name)
+		}
+	}
+	set("paths", strings.Join(paths, ","))
+	if ev.Success == "no" || ev.Success == "failed" {
+		labels["severity"] = "warning"
+	}
+
+	stream := "audit"
+	var message string
+	switch {
+	case ev.IsExec():
+		cmdline := strings.Join(ev.Argv, " ")
+		if cmdline == "" {
+			cmdline = ev.Proctitle
+		}
+		if len(cmdline) > auditMaxArgv {
+			cmdline = cmdline[:auditMaxArgv]
+		}
+		labels["event_type"] = "audit_exec"
+		labels["argv"] = cmdline
+		stream = "process"
+		message = fmt.Sprintf("Process executed: %s (PID: %d, login user: %s)", cmdline, ev.PID, loginUser)
+	case ev.Type == "SYSCALL" && len(paths) > 0:
+		labels["event_type"] = "audit_file_access"
+		stream = "filesystem"
+		message = fmt.Sprintf("File accessed: %s by %s (login user: %s)", strings.Join(paths, ", "), ev.Exe, loginUser)
+	default:
+		set("account", ev.Field("acct"))
+		set("source_ip", strings.TrimPrefix(ev.Field("addr"), "?"))
+		set("operation", ev.Field("op"))
+		message = fmt.Sprintf("Audit %s: %s (login user: %s)", ev.Type, auditSummary(ev), loginUser)
+	}
+
+	sc.sendEvent(stream, message, labels)
+}
+
+// auditSummary describes an event that has no specialised message
+func auditSummary(ev *auditlog.Event) string {
+	var parts []string
+	for _, key := range []string{"op", "acct", "exe", "addr", "res"} {
+		if v := ev.Field(key); v != "" && v != "?" {
+			parts = append(parts, key+"="+v)
+		}
+	}
+	if ev.Key != "" {
+		parts = append(parts, "key="+ev.Key)
+	}
+	if len(parts) == 0 {
+		return ev.Comm
+	}
+	return strings.Join(parts, " ")
+}
+
+// lookupAuditUser maps the event's auid to the login user name
+func lookupAuditUser(ev *auditlog.Event, users map[string]string) string {
+	if ev.AUID == "" || ev.AUID == auditlog.AUIDUnset || ev.AUID == "-1" {
+		return "unset"
+	}
+	// ENRICHED log format already carries the translated name
+	if name := ev.Field("AUID"); name != "" && name != "unset" {
+		return name
+	}
+	if name, ok := users[ev.AUID]; ok {
+		return name
+	}
+	name := ev.AUID
+	if u, err := user.LookupId(ev.AUID); err == nil {
+		name = u.Username
+	}
+	users[ev.AUID] = name
+	return name
+}
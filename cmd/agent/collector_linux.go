@@ -13,8 +13,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/mulutu/security-manager/internal/authlog"
+	"github.com/mulutu/security-manager/internal/metrics"
 	pb "github.com/mulutu/security-manager/internal/proto"
 )
 
@@ -116,20 +119,21 @@ type SecurityCollector struct {
 	host     string
 	ctx      context.Context
 	patterns map[string]*regexp.Regexp
+	lineage  *lineageCache
+	// activeMiners counts running processes reported as cryptominers; while
+	// non-zero the miner event stands in for generic high CPU alerts
+	activeMiners atomic.Int32
 }
 
 // NewSecurityCollector creates a new Linux security collector
 func NewSecurityCollector(ctx context.Context, stream pb.AgentIngest_StreamEventsClient, org, host string) *SecurityCollector {
 	return &SecurityCollector{
-		stream: stream,
-		org:    org,
-		host:   host,
-		ctx:    ctx,
+		stream:  stream,
+		org:     org,
+		host:    host,
+		ctx:     ctx,
+		lineage: newLineageCache(),
 		patterns: map[string]*regexp.Regexp{
-			"ssh_fail":     regexp.MustCompile(`Failed password for .* from (\d+\.\d+\.\d+\.\d+)`),
-			"ssh_success":  regexp.MustCompile(`Accepted password for (\w+) from (\d+\.\d+\.\d+\.\d+)`),
-			"sudo_usage":   regexp.MustCompile(`sudo:\s+(\w+) : TTY=(\w+) ; PWD=([^;]+) ; USER=(\w+) ; COMMAND=(.+)`),
-			"login_fail":   regexp.MustCompile(`authentication failure.*user=(\w+)`),
 			"process_kill": regexp.MustCompile(`Killed process (\d+) \((.+)\)`),
 			"disk_full":    regexp.MustCompile(`No space left on device`),
 			"memory_oom":   regexp.MustCompile(`Out of memory: Kill process (\d+) \((.+)\)`),
@@ -149,68 +153,43 @@ func (sc *SecurityCollector) StartCollection() {
 	go sc.collectNetworkEvents()
 	go sc.collectSystemMetrics()
 	go sc.collectFileSystemEvents()
-}
-
-// collectSystemdJournal monitors systemd journal for security events
-func (sc *SecurityCollector) collectSystemdJournal() {
-	log.Printf("📋 Starting systemd journal monitoring...")
-
-	// Follow journal from now
-	cmd := exec.CommandContext(sc.ctx, "journalctl", "-f", "-o", "json", "--since", "now")
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Printf("Failed to start journalctl: %v", err)
-		return
-	}
-
-	if err := cmd.Start(); err != nil {
-		log.Printf("Failed to start journalctl: %v", err)
-		return
-	}
-
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		select {
-		case <-sc.ctx.Done():
-			return
-		default:
-			var entry map[string]interface{}
-			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
-				continue
-			}
-
-			// Extract relevant fields
-			message := getString(entry, "MESSAGE")
-			unit := getString(entry, "_SYSTEMD_UNIT")
-			priority := getString(entry, "PRIORITY")
-
-			// Calculate severity
-			severity := sc.calculateSeverity(message, unit, priority)
-
-			// Send event
-			sc.sendEvent("systemd", message, map[string]string{
-				"unit":     unit,
-				"priority": priority,
-				"severity": severity,
-				"source":   "journalctl",
-			})
-		}
-	}
+	go sc.collectAuditLog()
+	go sc.collectInventory()
+	go sc.watchNetworkChanges()
+	go sc.collectPackages()
+	go sc.collectAccounts()
+	go sc.collectAuthorizedKeys()
+	go sc.collectPersistence()
+	go sc.collectKernelModules()
+	go sc.collectIntegrityChecks()
+	go sc.collectSuspiciousProcesses()
+	go sc.collectCryptominers()
+	go sc.collectFilesystemAudit()
+	go sc.collectSessions()
 }
 
 // collectAuthLogs monitors authentication events
 func (sc *SecurityCollector) collectAuthLogs() {
-	authPaths := []string{
-		"/var/log/auth.log",
-		"/var/log/secure",
-		"/var/log/messages",
+	// One tail per file, shared by every service parser that reads it
+	parsers := make(map[string][]authlog.Parser)
+	forward := make(map[string]bool)
+	var paths []string
+
+	for _, svc := range authlog.Services() {
+		for _, path := range svc.Resolve() {
+			if _, seen := parsers[path]; !seen {
+				paths = append(paths, path)
+			}
+			parsers[path] = append(parsers[path], svc.New())
+			// Only the system auth log is forwarded line by line
+			if svc.Name == "system" {
+				forward[path] = true
+			}
+		}
 	}
 
-	for _, path := range authPaths {
-		if _, err := os.Stat(path); err == nil {
-			go sc.tailSecurityFile(path, "auth")
-			break
-		}
+	for _, path := range paths {
+		go sc.tailSecurityFile(path, "auth", parsers[path], forward[path])
 	}
 }
 
@@ -234,24 +213,29 @@ func (sc *SecurityCollector) collectProcessEvents() {
 				// Check for new processes
 				for pid, name := range currentProcesses {
 					if _, exists := lastProcesses[pid]; !exists {
-						sc.sendEvent("process", fmt.Sprintf("Process started: %s (PID: %d)", name, pid), map[string]string{
+						labels := map[string]string{
 							"event_type": "process_start",
 							"pid":        strconv.Itoa(pid),
 							"process":    name,
 							"severity":   "info",
-						})
+						}
+						sc.addAncestry(labels, pid)
+						sc.sendEvent("process", fmt.Sprintf("Process started: %s (PID: %d)", name, pid), labels)
 					}
 				}
 
 				// Check for terminated processes
 				for pid, name := range lastProcesses {
 					if _, exists := currentProcesses[pid]; !exists {
-						sc.sendEvent("process", fmt.Sprintf("Process terminated: %s (PID: %d)", name, pid), map[string]string{
+						labels := map[string]string{
 							"event_type": "process_end",
 							"pid":        strconv.Itoa(pid),
 							"process":    name,
 							"severity":   "info",
-						})
+						}
+						// Exited processes are still in the lineage cache
+						sc.addAncestry(labels, pid)
+						sc.sendEvent("process", fmt.Sprintf("Process terminated: %s (PID: %d)", name, pid), labels)
 					}
 				}
 			}
@@ -277,11 +261,17 @@ func (sc *SecurityCollector) collectNetworkEvents() {
 			connections := sc.getNetworkConnections()
 			for _, conn := range connections {
 				if sc.isSuspiciousConnection(conn) {
-					sc.sendEvent("network", fmt.Sprintf("Suspicious connection: %s", conn), map[string]string{
+					labels := map[string]string{
 						"event_type": "suspicious_connection",
 						"connection": conn,
 						"severity":   "warning",
-					})
+					}
+					if m := netstatPID.FindStringSubmatch(conn); m != nil {
+						pid, _ := strconv.Atoi(m[1])
+						labels["pid"] = m[1]
+						sc.addAncestry(labels, pid)
+					}
+					sc.sendEvent("network", fmt.Sprintf("Suspicious connection: %s", conn), labels)
 				}
 			}
 		}
@@ -292,7 +282,12 @@ func (sc *SecurityCollector) collectNetworkEvents() {
 func (sc *SecurityCollector) collectSystemMetrics() {
 	log.Printf("📊 Starting system metrics collection...")
 
-	ticker := time.NewTicker(30 * time.Second)
+	reader := NewMetricsReader()
+	reader.Sample() // baseline for rates
+	thresholds := NewThresholdEvaluator(thresholdRules())
+	forecaster := NewForecaster(forecastConfig())
+
+	ticker := time.NewTicker(*metricsInterval)
 	defer ticker.Stop()
 
 	for {
@@ -300,57 +295,72 @@ func (sc *SecurityCollector) collectSystemMetrics() {
 		case <-sc.ctx.Done():
 			return
 		case <-ticker.C:
-			metrics := sc.getSystemMetrics()
-
-			// Check for critical resource usage
-			if metrics.CPUUsage > 90 {
-				sc.sendEvent("system", fmt.Sprintf("High CPU usage: %.1f%%", metrics.CPUUsage), map[string]string{
-					"event_type": "high_cpu",
-					"cpu_usage":  fmt.Sprintf("%.1f", metrics.CPUUsage),
-					"severity":   "warning",
-				})
-			}
+			sample := reader.Sample()
+			sc.sendMetricsSample(sample)
 
-			if metrics.MemoryUsage > 90 {
-				sc.sendEvent("system", fmt.Sprintf("High memory usage: %.1f%%", metrics.MemoryUsage), map[string]string{
-					"event_type":   "high_memory",
-					"memory_usage": fmt.Sprintf("%.1f", metrics.MemoryUsage),
-					"severity":     "warning",
-				})
+			for _, ev := range thresholds.Evaluate(sample) {
+				if ev.Labels["metric"] == "cpu" && ev.Labels["event_type"] == "metric_threshold" && sc.activeMiners.Load() > 0 {
+					log.Printf("⛏️ Suppressed in favour of the cryptominer event: %s", ev.Message)
+					continue
+				}
+				sc.sendEvent("system", ev.Message, ev.Labels)
 			}
-
-			if metrics.DiskUsage > 85 {
-				sc.sendEvent("system", fmt.Sprintf("High disk usage: %.1f%%", metrics.DiskUsage), map[string]string{
-					"event_type": "high_disk",
-					"disk_usage": fmt.Sprintf("%.1f", metrics.DiskUsage),
-					"severity":   "critical",
-				})
+			for _, ev := range forecaster.Evaluate(sample, readProcessMemory()) {
+				sc.sendEvent("system", ev.Message, ev.Labels)
 			}
 		}
 	}
 }
 
+// sendMetricsSample sends a structured metrics sample with headline labels
+func (sc *SecurityCollector) sendMetricsSample(sample *metrics.Sample) {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		log.Printf("Failed to encode metrics sample: %v", err)
+		return
+	}
+
+	sc.sendEvent(metrics.Stream, string(data), map[string]string{
+		"event_type":   metrics.EventType,
+		"cpu_usage":    fmt.Sprintf("%.1f", sample.CPU.Usage),
+		"memory_usage": fmt.Sprintf("%.1f", sample.Memory.UsagePercent),
+		"disk_usage":   fmt.Sprintf("%.1f", sample.DiskUsage()),
+		"load1":        fmt.Sprintf("%.2f", sample.Load.Load1),
+		"network_in":   fmt.Sprintf("%.0f", sample.NetworkIn()),
+		"network_out":  fmt.Sprintf("%.0f", sample.NetworkOut()),
+		"severity":     "info",
+	})
+}
+
 // collectFileSystemEvents monitors file system changes
 func (sc *SecurityCollector) collectFileSystemEvents() {
 	log.Printf("📁 Starting filesystem monitoring...")
 
-	// Monitor critical directories
-	criticalPaths := []string{
-		"/etc/passwd",
-		"/etc/shadow",
-		"/etc/sudoers",
-		"/etc/ssh/sshd_config",
-		"/var/log",
-		"/tmp",
+	// Monitor critical files and directories
+	criticalPaths := []fimPath{
+		{path: "/etc/passwd", content: true},
+		{path: "/etc/shadow", content: true},
+		{path: "/etc/sudoers", content: true},
+		{path: "/etc/ssh/sshd_config", content: true},
+		{path: "/var/log"},
+		{path: "/tmp", recursive: true},
 	}
 
-	for _, path := range criticalPaths {
-		go sc.monitorFile(path)
+	shadow := NewConfigShadow(*stateDir, splitList(*diffPaths), *diffMaxSize)
+	monitor := NewFileIntegrityMonitor(sc, criticalPaths, *fimRescan, shadow)
+
+	// Allowlisted config files must be watched for their diffs to be reported
+	for _, path := range shadow.allow {
+		if _, covered := monitor.lookup(path); !covered {
+			monitor.paths = append(monitor.paths, fimPath{path: path, recursive: true, content: true})
+		}
 	}
+
+	monitor.Start()
 }
 
 // tailSecurityFile tails a file and analyzes for security events
-func (sc *SecurityCollector) tailSecurityFile(path, stream string) {
+func (sc *SecurityCollector) tailSecurityFile(path, stream string, parsers []authlog.Parser, forwardUnparsed bool) {
 	log.Printf("📄 Tailing security file: %s", path)
 
 	file, err := os.Open(path)
@@ -375,6 +385,18 @@ func (sc *SecurityCollector) tailSecurityFile(path, stream string) {
 				continue
 			}
 
+			// Authentication lines become structured auth events
+			if ev := parseAuthLine(parsers, line); ev != nil {
+				labels := authEventLabels(ev)
+				labels["file"] = path
+				labels["source"] = "file_tail"
+				sc.sendEvent(stream, strings.TrimSpace(line), labels)
+				continue
+			}
+			if !forwardUnparsed {
+				continue
+			}
+
 			// Analyze line for security patterns
 			severity, eventType := sc.analyzeSecurityEvent(line)
 
@@ -411,8 +433,11 @@ func (sc *SecurityCollector) getProcessList() map[int]string {
 	return processes
 }
 
+// netstatPID extracts the owning PID from the "PID/Program name" column
+var netstatPID = regexp.MustCompile(`\s(\d+)/\S*`)
+
 func (sc *SecurityCollector) getNetworkConnections() []string {
-	cmd := exec.Command("netstat", "-tuln")
+	cmd := exec.Command("netstat", "-tulnp")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil
@@ -439,88 +464,6 @@ func (sc *SecurityCollector) isSuspiciousConnection(conn string) bool {
 	return false
 }
 
-type SystemMetrics struct {
-	CPUUsage    float64
-	MemoryUsage float64
-	DiskUsage   float64
-}
-
-func (sc *SecurityCollector) getSystemMetrics() SystemMetrics {
-	metrics := SystemMetrics{}
-
-	// Get CPU usage
-	if output, err := exec.Command("top", "-bn1").Output(); err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "Cpu(s)") {
-				// Parse CPU usage from top output
-				if matches := regexp.MustCompile(`(\d+\.\d+)%us`).FindStringSubmatch(line); len(matches) > 1 {
-					if usage, err := strconv.ParseFloat(matches[1], 64); err == nil {
-						metrics.CPUUsage = usage
-					}
-				}
-				break
-			}
-		}
-	}
-
-	// Get memory usage
-	if output, err := exec.Command("free", "-m").Output(); err == nil {
-		lines := strings.Split(string(output), "\n")
-		if len(lines) > 1 {
-			fields := strings.Fields(lines[1])
-			if len(fields) >= 3 {
-				if total, err := strconv.ParseFloat(fields[1], 64); err == nil {
-					if used, err := strconv.ParseFloat(fields[2], 64); err == nil {
-						metrics.MemoryUsage = (used / total) * 100
-					}
-				}
-			}
-		}
-	}
-
-	// Get disk usage
-	if output, err := exec.Command("df", "-h", "/").Output(); err == nil {
-		lines := strings.Split(string(output), "\n")
-		if len(lines) > 1 {
-			fields := strings.Fields(lines[1])
-			if len(fields) >= 5 {
-				usageStr := strings.TrimSuffix(fields[4], "%")
-				if usage, err := strconv.ParseFloat(usageStr, 64); err == nil {
-					metrics.DiskUsage = usage
-				}
-			}
-		}
-	}
-
-	return metrics
-}
-
-func (sc *SecurityCollector) monitorFile(path string) {
-	var lastStat os.FileInfo
-
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-sc.ctx.Done():
-			return
-		case <-ticker.C:
-			if stat, err := os.Stat(path); err == nil {
-				if lastStat != nil && stat.ModTime() != lastStat.ModTime() {
-					sc.sendEvent("filesystem", fmt.Sprintf("File modified: %s", path), map[string]string{
-						"event_type": "file_modified",
-						"file_path":  path,
-						"severity":   "info",
-					})
-				}
-				lastStat = stat
-			}
-		}
-	}
-}
-
 func (sc *SecurityCollector) analyzeSecurityEvent(line string) (severity, eventType string) {
 	// Default values
 	severity = "info"
@@ -531,16 +474,12 @@ func (sc *SecurityCollector) analyzeSecurityEvent(line string) (severity, eventT
 		if regex.MatchString(line) {
 			eventType = pattern
 			switch pattern {
-			case "ssh_fail", "login_fail":
-				severity = "warning"
 			case "process_kill", "memory_oom":
 				severity = "critical"
 			case "disk_full":
 				severity = "critical"
 			case "network_drop":
 				severity = "warning"
-			case "ssh_success", "sudo_usage":
-				severity = "info"
 			}
 			break
 		}
@@ -549,6 +488,57 @@ func (sc *SecurityCollector) analyzeSecurityEvent(line string) (severity, eventT
 	return severity, eventType
 }
 
+// parseAuthLine returns the first event any parser recognises in line
+func parseAuthLine(parsers []authlog.Parser, line string) *authlog.AuthEvent {
+	now := time.Now()
+	for _, p := range parsers {
+		if ev, ok := p.Parse(line, now); ok {
+			return ev
+		}
+	}
+	return nil
+}
+
+// authEventLabels flattens a parsed authentication event into event labels
+func authEventLabels(ev *authlog.AuthEvent) map[string]string {
+	severity := "info"
+	if ev.Result == authlog.ResultFailure {
+		severity = "warning"
+	}
+
+	labels := map[string]string{
+		"event_type":  ev.Type,
+		"auth_result": ev.Result,
+		"program":     ev.Program,
+		"severity":    severity,
+	}
+	set := func(key, value string) {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	set("user", ev.User)
+	set("target_user", ev.TargetUser)
+	set("source_ip", ev.SourceIP)
+	set("auth_method", ev.Method)
+	set("service", ev.Service)
+	set("session_id", ev.SessionID)
+	set("tty", ev.TTY)
+	set("command", ev.Command)
+	set("key_fingerprint", ev.KeyFP)
+	set("reason", ev.Reason)
+	if ev.SourcePort > 0 {
+		labels["source_port"] = strconv.Itoa(ev.SourcePort)
+	}
+	if ev.PID > 0 {
+		labels["pid"] = strconv.Itoa(ev.PID)
+	}
+	if ev.Invalid {
+		labels["invalid_user"] = "true"
+	}
+	return labels
+}
+
 func (sc *SecurityCollector) calculateSeverity(message, unit, priority string) string {
 	// Convert systemd priority to severity
 	switch priority {
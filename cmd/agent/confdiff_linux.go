@@ -0,0 +1,178 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxDiffLabel caps the diff attached to a single event
+const maxDiffLabel = 16 * 1024
+
+var secretPatterns = []*regexp.Regexp{
+	// key = value and key: value style secrets
+	regexp.MustCompile(`(?i)\b([a-z0-9_.-]*(?:password|passwd|passphrase|secret|token|api[_-]?key|private[_-]?key|credentials?)[a-z0-9_.-]*\s*[=:]\s*)("[^"]*"|'[^']*'|\S+)`),
+	// crypt(3) password hashes
+	regexp.MustCompile(`\$(?:1|2[abxy]?|5|6|y|gy|7)\$[^\s:]+`),
+	// PEM private key bodies
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+}
+
+// ConfigShadow keeps compressed copies of small text configuration files so
+// changes can be reported as unified diffs
+type ConfigShadow struct {
+	dir     string
+	maxSize int64
+	allow   []string
+}
+
+// NewConfigShadow creates a shadow store under stateDir for the allowlisted paths
+func NewConfigShadow(stateDir string, allow []string, maxSize int64) *ConfigShadow {
+	dir := filepath.Join(stateDir, "shadow")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("Failed to create shadow directory %s: %v", dir, err)
+	}
+	return &ConfigShadow{dir: dir, maxSize: maxSize, allow: allow}
+}
+
+// Allowed reports whether diffs are collected for path
+func (cs *ConfigShadow) Allowed(path string) bool {
+	for _, a := range cs.allow {
+		if path == a || strings.HasPrefix(path, strings.TrimSuffix(a, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Prime stores a shadow copy of every allowlisted file that has none yet and
+// returns diffs for files that changed while the agent wasn't running
+func (cs *ConfigShadow) Prime() map[string]string {
+	changed := make(map[string]string)
+	for _, a := range cs.allow {
+		filepath.Walk(a, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			if _, err := os.Stat(cs.shadowPath(path)); err != nil {
+				cs.Update(path)
+				return nil
+			}
+			if diff := cs.Diff(path); diff != "" {
+				changed[path] = diff
+			}
+			return nil
+		})
+	}
+	return changed
+}
+
+// Diff compares path against its shadow copy, refreshes the shadow and
+// returns a redacted unified diff ("" when nothing can be shown)
+func (cs *ConfigShadow) Diff(path string) string {
+	current, ok := cs.readText(path)
+	previous, _ := cs.load(path)
+	if ok {
+		cs.store(path, current)
+	} else {
+		os.Remove(cs.shadowPath(path))
+	}
+
+	if !ok && previous == "" {
+		return ""
+	}
+
+	diff, err := unifiedDiff(path, previous, current, 3)
+	if err != nil {
+		return err.Error()
+	}
+	if len(diff) > maxDiffLabel {
+		diff = diff[:maxDiffLabel] + "\n... diff truncated\n"
+	}
+	return diff
+}
+
+// Update refreshes the shadow copy of path without computing a diff
+func (cs *ConfigShadow) Update(path string) {
+	if current, ok := cs.readText(path); ok {
+		cs.store(path, current)
+	}
+}
+
+// readText returns the redacted file content if it is a small text file;
+// shadows are stored redacted so secrets never land in the state directory
+func (cs *ConfigShadow) readText(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > cs.maxSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(data, 0) >= 0 {
+		return "", false
+	}
+	return redactSecrets(string(data)), true
+}
+
+func (cs *ConfigShadow) shadowPath(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(cs.dir, hex.EncodeToString(sum[:])+".gz")
+}
+
+func (cs *ConfigShadow) load(path string) (string, error) {
+	f, err := os.Open(cs.shadowPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(io.LimitReader(zr, cs.maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (cs *ConfigShadow) store(path, content string) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = path
+	zw.Write([]byte(content))
+	if err := zw.Close(); err != nil {
+		return
+	}
+
+	tmp := cs.shadowPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		log.Printf("Failed to write shadow copy of %s: %v", path, err)
+		return
+	}
+	if err := os.Rename(tmp, cs.shadowPath(path)); err != nil {
+		log.Printf("Failed to write shadow copy of %s: %v", path, err)
+	}
+}
+
+// redactSecrets masks values that look like credentials
+func redactSecrets(text string) string {
+	text = secretPatterns[0].ReplaceAllString(text, "${1}[REDACTED]")
+	text = secretPatterns[1].ReplaceAllString(text, "[REDACTED]")
+	if secretPatterns[2].MatchString(text) {
+		return fmt.Sprintf("[REDACTED: private key material, %d bytes]\n", len(text))
+	}
+	return text
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// serverConfigPrefix prefixes the Authenticate response headers that carry
+// server-managed collector configuration, one JSON document per section
+const serverConfigPrefix = "sm-config-"
+
+// serverConfig holds the configuration sections sent by the ingest server
+var serverConfig metadata.MD
+
+// serverSection decodes a server-provided config section into v, reporting
+// whether the server sent one
+func serverSection(name string, v any) bool {
+	values := serverConfig.Get(serverConfigPrefix + name)
+	if len(values) == 0 {
+		return false
+	}
+	if err := json.Unmarshal([]byte(values[0]), v); err != nil {
+		log.Printf("⚠️ Ignoring invalid server config section %q: %v", name, err)
+		return false
+	}
+	return true
+}
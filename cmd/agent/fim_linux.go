@@ -0,0 +1,616 @@
+//go:build linux
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fimPath describes a path watched by the file integrity monitor
+type fimPath struct {
+	path      string
+	recursive bool // descend into subdirectories
+	content   bool // hash files and report content changes
+}
+
+// fileState is the baseline recorded for a watched path
+type fileState struct {
+	size    int64
+	mode    os.FileMode
+	uid     uint32
+	gid     uint32
+	modTime time.Time
+	hash    string
+}
+
+const (
+	// fimMaxEntries caps the baseline so huge trees can't exhaust memory
+	fimMaxEntries = 20000
+
+	inotifyEntryMask   = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+	inotifyContentMask = unix.IN_CLOSE_WRITE
+)
+
+// FileIntegrityMonitor watches critical paths with inotify (and fanotify when
+// running as root) and falls back to periodic rescans for anything missed
+type FileIntegrityMonitor struct {
+	sc        *SecurityCollector
+	paths     []fimPath
+	shadow    *ConfigShadow // optional, attaches content diffs
+	rescan    time.Duration
+	mu        sync.Mutex
+	baseline  map[string]fileState
+	watches   map[int]string // inotify watch descriptor -> directory
+	inotifyFd int
+	fanotify  map[string]bool // directories whose children fanotify covers
+	degraded  bool            // watch limit reached, relying on rescans
+	rescanNow chan struct{}
+}
+
+// NewFileIntegrityMonitor creates a monitor for the given paths
+func NewFileIntegrityMonitor(sc *SecurityCollector, paths []fimPath, rescan time.Duration, shadow *ConfigShadow) *FileIntegrityMonitor {
+	if rescan <= 0 {
+		rescan = 5 * time.Minute
+	}
+	return &FileIntegrityMonitor{
+		sc:        sc,
+		paths:     paths,
+		shadow:    shadow,
+		rescan:    rescan,
+		baseline:  make(map[string]fileState),
+		watches:   make(map[int]string),
+		inotifyFd: -1,
+		fanotify:  make(map[string]bool),
+		rescanNow: make(chan struct{}, 1),
+	}
+}
+
+// Start builds the baseline, installs watches and runs the rescan loop
+func (fm *FileIntegrityMonitor) Start() {
+	var complete bool
+	fm.baseline, complete = fm.scan()
+	log.Printf("📁 FIM baseline: %d entries across %d paths", len(fm.baseline), len(fm.paths))
+	if !complete {
+		log.Printf("⚠️  FIM baseline capped at %d entries, deletions outside it go unreported", fimMaxEntries)
+	}
+
+	if fm.shadow != nil {
+		// Changes made while the agent was down
+		for path, diff := range fm.shadow.Prime() {
+			fm.mu.Lock()
+			state := fm.baseline[path]
+			fm.mu.Unlock()
+			fm.report("file_modified", path, fileState{}, state, "startup", map[string]string{"diff": diff})
+		}
+	}
+
+	if os.Geteuid() == 0 {
+		if err := fm.startFanotify(); err != nil {
+			log.Printf("fanotify unavailable, using inotify only: %v", err)
+		}
+	}
+	if err := fm.startInotify(); err != nil {
+		log.Printf("inotify unavailable, relying on rescans every %v: %v", fm.rescan, err)
+	}
+
+	ticker := time.NewTicker(fm.rescan)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fm.sc.ctx.Done():
+			return
+		case <-ticker.C:
+			fm.rescanAll()
+		case <-fm.rescanNow:
+			fm.rescanAll()
+		}
+	}
+}
+
+// requestRescan schedules an immediate rescan without blocking
+func (fm *FileIntegrityMonitor) requestRescan() {
+	select {
+	case fm.rescanNow <- struct{}{}:
+	default:
+	}
+}
+
+// lookup returns the watch configuration covering path
+func (fm *FileIntegrityMonitor) lookup(path string) (fimPath, bool) {
+	for _, p := range fm.paths {
+		if path == p.path {
+			return p, true
+		}
+		rel, err := filepath.Rel(p.path, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if p.recursive || !strings.Contains(rel, string(filepath.Separator)) {
+			return p, true
+		}
+	}
+	return fimPath{}, false
+}
+
+// scan walks all watched paths and returns their current state, and false
+// when fimMaxEntries cut the walk short
+func (fm *FileIntegrityMonitor) scan() (map[string]fileState, bool) {
+	states := make(map[string]fileState)
+	complete := true
+
+	for _, p := range fm.paths {
+		info, err := os.Lstat(p.path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			states[p.path] = statFile(p.path, info, p.content)
+			continue
+		}
+
+		filepath.WalkDir(p.path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if len(states) >= fimMaxEntries {
+				complete = false
+				return filepath.SkipAll
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			states[path] = statFile(path, info, p.content && info.Mode().IsRegular())
+			if d.IsDir() && path != p.path && !p.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+
+	return states, complete
+}
+
+// rescanAll compares a fresh scan against the baseline. A capped scan covers
+// a different slice of the tree whenever entries come and go, so it only
+// reports changes to entries present in both.
+func (fm *FileIntegrityMonitor) rescanAll() {
+	current, complete := fm.scan()
+
+	fm.mu.Lock()
+	previous := fm.baseline
+	fm.baseline = current
+	fm.mu.Unlock()
+
+	for path, state := range current {
+		old, existed := previous[path]
+		switch {
+		case !existed:
+			if complete {
+				fm.report("file_created", path, fileState{}, state, "rescan", nil)
+			}
+		case old.hash != state.hash:
+			fm.report("file_modified", path, old, state, "rescan", nil)
+		case old.mode != state.mode || old.uid != state.uid || old.gid != state.gid:
+			fm.report("file_attributes_changed", path, old, state, "rescan", nil)
+		}
+	}
+	if !complete {
+		return
+	}
+	for path, old := range previous {
+		if _, exists := current[path]; !exists {
+			fm.report("file_deleted", path, old, fileState{}, "rescan", nil)
+		}
+	}
+}
+
+// check re-stats a single path after a notification and reports any change
+func (fm *FileIntegrityMonitor) check(path, source string, created bool, attribution map[string]string) {
+	cfg, ok := fm.lookup(path)
+	if !ok {
+		return
+	}
+
+	info, err := os.Lstat(path)
+
+	fm.mu.Lock()
+	old, existed := fm.baseline[path]
+	if err != nil {
+		delete(fm.baseline, path)
+		fm.mu.Unlock()
+		switch {
+		case existed:
+			fm.report("file_deleted", path, old, fileState{}, source, attribution)
+		case created:
+			// Created and removed before we could look at it
+			labels := map[string]string{"transient": "true"}
+			for k, v := range attribution {
+				labels[k] = v
+			}
+			fm.report("file_created", path, fileState{}, fileState{}, source, labels)
+		}
+		return
+	}
+	state := statFile(path, info, cfg.content && info.Mode().IsRegular())
+	if existed || len(fm.baseline) < fimMaxEntries {
+		fm.baseline[path] = state
+	}
+	fm.mu.Unlock()
+
+	switch {
+	case !existed:
+		fm.report("file_created", path, fileState{}, state, source, attribution)
+	case old.hash != state.hash:
+		fm.report("file_modified", path, old, state, source, attribution)
+	case old.mode != state.mode || old.uid != state.uid || old.gid != state.gid:
+		fm.report("file_attributes_changed", path, old, state, source, attribution)
+	}
+}
+
+// report sends a filesystem event for a detected change
+func (fm *FileIntegrityMonitor) report(eventType, path string, old, cur fileState, source string, extra map[string]string) {
+	var message string
+	switch eventType {
+	case "file_created":
+		message = fmt.Sprintf("File created: %s", path)
+		if extra["transient"] == "true" {
+			message = fmt.Sprintf("Transient file created and removed: %s", path)
+		}
+	case "file_deleted":
+		message = fmt.Sprintf("File deleted: %s", path)
+	case "file_attributes_changed":
+		message = fmt.Sprintf("File permissions changed: %s", path)
+	default:
+		message = fmt.Sprintf("File modified: %s", path)
+	}
+
+	labels := map[string]string{
+		"event_type":  eventType,
+		"file_path":   path,
+		"severity":    "info",
+		"detected_by": source,
+	}
+	if cur.hash != "" {
+		labels["sha256"] = cur.hash
+	}
+	if old.hash != "" && old.hash != cur.hash {
+		labels["previous_sha256"] = old.hash
+	}
+	if eventType != "file_deleted" && cur.mode != 0 {
+		labels["mode"] = cur.mode.String()
+		labels["uid"] = strconv.FormatUint(uint64(cur.uid), 10)
+		labels["gid"] = strconv.FormatUint(uint64(cur.gid), 10)
+	}
+	if fm.shadow != nil && eventType != "file_attributes_changed" && extra["diff"] == "" && fm.shadow.Allowed(path) {
+		if diff := fm.shadow.Diff(path); diff != "" {
+			labels["diff"] = diff
+		}
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+
+	fm.sc.sendEvent("filesystem", message, labels)
+}
+
+// statFile builds a fileState, hashing regular files when requested
+func statFile(path string, info os.FileInfo, hash bool) fileState {
+	state := fileState{
+		size:    info.Size(),
+		mode:    info.Mode(),
+		modTime: info.ModTime(),
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		state.uid = st.Uid
+		state.gid = st.Gid
+	}
+	if hash && info.Mode().IsRegular() {
+		state.hash = hashFile(path)
+	}
+	return state
+}
+
+// hashFile returns the hex SHA-256 of a file, or "" if it can't be read
+func hashFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ─── inotify ──────────────────────────────────────────────────────────────
+
+// startInotify installs watches on every watched directory
+func (fm *FileIntegrityMonitor) startInotify() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify_init1: %w", err)
+	}
+	fm.inotifyFd = fd
+
+	for _, p := range fm.paths {
+		info, err := os.Stat(p.path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			// Watch the parent so editors that replace the file are still seen
+			fm.addWatch(filepath.Dir(p.path))
+			continue
+		}
+		if p.recursive {
+			fm.addWatchTree(p.path)
+		} else {
+			fm.addWatch(p.path)
+		}
+	}
+
+	log.Printf("📁 inotify watching %d directories", len(fm.watches))
+	go fm.readInotify()
+	return nil
+}
+
+// addWatch adds a single inotify watch for dir. Content writes are left to
+// fanotify only where it marked dir itself, since its marks don't recurse.
+func (fm *FileIntegrityMonitor) addWatch(dir string) {
+	mask := uint32(inotifyEntryMask)
+	if !fm.fanotify[dir] {
+		mask |= inotifyContentMask
+	}
+
+	wd, err := unix.InotifyAddWatch(fm.inotifyFd, dir, mask)
+	if err != nil {
+		if err == unix.ENOSPC && !fm.degraded {
+			fm.degraded = true
+			log.Printf("⚠️  inotify watch limit reached at %s, relying on rescans (raise fs.inotify.max_user_watches)", dir)
+			fm.sc.sendEvent("filesystem", "File integrity watch limit reached", map[string]string{
+				"event_type": "fim_degraded",
+				"file_path":  dir,
+				"severity":   "warning",
+			})
+		}
+		return
+	}
+
+	fm.mu.Lock()
+	fm.watches[wd] = dir
+	fm.mu.Unlock()
+}
+
+// addWatchTree watches dir and every directory below it
+func (fm *FileIntegrityMonitor) addWatchTree(dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if fm.degraded {
+			return filepath.SkipAll
+		}
+		fm.addWatch(path)
+		return nil
+	})
+}
+
+// readInotify decodes inotify events until the context ends
+func (fm *FileIntegrityMonitor) readInotify() {
+	defer unix.Close(fm.inotifyFd)
+
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(fm.inotifyFd), Events: unix.POLLIN}}
+
+	for fm.sc.ctx.Err() == nil {
+		n, err := unix.Poll(fds, 1000)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			log.Printf("inotify poll: %v", err)
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		n, err = unix.Read(fm.inotifyFd, buf)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			log.Printf("inotify read: %v", err)
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			start := offset + unix.SizeofInotifyEvent
+			if start+nameLen > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:start+nameLen]), "\x00")
+			offset = start + nameLen
+
+			fm.handleInotify(int(wd), mask, name)
+		}
+	}
+}
+
+// handleInotify processes a single inotify event
+func (fm *FileIntegrityMonitor) handleInotify(wd int, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		log.Printf("⚠️  inotify queue overflow, scheduling rescan")
+		fm.requestRescan()
+		return
+	}
+
+	fm.mu.Lock()
+	dir, ok := fm.watches[wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(fm.watches, wd)
+	}
+	fm.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+
+	created := mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0
+	if created && mask&unix.IN_ISDIR != 0 {
+		if cfg, ok := fm.lookup(path); ok && cfg.recursive {
+			fm.addWatchTree(path)
+			// Entries created before the watch existed
+			filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && p != path {
+					fm.check(p, "inotify", true, nil)
+				}
+				return nil
+			})
+		}
+	}
+
+	fm.check(path, "inotify", created, nil)
+}
+
+// ─── fanotify ─────────────────────────────────────────────────────────────
+
+// startFanotify marks content paths for close-write notifications, which
+// carry the PID of the writing process
+func (fm *FileIntegrityMonitor) startFanotify() error {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK, unix.O_RDONLY|unix.O_LARGEFILE|unix.O_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("fanotify_init: %w", err)
+	}
+
+	marked := 0
+	for _, p := range fm.paths {
+		if !p.content {
+			continue
+		}
+		info, err := os.Stat(p.path)
+		if err != nil {
+			continue
+		}
+		dir := p.path
+		if !info.IsDir() {
+			dir = filepath.Dir(p.path)
+		}
+		if err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD, unix.FAN_CLOSE_WRITE|unix.FAN_EVENT_ON_CHILD, unix.AT_FDCWD, dir); err != nil {
+			log.Printf("fanotify mark %s: %v", dir, err)
+			continue
+		}
+		fm.fanotify[dir] = true
+		marked++
+	}
+
+	if marked == 0 {
+		unix.Close(fd)
+		return fmt.Errorf("no paths could be marked")
+	}
+
+	log.Printf("📁 fanotify watching %d paths with writer attribution", marked)
+	go fm.readFanotify(fd)
+	return nil
+}
+
+// readFanotify decodes fanotify events until the context ends
+func (fm *FileIntegrityMonitor) readFanotify(fd int) {
+	defer unix.Close(fd)
+
+	const metadataLen = 24 // sizeof(struct fanotify_event_metadata)
+	buf := make([]byte, 4096)
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	self := os.Getpid()
+
+	for fm.sc.ctx.Err() == nil {
+		n, err := unix.Poll(fds, 1000)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			log.Printf("fanotify poll: %v", err)
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		n, err = unix.Read(fd, buf)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			log.Printf("fanotify read: %v", err)
+			return
+		}
+
+		for offset := 0; offset+metadataLen <= n; {
+			eventLen := int(binary.NativeEndian.Uint32(buf[offset:]))
+			vers := buf[offset+4]
+			mask := binary.NativeEndian.Uint64(buf[offset+8:])
+			eventFd := int(int32(binary.NativeEndian.Uint32(buf[offset+16:])))
+			pid := int(int32(binary.NativeEndian.Uint32(buf[offset+20:])))
+			if eventLen < metadataLen || vers != unix.FANOTIFY_METADATA_VERSION {
+				break
+			}
+			offset += eventLen
+
+			if mask&unix.FAN_Q_OVERFLOW != 0 {
+				log.Printf("⚠️  fanotify queue overflow, scheduling rescan")
+				fm.requestRescan()
+				continue
+			}
+			if eventFd < 0 {
+				continue
+			}
+
+			path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", eventFd))
+			unix.Close(eventFd)
+			if err != nil || pid == self {
+				continue
+			}
+
+			fm.check(path, "fanotify", false, processAttribution(pid))
+		}
+	}
+}
+
+// processAttribution describes the process responsible for a change
+func processAttribution(pid int) map[string]string {
+	attr := map[string]string{"pid": strconv.Itoa(pid)}
+	if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+		attr["process"] = strings.TrimSpace(string(comm))
+	}
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		attr["exe"] = exe
+	}
+	return attr
+}
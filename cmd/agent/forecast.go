@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/metrics"
+)
+
+const (
+	// forecastMinPoints is the fewest samples a trend is fitted on
+	forecastMinPoints = 6
+	// forecastMinFit rejects noisy trends (coefficient of determination)
+	forecastMinFit = 0.6
+	// forecastResolveFactor is how far past the horizon a forecast must move
+	// before a predictive alert resolves
+	forecastResolveFactor = 1.5
+	// processMinRSS skips processes too small to exhaust memory
+	processMinRSS = 64 << 20
+)
+
+// ForecastConfig controls capacity forecasting; the server may override it
+// with the "forecast" config section
+type ForecastConfig struct {
+	Horizon jsonDuration `json:"horizon"`
+	Window  jsonDuration `json:"window"`
+}
+
+// forecastConfig returns the server-provided forecast config or the flags
+func forecastConfig() ForecastConfig {
+	cfg := ForecastConfig{Horizon: jsonDuration(*forecastHorizon), Window: jsonDuration(*forecastWindow)}
+	if serverSection("forecast", &cfg) {
+		log.Printf("📈 Using server-provided forecast horizon %v", time.Duration(cfg.Horizon))
+	}
+	return cfg
+}
+
+// ProcessMemory is the resident memory of one process
+type ProcessMemory struct {
+	PID       int
+	Name      string
+	StartTime uint64
+	RSS       uint64
+}
+
+// trendPoint is one observation of a growing quantity
+type trendPoint struct {
+	t time.Time
+	v float64
+}
+
+// trend is a sliding window of observations fitted by least squares
+type trend struct {
+	points   []trendPoint
+	alerting bool
+}
+
+// add appends an observation and drops those older than window
+func (tr *trend) add(t time.Time, v float64, window time.Duration) {
+	tr.points = append(tr.points, trendPoint{t, v})
+	cutoff := t.Add(-window)
+	drop := 0
+	for drop < len(tr.points) && tr.points[drop].t.Before(cutoff) {
+		drop++
+	}
+	tr.points = tr.points[drop:]
+}
+
+// slope returns the growth per second and the fit quality of the trend
+func (tr *trend) slope() (perSecond, r2 float64, ok bool) {
+	n := float64(len(tr.points))
+	if len(tr.points) < forecastMinPoints {
+		return 0, 0, false
+	}
+
+	origin := tr.points[0].t
+	var sx, sy, sxx, sxy, syy float64
+	for _, p := range tr.points {
+		x := p.t.Sub(origin).Seconds()
+		sx += x
+		sy += p.v
+		sxx += x * x
+		sxy += x * p.v
+		syy += p.v * p.v
+	}
+
+	varX := n*sxx - sx*sx
+	varY := n*syy - sy*sy
+	if varX <= 0 {
+		return 0, 0, false
+	}
+	perSecond = (n*sxy - sx*sy) / varX
+	if varY <= 0 {
+		return perSecond, 0, true
+	}
+	cov := n*sxy - sx*sy
+	return perSecond, cov * cov / (varX * varY), true
+}
+
+// span returns the time covered by the trend
+func (tr *trend) span() time.Duration {
+	if len(tr.points) < 2 {
+		return 0
+	}
+	return tr.points[len(tr.points)-1].t.Sub(tr.points[0].t)
+}
+
+// Forecaster projects when disks, inodes and memory run out
+type Forecaster struct {
+	cfg    ForecastConfig
+	trends map[string]*trend
+}
+
+// NewForecaster creates a forecaster
+func NewForecaster(cfg ForecastConfig) *Forecaster {
+	return &Forecaster{cfg: cfg, trends: make(map[string]*trend)}
+}
+
+// forecastInput is one quantity to project against its capacity
+type forecastInput struct {
+	key       string
+	metric    string
+	target    string
+	used      float64
+	remaining float64
+}
+
+// Evaluate adds a sample (and the current process memory) and returns
+// predictive alerts and resolutions
+func (f *Forecaster) Evaluate(s *metrics.Sample, processes []ProcessMemory) []MetricEvent {
+	var inputs []forecastInput
+	for _, fs := range s.Filesystems {
+		inputs = append(inputs, forecastInput{
+			key: "disk|" + fs.Mount, metric: "disk", target: fs.Mount,
+			used: float64(fs.UsedBytes), remaining: float64(fs.AvailableBytes),
+		})
+		if fs.Inodes > 0 {
+			inputs = append(inputs, forecastInput{
+				key: "inodes|" + fs.Mount, metric: "inodes", target: fs.Mount,
+				used: float64(fs.Inodes - fs.InodesFree), remaining: float64(fs.InodesFree),
+			})
+		}
+	}
+	if s.Memory.TotalBytes > 0 {
+		inputs = append(inputs, forecastInput{
+			key: "memory", metric: "memory",
+			used: float64(s.Memory.UsedBytes), remaining: float64(s.Memory.AvailableBytes),
+		})
+	}
+
+	// A leaking process exhausts whatever memory is still available
+	for _, p := range processes {
+		if p.RSS < processMinRSS {
+			continue
+		}
+		inputs = append(inputs, forecastInput{
+			key:       fmt.Sprintf("process|%d|%d", p.PID, p.StartTime),
+			metric:    "process_memory",
+			target:    fmt.Sprintf("%s (PID %d)", p.Name, p.PID),
+			used:      float64(p.RSS),
+			remaining: float64(s.Memory.AvailableBytes),
+		})
+	}
+
+	var events []MetricEvent
+	seen := make(map[string]bool)
+	for _, in := range inputs {
+		seen[in.key] = true
+		if ev := f.observe(in, s.Time); ev != nil {
+			events = append(events, *ev)
+		}
+	}
+
+	// Forget unmounted filesystems and exited processes
+	for key := range f.trends {
+		if !seen[key] {
+			delete(f.trends, key)
+		}
+	}
+	return events
+}
+
+// observe updates one trend and reports a change in its forecast state
+func (f *Forecaster) observe(in forecastInput, now time.Time) *MetricEvent {
+	tr := f.trends[in.key]
+	if tr == nil {
+		tr = &trend{}
+		f.trends[in.key] = tr
+	}
+	window := time.Duration(f.cfg.Window)
+	horizon := time.Duration(f.cfg.Horizon)
+	tr.add(now, in.used, window)
+
+	perSecond, r2, ok := tr.slope()
+	if !ok || tr.span() < window/4 {
+		return nil
+	}
+
+	var ttf time.Duration
+	growing := perSecond > 0 && r2 >= forecastMinFit
+	if growing {
+		ttf = time.Duration(in.remaining / perSecond * float64(time.Second))
+	}
+
+	switch {
+	case !tr.alerting && growing && ttf <= horizon:
+		tr.alerting = true
+		return forecastEvent(in, perSecond, ttf, now, false)
+	case tr.alerting && (!growing || ttf > time.Duration(float64(horizon)*forecastResolveFactor)):
+		tr.alerting = false
+		return forecastEvent(in, perSecond, ttf, now, true)
+	}
+	return nil
+}
+
+// forecastEvent describes a predictive alert or its resolution
+func forecastEvent(in forecastInput, perSecond float64, ttf time.Duration, now time.Time, resolved bool) *MetricEvent {
+	subject := map[string]string{
+		"disk":           "Disk space",
+		"inodes":         "Inodes",
+		"memory":         "Memory",
+		"process_memory": "Memory",
+	}[in.metric]
+	if in.metric == "disk" || in.metric == "inodes" {
+		subject += " on " + in.target
+	}
+
+	labels := map[string]string{
+		"event_type":      "capacity_forecast",
+		"metric":          in.metric,
+		"growth_per_hour": fmt.Sprintf("%.0f", perSecond*3600),
+		"used":            fmt.Sprintf("%.0f", in.used),
+		"remaining":       fmt.Sprintf("%.0f", in.remaining),
+		"severity":        "warning",
+	}
+	if in.target != "" {
+		labels["target"] = in.target
+	}
+
+	if resolved {
+		labels["event_type"] = "capacity_forecast_resolved"
+		labels["severity"] = "info"
+		return &MetricEvent{
+			Message: fmt.Sprintf("Resolved: %s no longer forecast to run out", subject),
+			Labels:  labels,
+		}
+	}
+
+	ttf = ttf.Round(time.Minute)
+	labels["time_to_full_seconds"] = fmt.Sprintf("%.0f", ttf.Seconds())
+	labels["forecast_full_at"] = now.Add(ttf).UTC().Format(time.RFC3339)
+
+	message := fmt.Sprintf("%s forecast to run out in %v", subject, ttf)
+	if in.metric == "process_memory" {
+		message = fmt.Sprintf("Memory forecast to run out in %v: %s growing %.0f MiB/h", ttf, in.target, perSecond*3600/(1<<20))
+	}
+	return &MetricEvent{Message: message, Labels: labels}
+}
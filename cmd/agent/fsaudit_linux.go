@@ -0,0 +1,378 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fsAuditMaxWritable caps the world-writable entries of an audit so a
+// directory tree full of them can't exhaust memory or flood the server.
+// SUID/SGID files are never capped: only root can create them.
+const fsAuditMaxWritable = 50000
+
+// skippedFilesystems are pseudo, network and image filesystems the audit
+// doesn't descend into
+var skippedFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "cgroup": true, "cgroup2": true, "devpts": true, "devtmpfs": true,
+	"securityfs": true, "debugfs": true, "tracefs": true, "pstore": true, "bpf": true, "configfs": true,
+	"mqueue": true, "hugetlbfs": true, "fusectl": true, "autofs": true, "binfmt_misc": true, "efivarfs": true,
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true, "ceph": true, "glusterfs": true,
+	"9p": true, "fuse.sshfs": true, "fuse.s3fs": true, "squashfs": true, "iso9660": true, "nsfs": true,
+}
+
+// FSAuditConfig controls the filesystem audit; the server may replace it
+// with the "fs_audit" config section
+type FSAuditConfig struct {
+	// Exclude lists directories (and everything below them) or globs
+	Exclude []string `json:"exclude"`
+	// FilesPerSecond throttles the walk to limit disk IO
+	FilesPerSecond int `json:"files_per_second"`
+}
+
+// fsAuditEntry is a SUID/SGID file or a world-writable file or directory
+type fsAuditEntry struct {
+	Kind  string `json:"kind"` // suid, sgid, suid+sgid, world_writable_file, world_writable_dir
+	Mode  string `json:"mode"`
+	UID   uint32 `json:"uid"`
+	GID   uint32 `json:"gid"`
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	Hash  string `json:"sha256,omitempty"` // SUID/SGID files only
+}
+
+// fsAuditConfig returns the server-provided audit config or the flags
+func fsAuditConfig() FSAuditConfig {
+	cfg := FSAuditConfig{Exclude: splitList(*fsAuditExclude), FilesPerSecond: *fsAuditRate}
+	if serverSection("fs_audit", &cfg) {
+		log.Printf("🔐 Using server-provided filesystem audit config")
+	}
+	return cfg
+}
+
+// collectFilesystemAudit periodically inventories SUID/SGID files and
+// world-writable files and directories without the sticky bit on local
+// mounts. The first run is the baseline; later runs report changes only.
+func (sc *SecurityCollector) collectFilesystemAudit() {
+	log.Printf("🔐 Starting SUID/SGID and world-writable file audit...")
+
+	stateFile := filepath.Join(*stateDir, "fs_audit.json")
+	var previous map[string]fsAuditEntry
+	baseline := loadState(stateFile, &previous)
+
+	ticker := time.NewTicker(*fsAuditInterval)
+	defer ticker.Stop()
+
+	for {
+		started := time.Now()
+		current, complete := runFilesystemAudit(sc, fsAuditConfig(), previous)
+		if sc.ctx.Err() != nil {
+			return
+		}
+		log.Printf("🔐 Filesystem audit found %d entries in %v", len(current), time.Since(started).Round(time.Second))
+
+		if !complete && baseline {
+			// World-writable entries past the cap would be reported as
+			// removed, and as added once a later walk completes, so those
+			// keep their previous state; SUID/SGID changes are still reported
+			log.Printf("⚠️ Filesystem audit stopped recording world-writable entries at %d, their changes not reported", fsAuditMaxWritable)
+			holdWorldWritable(previous, current)
+		}
+		if baseline {
+			sc.reportFSAuditChanges(previous, current)
+		} else {
+			sc.sendFSAuditBaseline(current)
+		}
+		saveState(stateFile, current)
+		previous, baseline = current, true
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// localMounts lists mount points of local filesystems
+func localMounts() []string {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return []string{"/"}
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	var mounts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || skippedFilesystems[fields[2]] {
+			continue
+		}
+		// Mount points escape spaces and tabs as octal
+		mount := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\134`, `\`).Replace(fields[1])
+		if !seen[mount] {
+			seen[mount] = true
+			mounts = append(mounts, mount)
+		}
+	}
+	sort.Strings(mounts)
+	return mounts
+}
+
+// excludedPath reports whether path is below an excluded directory or
+// matches an excluded glob
+func excludedPath(exclude []string, path string) bool {
+	for _, e := range exclude {
+		if path == e || strings.HasPrefix(path, strings.TrimSuffix(e, "/")+"/") {
+			return true
+		}
+	}
+	return matchAny(exclude, path)
+}
+
+// runFilesystemAudit walks every local mount without crossing into other
+// filesystems, at most cfg.FilesPerSecond entries per second. It reports
+// false if world-writable entries were dropped at the cap.
+func runFilesystemAudit(sc *SecurityCollector, cfg FSAuditConfig, previous map[string]fsAuditEntry) (map[string]fsAuditEntry, bool) {
+	entries := make(map[string]fsAuditEntry)
+	complete := true
+	writable := 0
+
+	visited := 0
+	started := time.Now()
+	throttle := func() {
+		visited++
+		if cfg.FilesPerSecond <= 0 || visited%100 != 0 {
+			return
+		}
+		if ahead := time.Duration(visited)*time.Second/time.Duration(cfg.FilesPerSecond) - time.Since(started); ahead > 0 {
+			time.Sleep(ahead)
+		}
+	}
+
+	for _, mount := range localMounts() {
+		if excludedPath(cfg.Exclude, mount) {
+			continue
+		}
+		var rootDev uint64
+		if info, err := os.Lstat(mount); err == nil {
+			if st, ok := info.Sys().(*syscall.Stat_t); ok {
+				rootDev = st.Dev
+			}
+		}
+
+		filepath.WalkDir(mount, func(path string, d fs.DirEntry, err error) error {
+			if sc.ctx.Err() != nil {
+				return fs.SkipAll
+			}
+			if err != nil || d.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+			throttle()
+			if path != mount && excludedPath(cfg.Exclude, path) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			st, ok := info.Sys().(*syscall.Stat_t)
+			if !ok {
+				return nil
+			}
+			// Other mounts below this one are walked on their own
+			if d.IsDir() && path != mount && st.Dev != rootDev {
+				return fs.SkipDir
+			}
+
+			kind := auditKind(info.Mode())
+			if kind == "" {
+				return nil
+			}
+			if strings.HasPrefix(kind, "world_writable") {
+				if writable >= fsAuditMaxWritable {
+					complete = false
+					return nil
+				}
+				writable++
+			}
+			e := fsAuditEntry{
+				Kind:  kind,
+				Mode:  info.Mode().String(),
+				UID:   st.Uid,
+				GID:   st.Gid,
+				Size:  info.Size(),
+				MTime: info.ModTime().UnixNano(),
+			}
+			if info.Mode()&(fs.ModeSetuid|fs.ModeSetgid) != 0 {
+				if prev, ok := previous[path]; ok && prev.Size == e.Size && prev.MTime == e.MTime && prev.Hash != "" {
+					e.Hash = prev.Hash
+				} else {
+					e.Hash = hashFile(path)
+				}
+			}
+			entries[path] = e
+			return nil
+		})
+	}
+	return entries, complete
+}
+
+// holdWorldWritable replaces the world-writable entries of a truncated audit
+// with those of the previous one
+func holdWorldWritable(previous, current map[string]fsAuditEntry) {
+	for path, e := range current {
+		if strings.HasPrefix(e.Kind, "world_writable") {
+			delete(current, path)
+		}
+	}
+	for path, e := range previous {
+		if strings.HasPrefix(e.Kind, "world_writable") {
+			current[path] = e
+		}
+	}
+}
+
+// auditKind classifies a file mode, or returns "" if it isn't audited
+func auditKind(mode fs.FileMode) string {
+	switch {
+	case mode.IsRegular() && mode&fs.ModeSetuid != 0 && mode&fs.ModeSetgid != 0:
+		return "suid+sgid"
+	case mode.IsRegular() && mode&fs.ModeSetuid != 0:
+		return "suid"
+	case mode.IsRegular() && mode&fs.ModeSetgid != 0:
+		return "sgid"
+	case mode.IsRegular() && mode.Perm()&0002 != 0:
+		return "world_writable_file"
+	case mode.IsDir() && mode.Perm()&0002 != 0 && mode&fs.ModeSticky == 0:
+		return "world_writable_dir"
+	}
+	return ""
+}
+
+// auditSeverity rates a new or changed entry: SUID/SGID files in temporary
+// or home directories and anything world-writable in system directories are
+// classic privilege escalation steps
+func auditSeverity(path string, e fsAuditEntry) string {
+	privileged := strings.HasPrefix(e.Kind, "suid") || e.Kind == "sgid"
+	risky := []string{"/tmp/", "/var/tmp/", "/dev/shm/", "/home/", "/root/", "/run/user/"}
+	system := []string{"/etc/", "/bin/", "/sbin/", "/usr/", "/lib/", "/lib64/", "/boot/"}
+	for _, prefix := range risky {
+		if privileged && strings.HasPrefix(path, prefix) {
+			return "critical"
+		}
+	}
+	for _, prefix := range system {
+		if !privileged && strings.HasPrefix(path, prefix) {
+			return "critical"
+		}
+	}
+	return "warning"
+}
+
+// reportFSAuditChanges sends an event per added, removed or changed entry
+func (sc *SecurityCollector) reportFSAuditChanges(previous, current map[string]fsAuditEntry) {
+	var paths []string
+	for path := range current {
+		paths = append(paths, path)
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		prev, existed := previous[path]
+		cur, exists := current[path]
+		switch {
+		case !existed:
+			sc.sendFSAuditEvent("fs_audit_added", path, cur, auditSeverity(path, cur),
+				fmt.Sprintf("New %s entry: %s (%s, uid %d)", describeAuditKind(cur.Kind), path, cur.Mode, cur.UID), nil)
+		case !exists:
+			sc.sendFSAuditEvent("fs_audit_removed", path, prev, "info",
+				fmt.Sprintf("%s entry gone: %s", describeAuditKind(prev.Kind), path), nil)
+		case prev.Kind != cur.Kind || prev.Mode != cur.Mode || prev.UID != cur.UID || prev.GID != cur.GID || prev.Hash != cur.Hash:
+			var what []string
+			if prev.Mode != cur.Mode {
+				what = append(what, fmt.Sprintf("mode %s -> %s", prev.Mode, cur.Mode))
+			}
+			if prev.UID != cur.UID || prev.GID != cur.GID {
+				what = append(what, fmt.Sprintf("owner %d:%d -> %d:%d", prev.UID, prev.GID, cur.UID, cur.GID))
+			}
+			if prev.Hash != cur.Hash {
+				what = append(what, "content")
+			}
+			changes := strings.Join(what, ", ")
+			sc.sendFSAuditEvent("fs_audit_changed", path, cur, auditSeverity(path, cur),
+				fmt.Sprintf("%s entry changed: %s (%s)", describeAuditKind(cur.Kind), path, changes),
+				map[string]string{"changes": changes, "previous_mode": prev.Mode})
+		}
+	}
+}
+
+// sendFSAuditEvent sends one audit change on the fs_audit stream
+func (sc *SecurityCollector) sendFSAuditEvent(eventType, path string, e fsAuditEntry, severity, message string, extra map[string]string) {
+	labels := map[string]string{
+		"event_type": eventType,
+		"path":       path,
+		"kind":       e.Kind,
+		"mode":       e.Mode,
+		"uid":        strconv.FormatUint(uint64(e.UID), 10),
+		"gid":        strconv.FormatUint(uint64(e.GID), 10),
+		"severity":   severity,
+	}
+	if e.Hash != "" {
+		labels["sha256"] = e.Hash
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	log.Printf("🔐 %s", message)
+	sc.sendEvent("fs_audit", message, labels)
+}
+
+// sendFSAuditBaseline summarises the first audit
+func (sc *SecurityCollector) sendFSAuditBaseline(entries map[string]fsAuditEntry) {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.Kind]++
+	}
+	labels := map[string]string{
+		"event_type": "fs_audit_baseline",
+		"count":      strconv.Itoa(len(entries)),
+		"severity":   "info",
+	}
+	for kind, n := range counts {
+		labels["count_"+strings.ReplaceAll(kind, "+", "_")] = strconv.Itoa(n)
+	}
+	message := fmt.Sprintf("Filesystem audit baseline: %d SUID/SGID and world-writable entries", len(entries))
+	log.Printf("🔐 %s", message)
+	sc.sendEvent("fs_audit", message, labels)
+}
+
+func describeAuditKind(kind string) string {
+	switch kind {
+	case "world_writable_file":
+		return "World-writable file"
+	case "world_writable_dir":
+		return "World-writable directory"
+	}
+	return strings.ToUpper(kind)
+}
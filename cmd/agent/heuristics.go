@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mulutu/security-manager/internal/heuristics"
+)
+
+// formatProcessTree renders a process and its ancestors root first, e.g.
+// "systemd(1) > nginx(812) > sh(2314)"
+func formatProcessTree(p heuristics.Process, ancestors []heuristics.Process) string {
+	parts := make([]string, 0, len(ancestors)+1)
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		parts = append(parts, fmt.Sprintf("%s(%d)", ancestors[i].Name, ancestors[i].PID))
+	}
+	parts = append(parts, fmt.Sprintf("%s(%d)", p.Name, p.PID))
+	return strings.Join(parts, " > ")
+}
+
+// maxAncestryCmdline caps each command line of an ancestry label
+const maxAncestryCmdline = 256
+
+// ancestryEntry is one process of the ancestry label
+type ancestryEntry struct {
+	PID     int    `json:"pid"`
+	PPID    int    `json:"ppid"`
+	Name    string `json:"name"`
+	Exe     string `json:"exe,omitempty"`
+	Cmdline string `json:"cmdline,omitempty"`
+	User    string `json:"user,omitempty"`
+}
+
+// encodeAncestry renders a process and its ancestors root first as JSON
+func encodeAncestry(p heuristics.Process, ancestors []heuristics.Process) string {
+	chain := make([]ancestryEntry, 0, len(ancestors)+1)
+	add := func(a heuristics.Process) {
+		cmdline := strings.Join(a.Cmdline, " ")
+		if len(cmdline) > maxAncestryCmdline {
+			cmdline = cmdline[:maxAncestryCmdline] + "..."
+		}
+		chain = append(chain, ancestryEntry{PID: a.PID, PPID: a.PPID, Name: a.Name, Exe: a.Exe, Cmdline: cmdline, User: a.User})
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		add(ancestors[i])
+	}
+	add(p)
+
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
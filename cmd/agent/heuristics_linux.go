@@ -0,0 +1,243 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/heuristics"
+)
+
+const (
+	// maxProcessDepth bounds the parent walk in case of a PID cycle race
+	maxProcessDepth = 64
+	// maxCmdlineLabel caps the command line attached to an event
+	maxCmdlineLabel = 1024
+)
+
+// collectSuspiciousProcesses runs the process heuristics on every process
+// that is new or has exec'd since the last scan, and reports each heuristic
+// that matches a process once. Each scan also feeds the lineage cache.
+func (sc *SecurityCollector) collectSuspiciousProcesses() {
+	log.Printf("🐚 Starting suspicious process heuristics...")
+
+	ticker := time.NewTicker(*processScanInterval)
+	defer ticker.Stop()
+
+	seen := make(map[int]string) // pid -> comm and command line at last scan
+	self := os.Getpid()
+	for {
+		current := make(map[int]string, len(seen))
+		var sockets map[uint64]string
+		live := listProcPids()
+		for pid := range live {
+			if pid == self {
+				continue
+			}
+			signature := readTrimmed(fmt.Sprintf("/proc/%d/comm", pid)) + "\x00" + readCmdlineRaw(pid)
+			current[pid] = signature
+			if seen[pid] == signature {
+				continue
+			}
+
+			p, ok := sc.lineage.observe(pid)
+			if !ok {
+				continue
+			}
+			if p.IsShell() || isInterpreter(p) {
+				if sockets == nil {
+					sockets = inetSocketInodes()
+				}
+				p.StdioSockets = stdioSockets(pid, sockets)
+			}
+			ancestors := sc.lineage.ancestry(p)
+			for _, f := range heuristics.Evaluate(p, ancestors) {
+				sc.sendSuspiciousProcess(p, ancestors, f)
+			}
+		}
+		seen = current
+		sc.lineage.sweep(live)
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendSuspiciousProcess sends one heuristic finding with the process tree
+func (sc *SecurityCollector) sendSuspiciousProcess(p heuristics.Process, ancestors []heuristics.Process, f heuristics.Finding) {
+	cmdline := strings.Join(p.Cmdline, " ")
+	if len(cmdline) > maxCmdlineLabel {
+		cmdline = cmdline[:maxCmdlineLabel] + "..."
+	}
+	tree := formatProcessTree(p, ancestors)
+	labels := map[string]string{
+		"event_type":   "suspicious_process",
+		"heuristic":    f.Heuristic,
+		"reason":       f.Reason,
+		"pid":          strconv.Itoa(p.PID),
+		"ppid":         strconv.Itoa(p.PPID),
+		"process":      p.Name,
+		"exe":          p.Exe,
+		"cmdline":      cmdline,
+		"user":         p.User,
+		"uid":          strconv.Itoa(p.UID),
+		"process_tree": tree,
+		"severity":     f.Severity,
+	}
+	if chain := encodeAncestry(p, ancestors); chain != "" {
+		labels["ancestry"] = chain
+	}
+
+	message := fmt.Sprintf("Suspicious process (%s): %s [%s]", f.Heuristic, f.Reason, tree)
+	log.Printf("🐚 %s", message)
+	sc.sendEvent("process", message, labels)
+}
+
+func isInterpreter(p heuristics.Process) bool {
+	name, _ := p.Interpreter()
+	return name != ""
+}
+
+// readProcessInfo reads a process's identity from /proc
+func readProcessInfo(pid int) (heuristics.Process, bool) {
+	p, ok := readProcessStat(pid)
+	if !ok {
+		return heuristics.Process{}, false
+	}
+
+	p.Exe, _ = os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if raw := readCmdlineRaw(pid); raw != "" {
+		p.Cmdline = strings.Split(strings.TrimRight(raw, "\x00"), "\x00")
+	}
+	p.UID = -1
+	if status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid)); err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			if v, ok := strings.CutPrefix(line, "Uid:"); ok {
+				if fields := strings.Fields(v); len(fields) > 0 {
+					p.UID, _ = strconv.Atoi(fields[0])
+				}
+				break
+			}
+		}
+	}
+	if p.UID >= 0 {
+		p.User = strconv.Itoa(p.UID)
+		if u, err := user.LookupId(p.User); err == nil {
+			p.User = u.Username
+		}
+	}
+	return p, true
+}
+
+// readProcessStat reads a process's comm, parent and start time
+func readProcessStat(pid int) (heuristics.Process, bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return heuristics.Process{}, false
+	}
+	// comm is parenthesised and may itself contain spaces or parentheses
+	lp, rp := strings.IndexByte(string(stat), '('), strings.LastIndexByte(string(stat), ')')
+	if lp < 0 || rp < lp {
+		return heuristics.Process{}, false
+	}
+	p := heuristics.Process{PID: pid, Name: string(stat[lp+1 : rp])}
+	// Fields after comm start at field 3 (state); ppid is 4, starttime 22
+	if fields := strings.Fields(string(stat[rp+1:])); len(fields) > 19 {
+		p.PPID, _ = strconv.Atoi(fields[1])
+		p.Start, _ = strconv.ParseUint(fields[19], 10, 64)
+	}
+	return p, true
+}
+
+// readCmdlineRaw returns a process's NUL-separated command line
+func readCmdlineRaw(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// stdioSockets maps a process's stdin, stdout and stderr to the remote
+// address of the TCP or UDP socket each is connected to
+func stdioSockets(pid int, sockets map[uint64]string) map[int]string {
+	found := make(map[int]string)
+	for fd := 0; fd <= 2; fd++ {
+		target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, fd))
+		if err != nil {
+			continue
+		}
+		inode, ok := strings.CutPrefix(target, "socket:[")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64)
+		if err != nil {
+			continue
+		}
+		// Unix sockets (journald, pipes to supervisors) aren't in the table
+		if remote, ok := sockets[n]; ok {
+			found[fd] = remote
+		}
+	}
+	return found
+}
+
+// inetSocketInodes maps the inode of every TCP and UDP socket to its remote
+// address
+func inetSocketInodes() map[uint64]string {
+	sockets := make(map[uint64]string)
+	for _, table := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open("/proc/net/" + table)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			inode, err := strconv.ParseUint(fields[9], 10, 64)
+			if err != nil || inode == 0 {
+				continue
+			}
+			sockets[inode] = table + " " + parseProcNetAddr(fields[2])
+		}
+		f.Close()
+	}
+	return sockets
+}
+
+// parseProcNetAddr decodes a /proc/net address such as "0100007F:0050",
+// where the IP is stored as host-order 32-bit words
+func parseProcNetAddr(s string) string {
+	host, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return s
+	}
+	raw, err := hex.DecodeString(host)
+	if err != nil || len(raw)%4 != 0 {
+		return s
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+	p, _ := strconv.ParseUint(port, 16, 16)
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(p, 10))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// agentIDNamespace keeps the derived ID from exposing the raw machine-id
+const agentIDNamespace = "security-manager-agent:"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// loadAgentID returns the persistent agent UUID from the state directory,
+// creating it on first start. The ID is derived from /etc/machine-id so a
+// reinstall on the same machine keeps its identity; hostname changes never
+// affect it.
+func loadAgentID(dir string) string {
+	path := filepath.Join(dir, "agent-id")
+	if data, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(data)); uuidPattern.MatchString(id) {
+			return id
+		}
+		log.Printf("⚠️ Ignoring malformed agent ID in %s", path)
+	}
+
+	id := newAgentID(readMachineID())
+	if err := os.MkdirAll(dir, 0700); err == nil {
+		err = os.WriteFile(path, []byte(id+"\n"), 0600)
+		if err == nil {
+			log.Printf("🆔 Created agent ID %s", id)
+			return id
+		}
+	}
+	log.Printf("⚠️ Could not persist agent ID to %s; identity may change on restart", path)
+	return id
+}
+
+// newAgentID derives a UUID from the machine ID, or a random one without it
+func newAgentID(machineID string) string {
+	var b [16]byte
+	if machineID != "" {
+		sum := sha256.Sum256([]byte(agentIDNamespace + machineID))
+		copy(b[:], sum[:16])
+		b[6] = b[6]&0x0f | 0x50 // name-based (version 5 layout)
+	} else {
+		if _, err := rand.Read(b[:]); err != nil {
+			log.Fatalf("generate agent ID: %v", err)
+		}
+		b[6] = b[6]&0x0f | 0x40 // random (version 4)
+	}
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// readMachineID returns the systemd/dbus machine ID
+func readMachineID() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
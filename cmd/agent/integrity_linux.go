@@ -0,0 +1,388 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxPidScan caps the brute-force PID scan at the kernel's largest pid_max
+	maxPidScan = 4194304
+	// iffPromisc is IFF_PROMISC from <linux/if.h>
+	iffPromisc = 0x100
+)
+
+// devHiddenAllowed are dot files in /dev created by normal system software
+var devHiddenAllowed = []string{"/dev/.udev", "/dev/.initramfs", "/dev/.lxc", "/dev/.lxd-mounts", "/dev/.mdadm"}
+
+// devDataDirs are directories under /dev that legitimately hold regular files
+var devDataDirs = []string{"/dev/shm", "/dev/mqueue", "/dev/hugepages", "/dev/pts"}
+
+// packagedPrefixes hold binaries replaced by package upgrades, which leaves
+// running services with a deleted executable
+var packagedPrefixes = []string{"/usr/", "/bin/", "/sbin/", "/lib/", "/lib64/", "/opt/", "/snap/"}
+
+// integrityFinding is one rootkit or tampering indicator
+type integrityFinding struct {
+	key      string // identifies the finding across checks
+	check    string
+	severity string
+	message  string
+	labels   map[string]string
+}
+
+// collectIntegrityChecks periodically looks for rootkit and tampering
+// indicators and reports each finding once, and again when it clears
+func (sc *SecurityCollector) collectIntegrityChecks() {
+	log.Printf("🕵️ Starting integrity checks...")
+
+	ticker := time.NewTicker(*integrityInterval)
+	defer ticker.Stop()
+
+	active := make(map[string]integrityFinding)
+	for {
+		current := make(map[string]integrityFinding)
+		for _, f := range runIntegrityChecks() {
+			current[f.key] = f
+			if _, seen := active[f.key]; !seen {
+				sc.sendIntegrityFinding(f)
+			}
+		}
+		for key, f := range active {
+			if _, ok := current[key]; !ok {
+				labels := map[string]string{
+					"event_type": "integrity_cleared",
+					"check":      f.check,
+					"severity":   "info",
+				}
+				message := "Integrity finding cleared: " + f.message
+				log.Printf("🕵️ %s", message)
+				sc.sendEvent("integrity", message, labels)
+			}
+		}
+		active = current
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runIntegrityChecks runs every check
+func runIntegrityChecks() []integrityFinding {
+	var findings []integrityFinding
+	findings = append(findings, checkHiddenPids()...)
+	findings = append(findings, checkProcesses()...)
+	findings = append(findings, checkPreloadFile()...)
+	findings = append(findings, checkPromiscuous()...)
+	findings = append(findings, checkDevHiddenFiles()...)
+	return findings
+}
+
+// sendIntegrityFinding sends one finding on the integrity stream
+func (sc *SecurityCollector) sendIntegrityFinding(f integrityFinding) {
+	labels := map[string]string{
+		"event_type": "integrity_" + f.check,
+		"check":      f.check,
+		"severity":   f.severity,
+	}
+	for k, v := range f.labels {
+		labels[k] = v
+	}
+	log.Printf("🕵️ %s", f.message)
+	sc.sendEvent("integrity", f.message, labels)
+}
+
+// listProcPids returns the PIDs visible by reading the /proc directory
+func listProcPids() map[int]bool {
+	pids := make(map[int]bool)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return pids
+	}
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil {
+			pids[pid] = true
+		}
+	}
+	return pids
+}
+
+// pidExists asks the kernel directly whether a process exists; EPERM means
+// it exists but belongs to someone else
+func pidExists(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || err == unix.EPERM
+}
+
+// isThread reports whether pid is a thread of another process; threads
+// answer kill(2) but aren't listed in /proc
+func isThread(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "Tgid:"); ok {
+			tgid, _ := strconv.Atoi(strings.TrimSpace(v))
+			return tgid != pid
+		}
+	}
+	return false
+}
+
+// checkHiddenPids compares the PIDs listed in /proc with a brute-force scan
+// using kill(2); a process that exists but isn't listed is being hidden,
+// typically by a rootkit filtering getdents on /proc
+func checkHiddenPids() []integrityFinding {
+	pidMax, _ := strconv.Atoi(readTrimmed("/proc/sys/kernel/pid_max"))
+	if pidMax <= 0 || pidMax > maxPidScan {
+		pidMax = maxPidScan
+	}
+
+	listed := listProcPids()
+	var candidates []int
+	for pid := 1; pid < pidMax; pid++ {
+		if !listed[pid] && pidExists(pid) {
+			candidates = append(candidates, pid)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Processes started during the scan show up as candidates; list again
+	listed = listProcPids()
+	var findings []integrityFinding
+	for _, pid := range candidates {
+		if listed[pid] || !pidExists(pid) || isThread(pid) {
+			continue
+		}
+		labels := map[string]string{"pid": strconv.Itoa(pid)}
+		name := ""
+		if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+			name = strings.TrimSpace(string(comm))
+			labels["process"] = name
+		}
+		if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+			labels["exe"] = exe
+		}
+		findings = append(findings, integrityFinding{
+			key:      fmt.Sprintf("hidden_pid:%d", pid),
+			check:    "hidden_pid",
+			severity: "critical",
+			message:  fmt.Sprintf("Hidden process: PID %d %s exists but is not listed in /proc", pid, name),
+			labels:   labels,
+		})
+	}
+	return findings
+}
+
+// checkProcesses flags processes running from deleted or memfd-backed
+// executables and processes started with LD_PRELOAD
+func checkProcesses() []integrityFinding {
+	pids := make([]int, 0)
+	for pid := range listProcPids() {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+
+	self := os.Getpid()
+	var findings []integrityFinding
+	for _, pid := range pids {
+		if pid == self {
+			continue
+		}
+		exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+		if err != nil {
+			continue // kernel thread or gone
+		}
+		name := readTrimmed(fmt.Sprintf("/proc/%d/comm", pid))
+		labels := map[string]string{
+			"pid":     strconv.Itoa(pid),
+			"process": name,
+			"exe":     exe,
+		}
+
+		switch {
+		case strings.HasPrefix(exe, "/memfd:"):
+			findings = append(findings, integrityFinding{
+				key:      fmt.Sprintf("memfd_exe:%d", pid),
+				check:    "memfd_exe",
+				severity: "critical",
+				message:  fmt.Sprintf("Fileless process: PID %d %s runs from memory file %s", pid, name, exe),
+				labels:   labels,
+			})
+		case strings.HasSuffix(exe, " (deleted)"):
+			// Package upgrades replace binaries under running services
+			severity := "critical"
+			path := strings.TrimSuffix(exe, " (deleted)")
+			for _, prefix := range packagedPrefixes {
+				if strings.HasPrefix(path, prefix) {
+					severity = "warning"
+				}
+			}
+			findings = append(findings, integrityFinding{
+				key:      fmt.Sprintf("deleted_exe:%d", pid),
+				check:    "deleted_exe",
+				severity: severity,
+				message:  fmt.Sprintf("Process running deleted executable: PID %d %s (%s)", pid, name, path),
+				labels:   labels,
+			})
+		}
+
+		if preload := processEnv(pid, "LD_PRELOAD"); preload != "" {
+			l := map[string]string{"ld_preload": preload}
+			for k, v := range labels {
+				l[k] = v
+			}
+			findings = append(findings, integrityFinding{
+				key:      fmt.Sprintf("ld_preload_env:%d:%s", pid, preload),
+				check:    "ld_preload_env",
+				severity: "critical",
+				message:  fmt.Sprintf("Process started with LD_PRELOAD: PID %d %s preloads %s", pid, name, preload),
+				labels:   l,
+			})
+		}
+	}
+	return findings
+}
+
+// processEnv returns a variable from a process's initial environment
+func processEnv(pid int, name string) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return ""
+	}
+	prefix := []byte(name + "=")
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		if bytes.HasPrefix(kv, prefix) {
+			return string(kv[len(prefix):])
+		}
+	}
+	return ""
+}
+
+// checkPreloadFile flags libraries listed in /etc/ld.so.preload, which are
+// loaded into every dynamically linked process
+func checkPreloadFile() []integrityFinding {
+	f, err := os.Open("/etc/ld.so.preload")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var libraries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			libraries = append(libraries, line)
+		}
+	}
+	if len(libraries) == 0 {
+		return nil
+	}
+	list := strings.Join(libraries, " ")
+	return []integrityFinding{{
+		key:      "ld_preload_file:" + list,
+		check:    "ld_preload_file",
+		severity: "critical",
+		message:  fmt.Sprintf("/etc/ld.so.preload preloads %s", list),
+		labels:   map[string]string{"path": "/etc/ld.so.preload", "libraries": list},
+	}}
+}
+
+// checkPromiscuous flags interfaces in promiscuous mode, which captures
+// traffic not addressed to the host
+func checkPromiscuous() []integrityFinding {
+	entries, err := os.ReadDir("/sys/class/net")
+	if err != nil {
+		return nil
+	}
+	var findings []integrityFinding
+	for _, e := range entries {
+		flags, err := strconv.ParseUint(strings.TrimPrefix(readTrimmed(filepath.Join("/sys/class/net", e.Name(), "flags")), "0x"), 16, 32)
+		if err != nil || flags&iffPromisc == 0 {
+			continue
+		}
+		findings = append(findings, integrityFinding{
+			key:      "promiscuous:" + e.Name(),
+			check:    "promiscuous_interface",
+			severity: "critical",
+			message:  fmt.Sprintf("Network interface %s is in promiscuous mode", e.Name()),
+			labels:   map[string]string{"interface": e.Name()},
+		})
+	}
+	return findings
+}
+
+// checkDevHiddenFiles flags dot files and regular files in /dev, a
+// traditional hiding place for rootkit configuration and payloads
+func checkDevHiddenFiles() []integrityFinding {
+	var findings []integrityFinding
+	filepath.WalkDir("/dev", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == "/dev" {
+			return nil
+		}
+		for _, dir := range devDataDirs {
+			if path == dir {
+				return fs.SkipDir
+			}
+		}
+		for _, allowed := range devHiddenAllowed {
+			if path == allowed {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+		}
+
+		hidden := strings.HasPrefix(d.Name(), ".")
+		if !hidden && !d.Type().IsRegular() {
+			return nil
+		}
+		labels := map[string]string{"path": path}
+		kind := "file"
+		if d.IsDir() {
+			kind = "directory"
+		}
+		labels["type"] = kind
+		if info, err := d.Info(); err == nil {
+			labels["size"] = strconv.FormatInt(info.Size(), 10)
+			labels["mode"] = info.Mode().String()
+		}
+		reason := "hidden " + kind
+		if !hidden {
+			reason = "regular file"
+		}
+		findings = append(findings, integrityFinding{
+			key:      "dev_file:" + path,
+			check:    "dev_hidden_file",
+			severity: "critical",
+			message:  fmt.Sprintf("Suspicious %s in /dev: %s", reason, path),
+			labels:   labels,
+		})
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return findings
+}
@@ -0,0 +1,370 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/inventory"
+	"golang.org/x/sys/unix"
+)
+
+// collectInventory sends a host inventory snapshot at start and periodically
+func (sc *SecurityCollector) collectInventory() {
+	log.Printf("🗂️ Starting host inventory reporting...")
+
+	ticker := time.NewTicker(*inventoryInterval)
+	defer ticker.Stop()
+
+	for {
+		sc.sendInventory(inventory.EventSnapshot, gatherInventory(), nil)
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendInventory sends an inventory snapshot with summary labels
+func (sc *SecurityCollector) sendInventory(eventType string, inv *inventory.Inventory, extra map[string]string) {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		log.Printf("Failed to encode inventory: %v", err)
+		return
+	}
+
+	labels := map[string]string{
+		"event_type":     eventType,
+		"hostname":       inv.Hostname,
+		"machine_id":     inv.MachineID,
+		"os":             inv.OS.PrettyName,
+		"kernel":         inv.Kernel.Release,
+		"virtualization": inv.Virtualization,
+		"container":      inv.Container,
+		"primary_ip":     inv.PrimaryIP,
+		"severity":       "info",
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	sc.sendEvent(inventory.Stream, string(data), labels)
+}
+
+// gatherInventory collects the current host inventory
+func gatherInventory() *inventory.Inventory {
+	inv := &inventory.Inventory{
+		CollectedAt:  time.Now().UTC(),
+		MachineID:    readMachineID(),
+		OS:           readOSRelease(),
+		CPU:          readCPUInfo(),
+		Timezone:     readTimezone(),
+		AgentVersion: version,
+	}
+	inv.Hostname, _ = os.Hostname()
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err == nil {
+		inv.Kernel = inventory.KernelInfo{
+			Release:      unix.ByteSliceToString(uts.Release[:]),
+			Version:      unix.ByteSliceToString(uts.Version[:]),
+			Architecture: unix.ByteSliceToString(uts.Machine[:]),
+		}
+	}
+
+	mem := readMemInfo()
+	inv.MemoryBytes = mem.TotalBytes
+	inv.SwapBytes = mem.SwapTotalBytes
+
+	inv.Disks = readDisks()
+	for _, fs := range readFilesystems() {
+		m := inventory.Mount{Mount: fs.Mount, Device: fs.Device, Type: fs.Type, TotalBytes: fs.TotalBytes}
+		var st unix.Statfs_t
+		if unix.Statfs(fs.Mount, &st) == nil {
+			m.ReadOnly = st.Flags&unix.ST_RDONLY != 0
+		}
+		inv.Mounts = append(inv.Mounts, m)
+	}
+	network := readNetworkState()
+	inv.Interfaces = network.interfaces
+	inv.Routes = network.routes
+	inv.DefaultInterface = network.defaultIf
+	inv.PrimaryIP = network.primaryIP
+
+	forEachLine("/proc/stat", func(fields []string) {
+		if len(fields) == 2 && fields[0] == "btime" {
+			if btime, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				inv.BootTime = time.Unix(btime, 0).UTC()
+			}
+		}
+	})
+	if data, err := os.ReadFile("/proc/uptime"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			inv.UptimeSeconds, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+
+	inv.Virtualization, inv.Container = detectVirtualization()
+	return inv
+}
+
+// readOSRelease parses /etc/os-release
+func readOSRelease() inventory.OSInfo {
+	var info inventory.OSInfo
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), "=")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(value, `"'`)
+			switch key {
+			case "ID":
+				info.ID = value
+			case "VERSION_ID":
+				info.Version = value
+			case "PRETTY_NAME":
+				info.PrettyName = value
+			}
+		}
+		f.Close()
+		return info
+	}
+	return info
+}
+
+// readCPUInfo parses /proc/cpuinfo
+func readCPUInfo() inventory.CPUInfo {
+	var info inventory.CPUInfo
+	sockets := make(map[string]bool)
+	cores := make(map[string]bool)
+	var physical string
+
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return info
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "processor":
+			info.Threads++
+		case "model name":
+			if info.Model == "" {
+				info.Model = value
+			}
+		case "vendor_id":
+			if info.Vendor == "" {
+				info.Vendor = value
+			}
+		case "cpu MHz":
+			if info.MHz == 0 {
+				mhz, _ := strconv.ParseFloat(value, 64)
+				info.MHz = int(mhz)
+			}
+		case "physical id":
+			physical = value
+			sockets[value] = true
+		case "core id":
+			cores[physical+"/"+value] = true
+		}
+	}
+
+	info.Sockets = max(len(sockets), 1)
+	info.Cores = len(cores)
+	if info.Cores == 0 {
+		// No topology (ARM, some VMs): count each thread as a core
+		info.Cores = info.Threads
+	}
+	return info
+}
+
+// readDisks lists whole block devices from /sys/block
+func readDisks() []inventory.Disk {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+
+	readSys := func(parts ...string) string {
+		data, _ := os.ReadFile(filepath.Join(append([]string{"/sys/block"}, parts...)...))
+		return strings.TrimSpace(string(data))
+	}
+
+	var disks []inventory.Disk
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		sectors, _ := strconv.ParseUint(readSys(name, "size"), 10, 64)
+		if sectors == 0 {
+			continue
+		}
+		disks = append(disks, inventory.Disk{
+			Name:       name,
+			SizeBytes:  sectors * 512,
+			Model:      readSys(name, "device", "model"),
+			Serial:     readSys(name, "device", "serial"),
+			Rotational: readSys(name, "queue", "rotational") == "1",
+			Removable:  readSys(name, "removable") == "1",
+		})
+	}
+	return disks
+}
+
+// readInterfaces lists network interfaces with their addresses
+func readInterfaces() []inventory.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var result []inventory.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		entry := inventory.Interface{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			MTU:  iface.MTU,
+			Up:   iface.Flags&net.FlagUp != 0,
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipnet.IP.To4() != nil {
+				entry.IPv4 = append(entry.IPv4, ipnet.String())
+			} else {
+				entry.IPv6 = append(entry.IPv6, ipnet.String())
+			}
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// readTimezone returns the configured IANA timezone
+func readTimezone() string {
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		if tz := strings.TrimSpace(string(data)); tz != "" {
+			return tz
+		}
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if _, tz, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return tz
+		}
+	}
+	name, offset := time.Now().Zone()
+	return fmt.Sprintf("%s (UTC%+d)", name, offset/3600)
+}
+
+// detectVirtualization identifies the hypervisor and container runtime
+func detectVirtualization() (virt, container string) {
+	virt, container = "none", "none"
+
+	// Containers
+	switch {
+	case fileExists("/.dockerenv"):
+		container = "docker"
+	case fileExists("/run/.containerenv"):
+		container = "podman"
+	default:
+		if data, err := os.ReadFile("/proc/1/environ"); err == nil {
+			for _, kv := range strings.Split(string(data), "\x00") {
+				if v, ok := strings.CutPrefix(kv, "container="); ok && v != "" {
+					container = v
+				}
+			}
+		}
+		if container == "none" {
+			if data, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+				cgroup := string(data)
+				switch {
+				case strings.Contains(cgroup, "kubepods"):
+					container = "kubernetes"
+				case strings.Contains(cgroup, "docker"):
+					container = "docker"
+				case strings.Contains(cgroup, "lxc"):
+					container = "lxc"
+				}
+			}
+		}
+	}
+
+	// Hypervisors, from DMI then the Xen interface
+	readDMI := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join("/sys/class/dmi/id", name))
+		return strings.ToLower(strings.TrimSpace(string(data)))
+	}
+	dmi := readDMI("sys_vendor") + " " + readDMI("product_name") + " " + readDMI("bios_vendor")
+	for _, known := range []struct{ match, name string }{
+		{"qemu", "qemu"},
+		{"kvm", "kvm"},
+		{"vmware", "vmware"},
+		{"virtualbox", "oracle"},
+		{"innotek", "oracle"},
+		{"microsoft corporation virtual", "microsoft"},
+		{"hyper-v", "microsoft"},
+		{"xen", "xen"},
+		{"amazon ec2", "amazon"},
+		{"google compute engine", "google"},
+		{"parallels", "parallels"},
+		{"bochs", "bochs"},
+		{"firecracker", "firecracker"},
+	} {
+		if strings.Contains(dmi, known.match) {
+			return known.name, container
+		}
+	}
+	if data, err := os.ReadFile("/sys/hypervisor/type"); err == nil {
+		if t := strings.TrimSpace(string(data)); t != "" {
+			return t, container
+		}
+	}
+
+	// Unknown hypervisor that still advertises itself to the guest
+	forEachLine("/proc/cpuinfo", func(fields []string) {
+		if len(fields) > 0 && fields[0] == "flags" {
+			for _, flag := range fields {
+				if flag == "hypervisor" {
+					virt = "vm-other"
+				}
+			}
+		}
+	})
+	return virt, container
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
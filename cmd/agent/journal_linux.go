@@ -0,0 +1,330 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	journalBackoffMin  = time.Second
+	journalBackoffMax  = time.Minute
+	journalCursorEvery = 5 * time.Second
+	journalMaxEntry    = 1024 * 1024 // larger entries (core dumps, blobs) are skipped
+)
+
+// JournalFilter selects which journal entries are forwarded. It can be set
+// locally with the -journal-* flags or by the server in the "journal" config
+// section, which replaces the local filter.
+type JournalFilter struct {
+	Units              []string `json:"units,omitempty"`
+	ExcludeUnits       []string `json:"exclude_units,omitempty"`
+	Identifiers        []string `json:"identifiers,omitempty"`
+	ExcludeIdentifiers []string `json:"exclude_identifiers,omitempty"`
+	MaxPriority        *int     `json:"max_priority,omitempty"`
+	Match              string   `json:"match,omitempty"`
+	Exclude            string   `json:"exclude,omitempty"`
+
+	match   *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// journalFilter builds the active filter from server config or flags
+func journalFilter() *JournalFilter {
+	f := &JournalFilter{}
+	if serverSection("journal", f) {
+		log.Printf("📋 Using server-provided journal filter")
+	} else {
+		priority := *journalPriority
+		f = &JournalFilter{
+			Units:              splitList(*journalUnits),
+			ExcludeUnits:       splitList(*journalExcludeUnits),
+			Identifiers:        splitList(*journalIdents),
+			ExcludeIdentifiers: splitList(*journalExcludeIdent),
+			MaxPriority:        &priority,
+			Match:              *journalMatch,
+			Exclude:            *journalExclude,
+		}
+	}
+
+	var err error
+	if f.Match != "" {
+		if f.match, err = regexp.Compile(f.Match); err != nil {
+			log.Printf("⚠️ Invalid journal match regex %q: %v", f.Match, err)
+		}
+	}
+	if f.Exclude != "" {
+		if f.exclude, err = regexp.Compile(f.Exclude); err != nil {
+			log.Printf("⚠️ Invalid journal exclude regex %q: %v", f.Exclude, err)
+		}
+	}
+	return f
+}
+
+// Allow reports whether an entry passes the filter
+func (f *JournalFilter) Allow(unit, identifier, priority, message string) bool {
+	if f.MaxPriority != nil && priority != "" {
+		if p, err := strconv.Atoi(priority); err == nil && p > *f.MaxPriority {
+			return false
+		}
+	}
+	if len(f.Units) > 0 && !matchAny(f.Units, unit) {
+		return false
+	}
+	if matchAny(f.ExcludeUnits, unit) {
+		return false
+	}
+	if len(f.Identifiers) > 0 && !matchAny(f.Identifiers, identifier) {
+		return false
+	}
+	if matchAny(f.ExcludeIdentifiers, identifier) {
+		return false
+	}
+	if f.match != nil && !f.match.MatchString(message) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(message) {
+		return false
+	}
+	return true
+}
+
+// Args returns journalctl options that narrow the stream to what Allow can
+// accept, so unwanted entries are never read. Unit and identifier lists are
+// only passed when they hold no glob patterns, and Allow still applies the
+// full filter.
+func (f *JournalFilter) Args() []string {
+	var args []string
+	if f.MaxPriority != nil && *f.MaxPriority >= 0 && *f.MaxPriority <= 7 {
+		args = append(args, "-p", strconv.Itoa(*f.MaxPriority))
+	}
+	if len(f.Units) > 0 && !hasGlob(f.Units) {
+		for _, unit := range f.Units {
+			args = append(args, "-u", unit)
+		}
+	}
+	if len(f.Identifiers) > 0 && !hasGlob(f.Identifiers) {
+		for _, identifier := range f.Identifiers {
+			args = append(args, "-t", identifier)
+		}
+	}
+	return args
+}
+
+// hasGlob reports whether any pattern uses glob metacharacters
+func hasGlob(patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[\\") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether value matches one of the glob patterns
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// collectSystemdJournal follows the journal from the saved cursor, restarting
+// journalctl with backoff whenever it exits
+func (sc *SecurityCollector) collectSystemdJournal() {
+	log.Printf("📋 Starting systemd journal monitoring...")
+
+	filter := journalFilter()
+	cursorFile := filepath.Join(*stateDir, "journal.cursor")
+	backoff := journalBackoffMin
+
+	for {
+		started := time.Now()
+		cursor := loadJournalCursor(cursorFile)
+		rejected, err := sc.followJournal(filter, cursor, cursorFile)
+		if sc.ctx.Err() != nil {
+			return
+		}
+
+		// A cursor that no longer exists (journal vacuumed) makes journalctl
+		// fail to seek; fall back to following from now. Any other exit keeps
+		// the cursor so nothing logged meanwhile is skipped.
+		if cursor != "" && rejected {
+			log.Printf("⚠️ Journal cursor rejected, following from now")
+			os.Remove(cursorFile)
+		}
+
+		if time.Since(started) > journalBackoffMax {
+			backoff = journalBackoffMin
+		}
+		log.Printf("⚠️ journalctl exited (%v), restarting in %v", err, backoff)
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, journalBackoffMax)
+	}
+}
+
+// followJournal runs one journalctl process and forwards matching entries,
+// reporting whether journalctl refused the cursor
+func (sc *SecurityCollector) followJournal(filter *JournalFilter, cursor, cursorFile string) (bool, error) {
+	args := []string{"-f", "-o", "json"}
+	if cursor != "" {
+		args = append(args, "--after-cursor", cursor)
+	} else {
+		args = append(args, "--since", "now")
+	}
+	args = append(args, filter.Args()...)
+
+	// journalctl must be stopped before Wait if reading gives up early,
+	// or it blocks writing to the pipe and Wait never returns
+	ctx, cancel := context.WithCancel(sc.ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+
+	read := 0
+	lastSaved := time.Now()
+	reader := bufio.NewReaderSize(stdout, 64*1024)
+	var readErr error
+	for {
+		line, oversized, err := readJournalLine(reader)
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+		if oversized {
+			read++
+			log.Printf("⚠️ Skipped journal entry larger than %d bytes", journalMaxEntry)
+			continue
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		read++
+
+		// Extract relevant fields
+		message := getString(entry, "MESSAGE")
+		unit := getString(entry, "_SYSTEMD_UNIT")
+		identifier := getString(entry, "SYSLOG_IDENTIFIER")
+		priority := getString(entry, "PRIORITY")
+
+		if filter.Allow(unit, identifier, priority, message) {
+			sc.sendEvent("systemd", message, map[string]string{
+				"unit":       unit,
+				"identifier": identifier,
+				"pid":        getString(entry, "_PID"),
+				"priority":   priority,
+				"severity":   sc.calculateSeverity(message, unit, priority),
+				"source":     "journalctl",
+			})
+		}
+
+		if c := getString(entry, "__CURSOR"); c != "" {
+			cursor = c
+			if time.Since(lastSaved) >= journalCursorEvery {
+				saveJournalCursor(cursorFile, cursor)
+				lastSaved = time.Now()
+			}
+		}
+	}
+
+	if read > 0 {
+		saveJournalCursor(cursorFile, cursor)
+	}
+	if readErr != nil {
+		cancel()
+	}
+	err = cmd.Wait()
+	if readErr != nil {
+		err = readErr
+	}
+
+	// journalctl reports "Failed to seek to cursor" for a cursor it no
+	// longer has
+	msg := strings.TrimSpace(stderr.String())
+	rejected := read == 0 && strings.Contains(strings.ToLower(msg), "cursor")
+	if err != nil && msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	return rejected, err
+}
+
+// readJournalLine reads one line of journalctl output. Lines longer than
+// journalMaxEntry are consumed and dropped, reported as oversized.
+func readJournalLine(r *bufio.Reader) (line []byte, oversized bool, err error) {
+	for {
+		var chunk []byte
+		chunk, err = r.ReadSlice('\n')
+		if !oversized {
+			if len(line)+len(chunk) > journalMaxEntry {
+				line, oversized = nil, true
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return line, oversized, err
+		}
+	}
+}
+
+// loadJournalCursor returns the saved journal cursor, if any
+func loadJournalCursor(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// saveJournalCursor atomically records the last forwarded journal cursor
+func saveJournalCursor(file, cursor string) {
+	if cursor == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		log.Printf("Failed to save journal cursor: %v", err)
+		return
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(cursor), 0600); err != nil {
+		log.Printf("Failed to save journal cursor: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		log.Printf("Failed to save journal cursor: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/kmod"
+)
+
+const (
+	procModulesPath = "/proc/modules"
+	procTaintedPath = "/proc/sys/kernel/tainted"
+	bootIDPath      = "/proc/sys/kernel/random/boot_id"
+	kmsgPath        = "/dev/kmsg"
+)
+
+// moduleTaints are the taint flags set by loading or unloading modules
+const moduleTaints = "PFRCOE"
+
+// kmodState is the module list and taint mask of the current boot
+type kmodState struct {
+	BootID  string        `json:"boot_id"`
+	Taint   uint64        `json:"taint"`
+	Modules []kmod.Module `json:"modules"`
+}
+
+// collectKernelModules reports kernel modules loaded and unloaded, including
+// since the agent last ran in the same boot, and changes of the kernel taint
+// mask. Module messages in the kernel log trigger an immediate rescan so
+// short-lived modules are still seen.
+func (sc *SecurityCollector) collectKernelModules() {
+	if !fileExists(procModulesPath) {
+		log.Printf("⚠️ %s not available, kernel module monitoring disabled", procModulesPath)
+		return
+	}
+	log.Printf("🧩 Starting kernel module monitoring...")
+
+	stateFile := filepath.Join(*stateDir, "kernel_modules.json")
+	bootID := readTrimmed(bootIDPath)
+	var previous kmodState
+	baseline := loadState(stateFile, &previous) && previous.BootID == bootID
+
+	rescan := make(chan struct{}, 1)
+	go sc.followKernelLog(rescan)
+
+	ticker := time.NewTicker(*kmodInterval)
+	defer ticker.Stop()
+
+	for {
+		if current, err := readKernelModules(bootID); err != nil {
+			log.Printf("Failed to read kernel modules: %v", err)
+		} else {
+			changed := !baseline
+			if baseline {
+				changed = sc.reportModuleChanges(previous.Modules, current.Modules)
+				if current.Taint != previous.Taint {
+					sc.sendTaintChange(previous.Taint, current.Taint)
+					changed = true
+				}
+			} else {
+				log.Printf("🧩 Kernel module baseline: %d modules, taint %d (%s)",
+					len(current.Modules), current.Taint, kmod.TaintString(current.Taint))
+			}
+			if changed {
+				saveState(stateFile, current)
+			}
+			previous, baseline = current, true
+		}
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-rescan:
+		}
+	}
+}
+
+// readKernelModules reads the loaded modules and the taint mask
+func readKernelModules(bootID string) (kmodState, error) {
+	f, err := os.Open(procModulesPath)
+	if err != nil {
+		return kmodState{}, err
+	}
+	defer f.Close()
+
+	modules, err := kmod.ParseModules(f)
+	if err != nil {
+		return kmodState{}, err
+	}
+	taint, _ := strconv.ParseUint(readTrimmed(procTaintedPath), 10, 64)
+	return kmodState{BootID: bootID, Taint: taint, Modules: modules}, nil
+}
+
+// reportModuleChanges sends an event per loaded or unloaded module and
+// reports whether anything changed
+func (sc *SecurityCollector) reportModuleChanges(before, after []kmod.Module) bool {
+	old := make(map[string]kmod.Module, len(before))
+	for _, m := range before {
+		old[m.Name] = m
+	}
+
+	var files map[string]string
+	changed := false
+	for _, m := range after {
+		if _, ok := old[m.Name]; ok {
+			delete(old, m.Name)
+			continue
+		}
+		changed = true
+		if files == nil {
+			files = moduleFiles()
+		}
+		sc.sendModuleLoaded(m, files[m.Name])
+	}
+	for _, m := range old {
+		changed = true
+		labels := moduleLabels(m)
+		labels["event_type"] = kmod.EventUnloaded
+		labels["severity"] = "info"
+		message := fmt.Sprintf("Kernel module unloaded: %s", m.Name)
+		log.Printf("🧩 %s", message)
+		sc.sendEvent(kmod.Stream, message, labels)
+	}
+	return changed
+}
+
+// sendModuleLoaded reports a newly loaded module with the signing status of
+// its file. A module whose file isn't in the running kernel's module tree was
+// loaded from somewhere else, which is how rootkits are usually inserted.
+func (sc *SecurityCollector) sendModuleLoaded(m kmod.Module, file string) {
+	labels := moduleLabels(m)
+	labels["event_type"] = kmod.EventLoaded
+
+	signature := kmod.Unknown
+	if file != "" {
+		labels["file"] = file
+		signature = moduleSignature(file)
+	}
+	labels["signature"] = signature
+
+	severity := "info"
+	switch {
+	case file == "":
+		severity = "critical"
+	case signature == kmod.Unsigned || m.Taint != "":
+		severity = "warning"
+	}
+	labels["severity"] = severity
+
+	message := fmt.Sprintf("Kernel module loaded: %s (%d bytes, signature %s)", m.Name, m.Size, signature)
+	if m.Taint != "" {
+		message += fmt.Sprintf(", taints %s", m.Taint)
+	}
+	if file == "" {
+		message += ", not from the installed module tree"
+	}
+	log.Printf("🧩 %s", message)
+	sc.sendEvent(kmod.Stream, message, labels)
+}
+
+// moduleLabels describes a module
+func moduleLabels(m kmod.Module) map[string]string {
+	labels := map[string]string{
+		"module": m.Name,
+		"size":   strconv.FormatInt(m.Size, 10),
+		"state":  m.State,
+	}
+	if m.Taint != "" {
+		labels["taint"] = m.Taint
+	}
+	if len(m.Deps) > 0 {
+		labels["deps"] = strings.Join(m.Deps, ",")
+	}
+	return labels
+}
+
+// moduleFiles maps module names to files of the running kernel's module tree
+func moduleFiles() map[string]string {
+	release := readTrimmed("/proc/sys/kernel/osrelease")
+	for _, dir := range []string{"/lib/modules", "/usr/lib/modules"} {
+		if files, err := kmod.ReadModulesDep(filepath.Join(dir, release, "modules.dep")); err == nil {
+			return files
+		}
+	}
+	return map[string]string{}
+}
+
+// moduleSignature checks a module file for an appended signature, asking
+// modinfo about compression formats the agent can't read itself
+func moduleSignature(file string) string {
+	if status := kmod.SignatureStatus(file); status != kmod.Unknown {
+		return status
+	}
+	out, err := exec.Command("modinfo", "-F", "sig_id", file).Output()
+	if err != nil {
+		return kmod.Unknown
+	}
+	if len(bytes.TrimSpace(out)) > 0 {
+		return kmod.Signed
+	}
+	return kmod.Unsigned
+}
+
+// sendTaintChange reports a change of the kernel taint mask; taints caused by
+// module loading are critical
+func (sc *SecurityCollector) sendTaintChange(before, after uint64) {
+	added := after &^ before
+	severity := "warning"
+	if strings.ContainsAny(kmod.TaintString(added), moduleTaints) {
+		severity = "critical"
+	}
+
+	labels := map[string]string{
+		"event_type":     kmod.EventTaintChanged,
+		"previous_taint": strconv.FormatUint(before, 10),
+		"taint":          strconv.FormatUint(after, 10),
+		"previous_flags": kmod.TaintString(before),
+		"flags":          kmod.TaintString(after),
+		"severity":       severity,
+	}
+	if added != 0 {
+		labels["added_flags"] = kmod.TaintString(added)
+		labels["added"] = strings.Join(kmod.TaintDescriptions(added), "; ")
+	}
+
+	message := fmt.Sprintf("Kernel taint changed from %d (%s) to %d (%s)",
+		before, kmod.TaintString(before), after, kmod.TaintString(after))
+	log.Printf("🧩 %s", message)
+	sc.sendEvent(kmod.Stream, message, labels)
+}
+
+// followKernelLog reads new kernel log records and reports those about
+// module loading, signalling rescan for each
+func (sc *SecurityCollector) followKernelLog(rescan chan<- struct{}) {
+	f, err := os.Open(kmsgPath)
+	if err != nil {
+		log.Printf("⚠️ Cannot read kernel log %s: %v", kmsgPath, err)
+		return
+	}
+	// Only records written from now on
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		log.Printf("⚠️ Cannot seek kernel log %s: %v", kmsgPath, err)
+		return
+	}
+	go func() {
+		<-sc.ctx.Done()
+		f.Close()
+	}()
+
+	buf := make([]byte, 8192)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			// EPIPE means records were overwritten before they were read
+			if errors.Is(err, syscall.EPIPE) {
+				continue
+			}
+			if sc.ctx.Err() == nil {
+				log.Printf("⚠️ Kernel log read failed: %v", err)
+			}
+			return
+		}
+
+		// Records are "priority,sequence,timestamp,flags;message\n" followed
+		// by " KEY=value" continuation lines
+		record, _, _ := strings.Cut(string(buf[:n]), "\n")
+		_, message, ok := strings.Cut(record, ";")
+		if !ok {
+			continue
+		}
+		name, ok := kmod.LogModule(message)
+		if !ok {
+			continue
+		}
+
+		labels := map[string]string{
+			"event_type": kmod.EventLog,
+			"severity":   "warning",
+		}
+		if name != "" {
+			labels["module"] = kmod.NormalizeName(name)
+		}
+		log.Printf("🧩 Kernel: %s", message)
+		sc.sendEvent(kmod.Stream, message, labels)
+
+		select {
+		case rescan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// readTrimmed returns a small file's content without surrounding whitespace
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
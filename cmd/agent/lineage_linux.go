@@ -0,0 +1,119 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/heuristics"
+)
+
+// lineageTTL is how long an exited process stays in the lineage cache, so
+// short-lived parents such as curl or sh still appear in later ancestries
+const lineageTTL = 10 * time.Minute
+
+// lineageCache remembers every process the agent has observed, keyed by PID
+// and checked against the process start time so reused PIDs aren't confused
+type lineageCache struct {
+	mu      sync.Mutex
+	entries map[int]*lineageEntry
+}
+
+type lineageEntry struct {
+	info   heuristics.Process
+	exited time.Time // zero while running
+}
+
+func newLineageCache() *lineageCache {
+	return &lineageCache{entries: make(map[int]*lineageEntry)}
+}
+
+// observe reads a running process from /proc and records it
+func (c *lineageCache) observe(pid int) (heuristics.Process, bool) {
+	p, ok := readProcessInfo(pid)
+	if !ok {
+		return heuristics.Process{}, false
+	}
+	c.mu.Lock()
+	c.entries[pid] = &lineageEntry{info: p}
+	c.mu.Unlock()
+	return p, true
+}
+
+// lookup returns a process from the cache, reading /proc for processes not
+// seen yet. While the PID is alive the cached entry must still describe it:
+// a different start time means the PID was reused, a different executable
+// that the process exec'd since, and either way it is observed afresh.
+func (c *lineageCache) lookup(pid int) (heuristics.Process, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[pid]
+	c.mu.Unlock()
+	if !ok {
+		return c.observe(pid)
+	}
+
+	current, alive := readProcessStat(pid)
+	if !alive {
+		return e.info, true
+	}
+	if current.Start != e.info.Start {
+		return c.observe(pid)
+	}
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil && exe != e.info.Exe {
+		if p, ok := c.observe(pid); ok {
+			return p, true
+		}
+	}
+	return e.info, true
+}
+
+// ancestry returns a process's parent, grandparent and so on up to init. A
+// parent that started after its child is a reused PID and ends the chain.
+func (c *lineageCache) ancestry(p heuristics.Process) []heuristics.Process {
+	var ancestors []heuristics.Process
+	child := p
+	for child.PPID > 0 && len(ancestors) < maxProcessDepth {
+		parent, ok := c.lookup(child.PPID)
+		if !ok || (parent.Start > child.Start && child.Start > 0) {
+			break
+		}
+		ancestors = append(ancestors, parent)
+		child = parent
+	}
+	return ancestors
+}
+
+// sweep marks processes missing from live as exited and forgets those that
+// exited more than lineageTTL ago
+func (c *lineageCache) sweep(live map[int]bool) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pid, e := range c.entries {
+		switch {
+		case live[pid]:
+		case e.exited.IsZero():
+			e.exited = now
+		case now.Sub(e.exited) > lineageTTL:
+			delete(c.entries, pid)
+		}
+	}
+}
+
+// addAncestry attaches a process's ancestry chain to event labels
+func (sc *SecurityCollector) addAncestry(labels map[string]string, pid int) {
+	p, ok := sc.lineage.lookup(pid)
+	if !ok {
+		return
+	}
+	ancestors := sc.lineage.ancestry(p)
+	labels["ppid"] = strconv.Itoa(p.PPID)
+	labels["process_tree"] = formatProcessTree(p, ancestors)
+	if chain := encodeAncestry(p, ancestors); chain != "" {
+		labels["ancestry"] = chain
+	}
+}
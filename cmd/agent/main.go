@@ -5,18 +5,20 @@ import (
 	"crypto/tls"
 	"flag"
 	"log"
-	"net"
 	"os"
 	"os/signal"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	pb "github.com/mulutu/security-manager/internal/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 var (
@@ -24,7 +26,39 @@ var (
 	ingestURL = flag.String("ingest", getEnvOrDefault("SM_INGEST_URL", "178.79.139.38:9002"), "gRPC ingest host:port")
 	filePath  = flag.String("file", getEnvOrDefault("SM_FILE_PATH", ""), "file to tail")
 	useTLS    = flag.Bool("tls", getEnvOrDefault("SM_USE_TLS", "false") == "true", "use TLS for gRPC connection")
-	version   = "1.0.7"
+	hostGroup = flag.String("host-group", getEnvOrDefault("SM_HOST_GROUP", ""), "host group used to select server-managed configuration")
+	stateDir  = flag.String("state-dir", getEnvOrDefault("SM_STATE_DIR", "/var/lib/security-manager"), "directory for persistent agent state")
+	fimRescan = flag.Duration("fim-rescan", getEnvDurationOrDefault("SM_FIM_RESCAN", 5*time.Minute), "interval between full file integrity rescans")
+	diffPaths = flag.String("diff-paths", getEnvOrDefault("SM_DIFF_PATHS",
+		"/etc/ssh/sshd_config,/etc/ssh/sshd_config.d,/etc/sudoers,/etc/sudoers.d,/etc/pam.d,/etc/hosts,/etc/crontab"),
+		"comma-separated config files or directories whose changes include a content diff")
+	journalUnits        = flag.String("journal-units", getEnvOrDefault("SM_JOURNAL_UNITS", ""), "comma-separated unit globs to forward from the journal (default all)")
+	journalExcludeUnits = flag.String("journal-exclude-units", getEnvOrDefault("SM_JOURNAL_EXCLUDE_UNITS", ""), "comma-separated unit globs to drop from the journal")
+	journalIdents       = flag.String("journal-identifiers", getEnvOrDefault("SM_JOURNAL_IDENTIFIERS", ""), "comma-separated syslog identifiers to forward from the journal (default all)")
+	journalExcludeIdent = flag.String("journal-exclude-identifiers", getEnvOrDefault("SM_JOURNAL_EXCLUDE_IDENTIFIERS", ""), "comma-separated syslog identifiers to drop from the journal")
+	journalPriority     = flag.Int("journal-priority", int(getEnvInt64OrDefault("SM_JOURNAL_PRIORITY", 6)), "forward journal entries at or above this priority (0=emerg … 7=debug)")
+	journalMatch        = flag.String("journal-match", getEnvOrDefault("SM_JOURNAL_MATCH", ""), "only forward journal messages matching this regex")
+	journalExclude      = flag.String("journal-exclude", getEnvOrDefault("SM_JOURNAL_EXCLUDE", ""), "drop journal messages matching this regex")
+	metricsInterval     = flag.Duration("metrics-interval", getEnvDurationOrDefault("SM_METRICS_INTERVAL", 30*time.Second), "interval between system metric samples")
+	forecastHorizon     = flag.Duration("forecast-horizon", getEnvDurationOrDefault("SM_FORECAST_HORIZON", 24*time.Hour), "raise predictive alerts when disk, inodes or memory are forecast to run out within this time")
+	forecastWindow      = flag.Duration("forecast-window", getEnvDurationOrDefault("SM_FORECAST_WINDOW", 6*time.Hour), "history used to fit capacity trends")
+	inventoryInterval   = flag.Duration("inventory-interval", getEnvDurationOrDefault("SM_INVENTORY_INTERVAL", time.Hour), "interval between host inventory snapshots")
+	packageInterval     = flag.Duration("package-interval", getEnvDurationOrDefault("SM_PACKAGE_INTERVAL", time.Minute), "interval between checks of the package database for changes")
+	accountsInterval    = flag.Duration("accounts-interval", getEnvDurationOrDefault("SM_ACCOUNTS_INTERVAL", 5*time.Second), "interval between checks of passwd, shadow, group and sudoers for changes")
+	sshKeysInterval     = flag.Duration("ssh-keys-interval", getEnvDurationOrDefault("SM_SSH_KEYS_INTERVAL", 10*time.Second), "interval between checks of users' authorized_keys files for changes")
+	persistenceInterval = flag.Duration("persistence-interval", getEnvDurationOrDefault("SM_PERSISTENCE_INTERVAL", time.Minute), "interval between scans of cron, systemd, rc, shell profile and preload persistence locations")
+	kmodInterval        = flag.Duration("kmod-interval", getEnvDurationOrDefault("SM_KMOD_INTERVAL", 5*time.Second), "interval between checks of loaded kernel modules and the kernel taint mask")
+	integrityInterval   = flag.Duration("integrity-interval", getEnvDurationOrDefault("SM_INTEGRITY_INTERVAL", 5*time.Minute), "interval between rootkit and tampering indicator checks")
+	processScanInterval = flag.Duration("process-scan-interval", getEnvDurationOrDefault("SM_PROCESS_SCAN_INTERVAL", 2*time.Second), "interval between runs of the reverse shell and suspicious process heuristics")
+	minerInterval       = flag.Duration("miner-interval", getEnvDurationOrDefault("SM_MINER_INTERVAL", 10*time.Second), "interval between per-process CPU samples for cryptominer detection")
+	minerIOCFile        = flag.String("miner-iocs", getEnvOrDefault("SM_MINER_IOCS", ""), "JSON file of extra mining pool ports and domains, miner names, hashes and command line patterns")
+	fsAuditInterval     = flag.Duration("fs-audit-interval", getEnvDurationOrDefault("SM_FS_AUDIT_INTERVAL", 6*time.Hour), "interval between SUID/SGID and world-writable file audits")
+	fsAuditExclude      = flag.String("fs-audit-exclude", getEnvOrDefault("SM_FS_AUDIT_EXCLUDE", "/var/lib/docker,/var/lib/containerd,/var/lib/kubelet/pods,/snap"), "comma-separated directories or globs skipped by the filesystem audit")
+	fsAuditRate         = flag.Int("fs-audit-rate", int(getEnvInt64OrDefault("SM_FS_AUDIT_RATE", 2000)), "most files per second examined by the filesystem audit, to limit disk IO (0 = unlimited)")
+	sessionsInterval    = flag.Duration("sessions-interval", getEnvDurationOrDefault("SM_SESSIONS_INTERVAL", 10*time.Second), "how often utmp, wtmp, btmp and lastlog are checked for new sessions and tampering")
+	auditLog            = flag.String("audit-log", getEnvOrDefault("SM_AUDIT_LOG", "/var/log/audit/audit.log"), "auditd log to assemble into audit events")
+	diffMaxSize         = flag.Int64("diff-max-size", getEnvInt64OrDefault("SM_DIFF_MAX_SIZE", 64*1024), "largest config file (bytes) kept for content diffs")
+	version             = "1.0.7"
 )
 
 func main() {
@@ -34,21 +68,16 @@ func main() {
 		log.Fatalln("missing -token flag or SM_TOKEN environment variable")
 	}
 
-	// Extract org ID and host ID from token (format: sm_orgid_timestamp_hostid)
-	orgID, hostID := extractFromToken(*token)
+	// Extract org ID from token (format: sm_orgid_timestamp_hostid)
+	orgID, _ := extractFromToken(*token)
 	if orgID == "" {
 		log.Fatalln("invalid token format - cannot extract organization ID")
 	}
-	if hostID == "" {
-		// Fallback to hostname if not in token
-		if h, _ := os.Hostname(); h != "" {
-			hostID = h
-		} else {
-			log.Fatalln("could not determine hostname from token or system")
-		}
-	}
 
-	log.Printf("🔧 Extracted from token: org=%s, host=%s", orgID, hostID)
+	// The persistent agent ID identifies this host in every request and event
+	hostID := loadAgentID(*stateDir)
+
+	log.Printf("🔧 Agent identity: org=%s, agent=%s", orgID, hostID)
 
 	// Collect system information for auto-registration
 	systemInfo := collectSystemInfo()
@@ -73,8 +102,12 @@ func main() {
 
 	client := pb.NewAgentIngestClient(conn)
 
-	// Authenticate with auto-registration
-	authResp, err := client.Authenticate(context.Background(), &pb.AuthRequest{
+	// Authenticate with auto-registration; response headers carry server config
+	authCtx := context.Background()
+	if *hostGroup != "" {
+		authCtx = metadata.AppendToOutgoingContext(authCtx, "sm-host-group", *hostGroup)
+	}
+	authResp, err := client.Authenticate(authCtx, &pb.AuthRequest{
 		OrgId:        orgID,
 		Token:        *token,
 		AgentVersion: version,
@@ -84,7 +117,8 @@ func main() {
 		OsType:       systemInfo.osType,
 		OsVersion:    systemInfo.osVersion,
 		Capabilities: systemInfo.capabilities,
-	})
+		AgentId:      hostID,
+	}, grpc.Header(&serverConfig))
 	if err != nil {
 		log.Fatalf("authentication failed: %v", err)
 	}
@@ -97,8 +131,9 @@ func main() {
 		log.Printf("🎯 Server auto-registered with ID: %s", authResp.AgentId)
 	}
 
-	// Start event streaming
-	stream, err := client.StreamEvents(context.Background())
+	// Start event streaming; the server binds the stream to this identity
+	streamCtx := metadata.AppendToOutgoingContext(context.Background(), "sm-token", *token, "sm-agent-id", hostID)
+	stream, err := client.StreamEvents(streamCtx)
 	if err != nil {
 		log.Fatalf("stream: %v", err)
 	}
@@ -140,8 +175,8 @@ func collectSystemInfo() SystemInfo {
 		info.hostname = "unknown"
 	}
 
-	// Get primary IP address
-	info.ipAddress = getOutboundIP()
+	// Get primary IP address from the local interfaces and routes
+	info.ipAddress = primaryIP()
 
 	// Get OS information
 	info.osType = runtime.GOOS
@@ -162,18 +197,6 @@ func collectSystemInfo() SystemInfo {
 	return info
 }
 
-// getOutboundIP gets the preferred outbound IP address
-func getOutboundIP() string {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		return "unknown"
-	}
-	defer conn.Close()
-
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	return localAddr.IP.String()
-}
-
 // getLinuxVersion attempts to get Linux distribution version
 func getLinuxVersion() string {
 	// Try to read /etc/os-release
@@ -223,3 +246,34 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt64OrDefault(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+		log.Printf("invalid integer for %s: %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("invalid duration for %s: %q, using %v", key, value, defaultValue)
+	}
+	return defaultValue
+}
@@ -0,0 +1,409 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/metrics"
+	"golang.org/x/sys/unix"
+)
+
+// skipFSTypes are device-backed filesystems that never fill up meaningfully
+var skipFSTypes = map[string]bool{"squashfs": true, "iso9660": true, "udf": true}
+
+// cpuTimes holds cumulative jiffies from one /proc/stat cpu line
+type cpuTimes struct {
+	user, nice, system, idle, iowait, irq, softirq, steal uint64
+}
+
+func (t cpuTimes) total() uint64 {
+	return t.user + t.nice + t.system + t.idle + t.iowait + t.irq + t.softirq + t.steal
+}
+
+// diskCounters holds cumulative counters from one /proc/diskstats line
+type diskCounters struct {
+	reads, sectorsRead, writes, sectorsWritten, ioMillis uint64
+}
+
+// netCounters holds cumulative counters from one /proc/net/dev line
+type netCounters struct {
+	rxBytes, rxPackets, rxErrors, rxDrops uint64
+	txBytes, txPackets, txErrors, txDrops uint64
+}
+
+// MetricsReader samples /proc and turns cumulative counters into rates
+type MetricsReader struct {
+	last  time.Time
+	cpu   map[string]cpuTimes
+	disks map[string]diskCounters
+	nets  map[string]netCounters
+}
+
+// NewMetricsReader creates a reader; its first sample has no rates
+func NewMetricsReader() *MetricsReader {
+	return &MetricsReader{}
+}
+
+// Sample reads the current metrics
+func (r *MetricsReader) Sample() *metrics.Sample {
+	now := time.Now()
+	s := &metrics.Sample{Time: now.UTC()}
+	if !r.last.IsZero() {
+		s.IntervalSeconds = now.Sub(r.last).Seconds()
+	}
+
+	cpu := readCPUTimes()
+	disks := readDiskCounters()
+	nets := readNetCounters()
+
+	if r.cpu != nil {
+		for name, cur := range cpu {
+			prev, ok := r.cpu[name]
+			if !ok {
+				continue
+			}
+			stats := cpuPercent(name, prev, cur)
+			if name == "cpu" {
+				s.CPU = stats
+			} else {
+				s.Cores = append(s.Cores, stats)
+			}
+		}
+		sortByName(s.Cores, func(c metrics.CPUStats) string { return c.Name })
+	}
+
+	if secs := s.IntervalSeconds; secs > 0 {
+		for dev, cur := range disks {
+			prev, ok := r.disks[dev]
+			if !ok {
+				continue
+			}
+			s.Disks = append(s.Disks, metrics.DiskIO{
+				Device:           dev,
+				ReadsPerSec:      rate(prev.reads, cur.reads, secs),
+				WritesPerSec:     rate(prev.writes, cur.writes, secs),
+				ReadBytesPerSec:  rate(prev.sectorsRead, cur.sectorsRead, secs) * 512,
+				WriteBytesPerSec: rate(prev.sectorsWritten, cur.sectorsWritten, secs) * 512,
+				UtilPercent:      min(100, rate(prev.ioMillis, cur.ioMillis, secs)/10),
+			})
+		}
+		sortByName(s.Disks, func(d metrics.DiskIO) string { return d.Device })
+
+		for iface, cur := range nets {
+			prev, ok := r.nets[iface]
+			if !ok {
+				continue
+			}
+			s.Network = append(s.Network, metrics.NetIO{
+				Interface:       iface,
+				RxBytesPerSec:   rate(prev.rxBytes, cur.rxBytes, secs),
+				TxBytesPerSec:   rate(prev.txBytes, cur.txBytes, secs),
+				RxPacketsPerSec: rate(prev.rxPackets, cur.rxPackets, secs),
+				TxPacketsPerSec: rate(prev.txPackets, cur.txPackets, secs),
+				RxErrorsPerSec:  rate(prev.rxErrors, cur.rxErrors, secs),
+				TxErrorsPerSec:  rate(prev.txErrors, cur.txErrors, secs),
+				RxDropsPerSec:   rate(prev.rxDrops, cur.rxDrops, secs),
+				TxDropsPerSec:   rate(prev.txDrops, cur.txDrops, secs),
+			})
+		}
+		sortByName(s.Network, func(n metrics.NetIO) string { return n.Interface })
+	}
+
+	s.Memory = readMemInfo()
+	s.Load = readLoadAvg()
+	s.Filesystems = readFilesystems()
+
+	r.last, r.cpu, r.disks, r.nets = now, cpu, disks, nets
+	return s
+}
+
+// rate returns the per-second increase of a counter, treating resets as zero
+func rate(prev, cur uint64, secs float64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / secs
+}
+
+// cpuPercent converts two /proc/stat readings into percentages
+func cpuPercent(name string, prev, cur cpuTimes) metrics.CPUStats {
+	stats := metrics.CPUStats{Name: name}
+	total := float64(cur.total()) - float64(prev.total())
+	if total <= 0 {
+		return stats
+	}
+	pct := func(a, b uint64) float64 {
+		if b < a {
+			return 0
+		}
+		return float64(b-a) / total * 100
+	}
+	stats.User = pct(prev.user+prev.nice, cur.user+cur.nice)
+	stats.System = pct(prev.system+prev.irq+prev.softirq, cur.system+cur.irq+cur.softirq)
+	stats.IOWait = pct(prev.iowait, cur.iowait)
+	stats.Steal = pct(prev.steal, cur.steal)
+	stats.Idle = pct(prev.idle, cur.idle)
+	stats.Usage = max(0, 100-stats.Idle-stats.IOWait)
+	return stats
+}
+
+// readCPUTimes parses the cpu lines of /proc/stat
+func readCPUTimes() map[string]cpuTimes {
+	times := make(map[string]cpuTimes)
+	forEachLine("/proc/stat", func(fields []string) {
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "cpu") {
+			return
+		}
+		v := parseUints(fields[1:9])
+		times[fields[0]] = cpuTimes{
+			user: v[0], nice: v[1], system: v[2], idle: v[3],
+			iowait: v[4], irq: v[5], softirq: v[6], steal: v[7],
+		}
+	})
+	return times
+}
+
+// readDiskCounters parses /proc/diskstats for whole block devices
+func readDiskCounters() map[string]diskCounters {
+	disks := make(map[string]diskCounters)
+	forEachLine("/proc/diskstats", func(fields []string) {
+		if len(fields) < 14 {
+			return
+		}
+		dev := fields[2]
+		if strings.HasPrefix(dev, "loop") || strings.HasPrefix(dev, "ram") {
+			return
+		}
+		// Partitions have no entry directly under /sys/block
+		if _, err := os.Stat(filepath.Join("/sys/block", dev)); err != nil {
+			return
+		}
+		v := parseUints(fields[3:13])
+		disks[dev] = diskCounters{
+			reads:          v[0],
+			sectorsRead:    v[2],
+			writes:         v[4],
+			sectorsWritten: v[6],
+			ioMillis:       v[9],
+		}
+	})
+	return disks
+}
+
+// readNetCounters parses /proc/net/dev, skipping loopback
+func readNetCounters() map[string]netCounters {
+	nets := make(map[string]netCounters)
+	forEachLine("/proc/net/dev", func(fields []string) {
+		if len(fields) < 17 || !strings.HasSuffix(fields[0], ":") {
+			return
+		}
+		iface := strings.TrimSuffix(fields[0], ":")
+		if iface == "lo" {
+			return
+		}
+		v := parseUints(fields[1:17])
+		nets[iface] = netCounters{
+			rxBytes: v[0], rxPackets: v[1], rxErrors: v[2], rxDrops: v[3],
+			txBytes: v[8], txPackets: v[9], txErrors: v[10], txDrops: v[11],
+		}
+	})
+	return nets
+}
+
+// readMemInfo parses /proc/meminfo
+func readMemInfo() metrics.MemoryStats {
+	info := make(map[string]uint64)
+	forEachLine("/proc/meminfo", func(fields []string) {
+		if len(fields) >= 2 {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			info[strings.TrimSuffix(fields[0], ":")] = kb * 1024
+		}
+	})
+
+	m := metrics.MemoryStats{
+		TotalBytes:     info["MemTotal"],
+		AvailableBytes: info["MemAvailable"],
+		FreeBytes:      info["MemFree"],
+		BuffersBytes:   info["Buffers"],
+		CachedBytes:    info["Cached"] + info["SReclaimable"],
+		SwapTotalBytes: info["SwapTotal"],
+		SwapFreeBytes:  info["SwapFree"],
+	}
+	if _, ok := info["MemAvailable"]; !ok {
+		// Kernels before 3.14 have no MemAvailable
+		m.AvailableBytes = m.FreeBytes + m.BuffersBytes + m.CachedBytes
+	}
+	if m.TotalBytes > 0 {
+		m.UsedBytes = m.TotalBytes - min(m.AvailableBytes, m.TotalBytes)
+		m.UsagePercent = float64(m.UsedBytes) / float64(m.TotalBytes) * 100
+	}
+	if m.SwapTotalBytes > 0 {
+		m.SwapUsagePercent = float64(m.SwapTotalBytes-min(m.SwapFreeBytes, m.SwapTotalBytes)) / float64(m.SwapTotalBytes) * 100
+	}
+	return m
+}
+
+// readLoadAvg parses /proc/loadavg
+func readLoadAvg() metrics.LoadStats {
+	var load metrics.LoadStats
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 {
+		return load
+	}
+	load.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	load.Load5, _ = strconv.ParseFloat(fields[1], 64)
+	load.Load15, _ = strconv.ParseFloat(fields[2], 64)
+	if running, total, ok := strings.Cut(fields[3], "/"); ok {
+		load.Running, _ = strconv.Atoi(running)
+		load.Processes, _ = strconv.Atoi(total)
+	}
+	return load
+}
+
+// readFilesystems runs statfs on every mount backed by a real device
+func readFilesystems() []metrics.Filesystem {
+	nodev := make(map[string]bool)
+	forEachLine("/proc/filesystems", func(fields []string) {
+		if len(fields) == 2 && fields[0] == "nodev" {
+			nodev[fields[1]] = true
+		}
+	})
+
+	var filesystems []metrics.Filesystem
+	seen := make(map[string]bool)
+	forEachLine("/proc/self/mounts", func(fields []string) {
+		if len(fields) < 3 {
+			return
+		}
+		device, mount, fstype := fields[0], unescapeMount(fields[1]), fields[2]
+		if nodev[fstype] || skipFSTypes[fstype] || seen[device] {
+			return
+		}
+
+		var st unix.Statfs_t
+		if err := unix.Statfs(mount, &st); err != nil || st.Blocks == 0 {
+			return
+		}
+		seen[device] = true
+
+		bsize := uint64(st.Bsize)
+		fs := metrics.Filesystem{
+			Mount:          mount,
+			Device:         device,
+			Type:           fstype,
+			TotalBytes:     st.Blocks * bsize,
+			AvailableBytes: st.Bavail * bsize,
+			UsedBytes:      (st.Blocks - st.Bfree) * bsize,
+			Inodes:         st.Files,
+			InodesFree:     st.Ffree,
+		}
+		// Match df: usage relative to space available to unprivileged users
+		if usable := fs.UsedBytes + fs.AvailableBytes; usable > 0 {
+			fs.UsagePercent = float64(fs.UsedBytes) / float64(usable) * 100
+		}
+		if st.Files > 0 {
+			fs.InodeUsagePercent = float64(st.Files-st.Ffree) / float64(st.Files) * 100
+		}
+		filesystems = append(filesystems, fs)
+	})
+	return filesystems
+}
+
+// readProcessMemory returns the resident memory of every process
+func readProcessMemory() []ProcessMemory {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	var procs []ProcessMemory
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// comm may contain spaces and parentheses; fields follow the last ')'
+		stat := string(data)
+		lparen, rparen := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+		if lparen < 0 || rparen < lparen {
+			continue
+		}
+		fields := strings.Fields(stat[rparen+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		startTime, _ := strconv.ParseUint(fields[19], 10, 64)
+		rss, _ := strconv.ParseUint(fields[21], 10, 64)
+		procs = append(procs, ProcessMemory{
+			PID:       pid,
+			Name:      stat[lparen+1 : rparen],
+			StartTime: startTime,
+			RSS:       rss * pageSize,
+		})
+	}
+	return procs
+}
+
+// unescapeMount decodes the octal escapes /proc/self/mounts uses for spaces
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// forEachLine calls fn with the fields of every line of a /proc file
+func forEachLine(path string, fn func(fields []string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fn(strings.Fields(scanner.Text()))
+	}
+}
+
+// parseUints parses decimal counters, treating malformed values as zero
+func parseUints(fields []string) []uint64 {
+	values := make([]uint64, len(fields))
+	for i, f := range fields {
+		values[i], _ = strconv.ParseUint(f, 10, 64)
+	}
+	return values
+}
+
+// sortByName orders samples by their name for stable output
+func sortByName[T any](items []T, name func(T) string) {
+	sort.Slice(items, func(i, j int) bool { return name(items[i]) < name(items[j]) })
+}
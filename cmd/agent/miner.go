@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinerIOCs are the indicators the cryptominer detector looks for. The
+// server may replace the defaults with the "miners" config section, and a
+// local file given with -miner-iocs adds to them.
+type MinerIOCs struct {
+	PoolPorts       []int        `json:"pool_ports"`
+	PoolDomains     []string     `json:"pool_domains"`
+	Names           []string     `json:"names"`
+	Hashes          []string     `json:"sha256"`
+	CmdlinePatterns []string     `json:"cmdline_patterns"`
+	CPUPercent      float64      `json:"cpu_percent,omitempty"` // of one core
+	CPUFor          jsonDuration `json:"cpu_for,omitempty"`
+}
+
+// defaultMinerIOCs cover the common Monero and GPU miners and public pools
+func defaultMinerIOCs() MinerIOCs {
+	return MinerIOCs{
+		PoolPorts: []int{3333, 4444, 5555, 6666, 7777, 8888, 9999, 14433, 14444, 45560, 45700},
+		PoolDomains: []string{
+			"supportxmr.com", "pool.minexmr.com", "xmrpool.eu", "moneroocean.stream",
+			"nanopool.org", "2miners.com", "f2pool.com", "hashvault.pro", "c3pool.com",
+			"herominers.com", "minergate.com", "unmineable.com", "nicehash.com", "ethermine.org",
+		},
+		Names: []string{
+			"xmrig", "xmrig-notls", "xmr-stak", "xmr-stak-rx", "minerd", "cpuminer", "cpuminer-multi",
+			"ccminer", "ethminer", "nbminer", "t-rex", "lolminer", "phoenixminer", "teamredminer",
+			"kdevtmpfsi", "kinsing", "sysupdate", "networkservice",
+		},
+		CmdlinePatterns: []string{
+			"stratum+tcp://", "stratum+ssl://", "stratum2+tcp://", "stratum1+tcp://",
+			"--donate-level", "--coin=monero", "--algo=rx/0", "-a rx/0", "--randomx", "cryptonight",
+		},
+		CPUPercent: 80,
+		CPUFor:     jsonDuration(5 * time.Minute),
+	}
+}
+
+// minerIOCs returns the server-provided or default indicators plus those in
+// the local IOC file
+func minerIOCs() MinerIOCs {
+	iocs := defaultMinerIOCs()
+	if serverSection("miners", &iocs) {
+		log.Printf("⛏️ Using server-provided cryptominer indicators")
+	}
+	if *minerIOCFile == "" {
+		return iocs
+	}
+
+	data, err := os.ReadFile(*minerIOCFile)
+	if err != nil {
+		log.Printf("⚠️ Cannot read cryptominer IOC file %s: %v", *minerIOCFile, err)
+		return iocs
+	}
+	var local MinerIOCs
+	if err := json.Unmarshal(data, &local); err != nil {
+		log.Printf("⚠️ Ignoring invalid cryptominer IOC file %s: %v", *minerIOCFile, err)
+		return iocs
+	}
+	iocs.PoolPorts = append(iocs.PoolPorts, local.PoolPorts...)
+	iocs.PoolDomains = append(iocs.PoolDomains, local.PoolDomains...)
+	iocs.Names = append(iocs.Names, local.Names...)
+	iocs.Hashes = append(iocs.Hashes, local.Hashes...)
+	iocs.CmdlinePatterns = append(iocs.CmdlinePatterns, local.CmdlinePatterns...)
+	if local.CPUPercent > 0 {
+		iocs.CPUPercent = local.CPUPercent
+	}
+	if local.CPUFor > 0 {
+		iocs.CPUFor = local.CPUFor
+	}
+	return iocs
+}
+
+// minerSignal is one indicator a process matched; weights reflect how
+// specific the indicator is to mining
+type minerSignal struct {
+	Kind   string
+	Weight int
+	Detail string
+}
+
+// minerEvidence is what is known about one process
+type minerEvidence struct {
+	Name       string
+	Exe        string
+	Cmdline    string
+	Hash       string
+	CPUPercent float64
+	HighCPUFor time.Duration
+	// Remotes are the remote addresses of the process's TCP connections
+	Remotes []string
+	// PoolHosts maps resolved pool IPs to their domain
+	PoolHosts map[string]string
+}
+
+// minerSignals returns the indicators a process matches
+func (iocs MinerIOCs) minerSignals(e minerEvidence) []minerSignal {
+	var signals []minerSignal
+
+	if e.HighCPUFor >= time.Duration(iocs.CPUFor) && e.CPUPercent >= iocs.CPUPercent {
+		signals = append(signals, minerSignal{"cpu", 1, fmt.Sprintf("%.0f%% CPU for %v", e.CPUPercent, e.HighCPUFor.Round(time.Second))})
+	}
+
+	base := filepath.Base(strings.TrimSuffix(e.Exe, " (deleted)"))
+	for _, name := range iocs.Names {
+		if strings.EqualFold(name, e.Name) || strings.EqualFold(name, base) {
+			signals = append(signals, minerSignal{"name", 2, "known miner name " + name})
+			break
+		}
+	}
+
+	if e.Hash != "" && slices.ContainsFunc(iocs.Hashes, func(h string) bool { return strings.EqualFold(h, e.Hash) }) {
+		signals = append(signals, minerSignal{"hash", 3, "known miner binary " + e.Hash})
+	}
+
+	cmdline := strings.ToLower(e.Cmdline)
+	for _, pattern := range iocs.CmdlinePatterns {
+		if strings.Contains(cmdline, strings.ToLower(pattern)) {
+			signals = append(signals, minerSignal{"cmdline", 2, "command line contains " + pattern})
+			break
+		}
+	}
+	for _, domain := range iocs.PoolDomains {
+		if strings.Contains(cmdline, strings.ToLower(domain)) {
+			signals = append(signals, minerSignal{"pool_domain", 2, "command line names pool " + domain})
+			break
+		}
+	}
+
+	// A connection to a known pool outweighs one to a typical pool port
+	var poolPort string
+	for _, remote := range e.Remotes {
+		host, port := splitHostPort(remote)
+		if domain, ok := e.PoolHosts[host]; ok {
+			signals = append(signals, minerSignal{"pool_connection", 2, fmt.Sprintf("connected to pool %s (%s)", domain, remote)})
+			return signals
+		}
+		if poolPort == "" && slices.Contains(iocs.PoolPorts, port) {
+			poolPort = remote
+		}
+	}
+	if poolPort != "" {
+		signals = append(signals, minerSignal{"pool_port", 1, "connected to mining pool port " + poolPort})
+	}
+	return signals
+}
+
+// minerVerdict decides whether signals add up to a miner: a single strong
+// indicator such as a known hash, or several independent ones
+func minerVerdict(signals []minerSignal) (detected bool, confidence string) {
+	score := 0
+	for _, s := range signals {
+		score += s.Weight
+	}
+	switch {
+	case score >= 4 || (score >= 3 && len(signals) >= 2):
+		return true, "high"
+	case score >= 3:
+		return true, "medium"
+	}
+	return false, ""
+}
+
+// splitHostPort splits "1.2.3.4:3333" or "[::1]:3333"
+func splitHostPort(addr string) (string, int) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
@@ -0,0 +1,313 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/heuristics"
+)
+
+const (
+	// userHZ is the clock tick rate of /proc/<pid>/stat times, fixed at 100
+	// by the kernel ABI
+	userHZ = 100
+	// poolResolveEvery is how often pool domains are resolved to addresses
+	poolResolveEvery = 30 * time.Minute
+)
+
+// procCPU is a process's CPU usage between two scans
+type procCPU struct {
+	start    uint64
+	ticks    uint64
+	at       time.Time
+	percent  float64
+	highFrom time.Time // zero unless above the threshold
+}
+
+// exeHash caches an executable's hash by size and modification time
+type exeHash struct {
+	size  int64
+	mtime int64
+	hash  string
+}
+
+// minerDetector holds the state of the cryptominer detector between scans
+type minerDetector struct {
+	iocs       MinerIOCs
+	cpu        map[int]*procCPU
+	hashes     map[string]exeHash
+	poolHosts  map[string]string
+	resolvedAt time.Time
+	reported   map[int]uint64 // pid -> start time of processes reported
+}
+
+// collectCryptominers correlates sustained per-process CPU, mining pool
+// connections, known miner names and hashes and stratum command lines into
+// one cryptominer event per process
+func (sc *SecurityCollector) collectCryptominers() {
+	log.Printf("⛏️ Starting cryptominer detection...")
+
+	d := &minerDetector{
+		iocs:      minerIOCs(),
+		cpu:       make(map[int]*procCPU),
+		hashes:    make(map[string]exeHash),
+		poolHosts: make(map[string]string),
+		reported:  make(map[int]uint64),
+	}
+
+	ticker := time.NewTicker(*minerInterval)
+	defer ticker.Stop()
+
+	for {
+		if time.Since(d.resolvedAt) > poolResolveEvery {
+			d.resolvePools(sc.ctx)
+		}
+		d.scan(sc)
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolvePools resolves the pool domains so connections to them can be
+// recognised by address
+func (d *minerDetector) resolvePools(ctx context.Context) {
+	hosts := make(map[string]string)
+	for _, domain := range d.iocs.PoolDomains {
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		addrs, err := net.DefaultResolver.LookupHost(lookupCtx, domain)
+		cancel()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			hosts[addr] = domain
+		}
+	}
+	d.poolHosts = hosts
+	d.resolvedAt = time.Now()
+}
+
+// scan samples every process and reports new miners
+func (d *minerDetector) scan(sc *SecurityCollector) {
+	now := time.Now()
+	live := listProcPids()
+	var sockets map[uint64]string
+	self := os.Getpid()
+
+	for pid := range live {
+		if pid == self {
+			continue
+		}
+		start, ticks, ok := readProcCPU(pid)
+		if !ok {
+			continue
+		}
+		usage := d.sampleCPU(pid, start, ticks, now)
+		if d.reported[pid] == start {
+			continue
+		}
+
+		p, ok := sc.lineage.lookup(pid)
+		if !ok || p.Start != start {
+			if p, ok = sc.lineage.observe(pid); !ok {
+				continue
+			}
+		}
+		e := minerEvidence{
+			Name:       p.Name,
+			Exe:        p.Exe,
+			Cmdline:    strings.Join(p.Cmdline, " "),
+			CPUPercent: usage.percent,
+			PoolHosts:  d.poolHosts,
+		}
+		if !usage.highFrom.IsZero() {
+			e.HighCPUFor = now.Sub(usage.highFrom)
+		}
+
+		// Cheap indicators first; sockets and hashes only for candidates
+		signals := d.iocs.minerSignals(e)
+		if len(signals) == 0 && usage.percent < d.iocs.CPUPercent {
+			continue
+		}
+		if sockets == nil {
+			sockets = inetSocketInodes()
+		}
+		e.Remotes = processRemotes(pid, sockets)
+		e.Hash = d.hashExe(p.Exe)
+		signals = d.iocs.minerSignals(e)
+
+		if detected, confidence := minerVerdict(signals); detected {
+			d.reported[pid] = start
+			sc.sendMinerEvent(p, e, signals, confidence)
+		}
+	}
+
+	for pid := range d.cpu {
+		if !live[pid] {
+			delete(d.cpu, pid)
+		}
+	}
+	for pid := range d.reported {
+		if !live[pid] {
+			delete(d.reported, pid)
+		}
+	}
+	sc.activeMiners.Store(int32(len(d.reported)))
+}
+
+// sampleCPU updates a process's CPU usage and how long it has been high
+func (d *minerDetector) sampleCPU(pid int, start, ticks uint64, now time.Time) *procCPU {
+	prev, ok := d.cpu[pid]
+	if !ok || prev.start != start {
+		d.cpu[pid] = &procCPU{start: start, ticks: ticks, at: now}
+		return d.cpu[pid]
+	}
+	if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+		prev.percent = float64(ticks-prev.ticks) / userHZ / elapsed * 100
+	}
+	prev.ticks, prev.at = ticks, now
+	switch {
+	case prev.percent < d.iocs.CPUPercent:
+		prev.highFrom = time.Time{}
+	case prev.highFrom.IsZero():
+		prev.highFrom = now
+	}
+	return prev
+}
+
+// hashExe hashes an executable, reusing the hash while it is unchanged
+func (d *minerDetector) hashExe(exe string) string {
+	if exe == "" || strings.HasSuffix(exe, " (deleted)") || strings.HasPrefix(exe, "/memfd:") {
+		// The running image is still readable through /proc/<pid>/exe, but
+		// those are covered by the integrity checks
+		return ""
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return ""
+	}
+	if h, ok := d.hashes[exe]; ok && h.size == info.Size() && h.mtime == info.ModTime().UnixNano() {
+		return h.hash
+	}
+	hash := hashFile(exe)
+	d.hashes[exe] = exeHash{size: info.Size(), mtime: info.ModTime().UnixNano(), hash: hash}
+	return hash
+}
+
+// sendMinerEvent sends one correlated cryptominer event
+func (sc *SecurityCollector) sendMinerEvent(p heuristics.Process, e minerEvidence, signals []minerSignal, confidence string) {
+	var kinds, details []string
+	for _, s := range signals {
+		kinds = append(kinds, s.Kind)
+		details = append(details, s.Detail)
+	}
+	severity := "critical"
+	if confidence != "high" {
+		severity = "warning"
+	}
+
+	cmdline := e.Cmdline
+	if len(cmdline) > maxCmdlineLabel {
+		cmdline = cmdline[:maxCmdlineLabel] + "..."
+	}
+	labels := map[string]string{
+		"event_type":  "cryptominer_detected",
+		"pid":         strconv.Itoa(p.PID),
+		"process":     p.Name,
+		"exe":         p.Exe,
+		"cmdline":     cmdline,
+		"user":        p.User,
+		"cpu_percent": fmt.Sprintf("%.1f", e.CPUPercent),
+		"signals":     strings.Join(kinds, ","),
+		"evidence":    strings.Join(details, "; "),
+		"confidence":  confidence,
+		"severity":    severity,
+	}
+	if e.Hash != "" {
+		labels["sha256"] = e.Hash
+	}
+	if len(e.Remotes) > 0 {
+		labels["remotes"] = strings.Join(e.Remotes, ",")
+	}
+	sc.addAncestry(labels, p.PID)
+
+	message := fmt.Sprintf("Cryptominer detected (%s confidence): %s (PID %d) - %s",
+		confidence, p.Name, p.PID, strings.Join(details, "; "))
+	log.Printf("⛏️ %s", message)
+	sc.sendEvent("process", message, labels)
+}
+
+// readProcCPU returns a process's start time and user+system CPU ticks
+func readProcCPU(pid int) (start, ticks uint64, ok bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, false
+	}
+	rp := strings.LastIndexByte(string(stat), ')')
+	if rp < 0 {
+		return 0, 0, false
+	}
+	// Fields after comm start at field 3; utime is 14, stime 15, starttime 22
+	fields := strings.Fields(string(stat[rp+1:]))
+	if len(fields) < 20 {
+		return 0, 0, false
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	start, _ = strconv.ParseUint(fields[19], 10, 64)
+	return start, utime + stime, true
+}
+
+// processRemotes lists the remote addresses of a process's TCP and UDP
+// sockets, skipping listening and unconnected ones
+func processRemotes(pid int, sockets map[uint64]string) []string {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		target, err := os.Readlink(dir + "/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		inode, ok := strings.CutPrefix(target, "socket:[")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64)
+		if err != nil {
+			continue
+		}
+		socket, ok := sockets[n]
+		if !ok {
+			continue
+		}
+		_, remote, _ := strings.Cut(socket, " ")
+		if host, port := splitHostPort(remote); port == 0 || net.ParseIP(host).IsUnspecified() {
+			continue
+		}
+		seen[remote] = true
+	}
+
+	remotes := make([]string, 0, len(seen))
+	for r := range seen {
+		remotes = append(remotes, r)
+	}
+	sort.Strings(remotes)
+	return remotes
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -115,13 +115,19 @@ func (m *Mitigator) blockIP(action *pb.BlockIPAction) (bool, string) {
 		return false, "Invalid IP address format"
 	}
 
+	// IPv6 sources are blocked with ip6tables
+	iptables := "iptables"
+	if net.ParseIP(action.IpAddress).To4() == nil {
+		iptables = "ip6tables"
+	}
+
 	// Check if we have iptables
-	if !m.hasIptables() {
-		return false, "iptables not available"
+	if !m.hasIptables(iptables) {
+		return false, iptables + " not available"
 	}
 
 	// Create iptables rule to block IP
-	cmd := exec.Command("iptables", "-I", "INPUT", "-s", action.IpAddress, "-j", "DROP")
+	cmd := exec.Command(iptables, "-I", "INPUT", "-s", action.IpAddress, "-j", "DROP")
 
 	if err := cmd.Run(); err != nil {
 		return false, fmt.Sprintf("Failed to add iptables rule: %v", err)
@@ -129,7 +135,7 @@ func (m *Mitigator) blockIP(action *pb.BlockIPAction) (bool, string) {
 
 	// Schedule removal if duration is specified
 	if action.DurationMinutes > 0 {
-		go m.scheduleIPUnblock(action.IpAddress, time.Duration(action.DurationMinutes)*time.Minute)
+		go m.scheduleIPUnblock(iptables, action.IpAddress, time.Duration(action.DurationMinutes)*time.Minute)
 	}
 
 	return true, fmt.Sprintf("IP %s blocked successfully", action.IpAddress)
@@ -181,34 +187,23 @@ func (m *Mitigator) killProcess(action *pb.KillProcessAction) (bool, string) {
 
 // Helper functions
 func (m *Mitigator) isValidIP(ip string) bool {
-	// Basic IP validation
-	parts := strings.Split(ip, ".")
-	if len(parts) != 4 {
-		return false
-	}
-
-	for _, part := range parts {
-		if num, err := strconv.Atoi(part); err != nil || num < 0 || num > 255 {
-			return false
-		}
-	}
-
-	return true
+	// Accept IPv4 and IPv6 literals
+	return net.ParseIP(ip) != nil
 }
 
-func (m *Mitigator) hasIptables() bool {
-	cmd := exec.Command("which", "iptables")
+func (m *Mitigator) hasIptables(name string) bool {
+	cmd := exec.Command("which", name)
 	return cmd.Run() == nil
 }
 
-func (m *Mitigator) scheduleIPUnblock(ip string, duration time.Duration) {
+func (m *Mitigator) scheduleIPUnblock(iptables, ip string, duration time.Duration) {
 	timer := time.NewTimer(duration)
 	defer timer.Stop()
 
 	select {
 	case <-timer.C:
 		// Remove the iptables rule
-		cmd := exec.Command("iptables", "-D", "INPUT", "-s", ip, "-j", "DROP")
+		cmd := exec.Command(iptables, "-D", "INPUT", "-s", ip, "-j", "DROP")
 		if err := cmd.Run(); err != nil {
 			log.Printf("Failed to remove iptables rule for %s: %v", ip, err)
 		} else {
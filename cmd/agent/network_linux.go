@@ -0,0 +1,346 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/inventory"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxRoutes caps the routing table reported in the inventory
+	maxRoutes = 256
+	// networkSettle batches bursts of netlink notifications
+	networkSettle = 2 * time.Second
+	// networkPollInterval is used when netlink is unavailable
+	networkPollInterval = 30 * time.Second
+)
+
+// readRoutes parses the IPv4 and IPv6 routing tables from /proc
+func readRoutes() []inventory.Route {
+	var routes []inventory.Route
+
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+	forEachLine("/proc/net/route", func(fields []string) {
+		if len(fields) < 8 || fields[0] == "Iface" {
+			return
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		if flags&unix.RTF_UP == 0 || flags&unix.RTF_REJECT != 0 {
+			return
+		}
+		dest, mask := procIPv4(fields[1]), procIPv4(fields[7])
+		ones, _ := net.IPMask(mask.To4()).Size()
+		route := inventory.Route{
+			Family:      "ipv4",
+			Destination: fmt.Sprintf("%s/%d", dest, ones),
+			Interface:   fields[0],
+		}
+		route.Metric, _ = strconv.Atoi(fields[6])
+		if gw := procIPv4(fields[2]); !gw.IsUnspecified() {
+			route.Gateway = gw.String()
+		}
+		routes = append(routes, route)
+	})
+
+	// dest prefixlen src srcprefixlen nexthop metric refcnt use flags iface
+	forEachLine("/proc/net/ipv6_route", func(fields []string) {
+		if len(fields) < 10 || fields[9] == "lo" {
+			return
+		}
+		flags, _ := strconv.ParseUint(fields[8], 16, 32)
+		// Skip the local table: own addresses and multicast
+		if flags&unix.RTF_UP == 0 || flags&(unix.RTF_REJECT|unix.RTF_LOCAL) != 0 || strings.HasPrefix(fields[0], "ff") {
+			return
+		}
+		prefix, _ := strconv.ParseUint(fields[1], 16, 8)
+		metric, _ := strconv.ParseUint(fields[5], 16, 32)
+		route := inventory.Route{
+			Family:      "ipv6",
+			Destination: fmt.Sprintf("%s/%d", procIPv6(fields[0]), prefix),
+			Interface:   fields[9],
+			Metric:      int(metric),
+		}
+		if gw := procIPv6(fields[4]); !gw.IsUnspecified() {
+			route.Gateway = gw.String()
+		}
+		routes = append(routes, route)
+	})
+
+	if len(routes) > maxRoutes {
+		routes = routes[:maxRoutes]
+	}
+	return routes
+}
+
+// procIPv4 decodes a little-endian hex IPv4 address from /proc/net/route
+func procIPv4(s string) net.IP {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return net.IPv4zero
+	}
+	ip := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(ip, uint32(v))
+	return ip
+}
+
+// procIPv6 decodes a hex IPv6 address from /proc/net/ipv6_route
+func procIPv6(s string) net.IP {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != net.IPv6len {
+		return net.IPv6unspecified
+	}
+	return net.IP(b)
+}
+
+// defaultInterface returns the interface of the preferred default route,
+// favouring IPv4 and then the lowest metric
+func defaultInterface(routes []inventory.Route) string {
+	var best *inventory.Route
+	for i := range routes {
+		r := &routes[i]
+		if r.Destination != "0.0.0.0/0" && r.Destination != "::/0" {
+			continue
+		}
+		if best == nil ||
+			(r.Family == "ipv4" && best.Family != "ipv4") ||
+			(r.Family == best.Family && r.Metric < best.Metric) {
+			best = r
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Interface
+}
+
+// primaryAddress picks the address that identifies the host: the first
+// global address of the default-route interface, otherwise of any interface
+func primaryAddress(ifaces []inventory.Interface, defaultIface string) string {
+	pick := func(iface inventory.Interface) string {
+		for _, addrs := range [][]string{iface.IPv4, iface.IPv6} {
+			for _, cidr := range addrs {
+				ip, _, err := net.ParseCIDR(cidr)
+				if err == nil && ip.IsGlobalUnicast() {
+					return ip.String()
+				}
+			}
+		}
+		return ""
+	}
+
+	for _, iface := range ifaces {
+		if iface.Name == defaultIface {
+			if ip := pick(iface); ip != "" {
+				return ip
+			}
+		}
+	}
+	for _, iface := range ifaces {
+		if iface.Up {
+			if ip := pick(iface); ip != "" {
+				return ip
+			}
+		}
+	}
+	return ""
+}
+
+// networkState is the addressing the change detector compares
+type networkState struct {
+	interfaces []inventory.Interface
+	routes     []inventory.Route
+	defaultIf  string
+	primaryIP  string
+}
+
+// readNetworkState discovers interfaces, routes and the primary address
+func readNetworkState() networkState {
+	st := networkState{interfaces: readInterfaces(), routes: readRoutes()}
+	st.defaultIf = defaultInterface(st.routes)
+	for i := range st.interfaces {
+		st.interfaces[i].Default = st.interfaces[i].Name == st.defaultIf
+	}
+	st.primaryIP = primaryAddress(st.interfaces, st.defaultIf)
+	return st
+}
+
+// addresses returns "iface address" entries for comparison
+func (st networkState) addresses() map[string]bool {
+	addrs := make(map[string]bool)
+	for _, iface := range st.interfaces {
+		for _, a := range append(append([]string{}, iface.IPv4...), iface.IPv6...) {
+			addrs[iface.Name+" "+a] = true
+		}
+	}
+	return addrs
+}
+
+// primaryIP returns the host's primary address without contacting the network
+func primaryIP() string {
+	if ip := readNetworkState().primaryIP; ip != "" {
+		return ip
+	}
+	return "unknown"
+}
+
+// watchNetworkChanges sends an inventory update whenever interface addresses,
+// the default route or the primary address change
+func (sc *SecurityCollector) watchNetworkChanges() {
+	changes, err := subscribeNetlink(sc)
+	if err != nil {
+		log.Printf("⚠️ Netlink unavailable (%v), polling network every %v", err, networkPollInterval)
+		ticker := time.NewTicker(networkPollInterval)
+		defer ticker.Stop()
+		changes = ticker.C
+	} else {
+		log.Printf("🌐 Watching network address and route changes")
+	}
+
+	last := readNetworkState()
+	for {
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-changes:
+		}
+
+		// Let bursts (DHCP renew, interface restart) settle into one update
+		settle := time.After(networkSettle)
+	drain:
+		for {
+			select {
+			case <-sc.ctx.Done():
+				return
+			case <-changes:
+			case <-settle:
+				break drain
+			}
+		}
+
+		cur := readNetworkState()
+		labels := networkChangeLabels(last, cur)
+		if labels == nil {
+			continue
+		}
+		last = cur
+
+		log.Printf("🌐 Network change: %s", labels["change_summary"])
+		inv := gatherInventory()
+		sc.sendInventory(inventory.EventUpdate, inv, labels)
+	}
+}
+
+// networkChangeLabels describes what changed between two states, or returns
+// nil when nothing relevant did
+func networkChangeLabels(prev, cur networkState) map[string]string {
+	before, after := prev.addresses(), cur.addresses()
+	var added, removed []string
+	for a := range after {
+		if !before[a] {
+			added = append(added, a)
+		}
+	}
+	for a := range before {
+		if !after[a] {
+			removed = append(removed, a)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	if len(added) == 0 && len(removed) == 0 && prev.defaultIf == cur.defaultIf && prev.primaryIP == cur.primaryIP {
+		return nil
+	}
+
+	var summary []string
+	labels := map[string]string{
+		"primary_ip":        cur.primaryIP,
+		"default_interface": cur.defaultIf,
+		"severity":          "info",
+	}
+	if len(added) > 0 {
+		labels["added_addresses"] = strings.Join(added, ",")
+		summary = append(summary, "added "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		labels["removed_addresses"] = strings.Join(removed, ",")
+		summary = append(summary, "removed "+strings.Join(removed, ", "))
+	}
+	if prev.defaultIf != cur.defaultIf {
+		labels["previous_default_interface"] = prev.defaultIf
+		summary = append(summary, fmt.Sprintf("default route %s -> %s", orNone(prev.defaultIf), orNone(cur.defaultIf)))
+	}
+	if prev.primaryIP != cur.primaryIP {
+		labels["previous_primary_ip"] = prev.primaryIP
+		summary = append(summary, fmt.Sprintf("primary IP %s -> %s", orNone(prev.primaryIP), orNone(cur.primaryIP)))
+	}
+	labels["change_summary"] = strings.Join(summary, "; ")
+	return labels
+}
+
+// orNone renders an empty value readably
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// subscribeNetlink returns a channel signalled on every link, address or
+// route notification from the kernel
+func subscribeNetlink(sc *SecurityCollector) (<-chan time.Time, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	groups := uint32(unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR |
+		unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE)
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: groups}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	// Wake up periodically so shutdown is noticed
+	tv := unix.Timeval{Sec: 1}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	changes := make(chan time.Time, 1)
+	go func() {
+		defer unix.Close(fd)
+		buf := make([]byte, 64*1024)
+		for sc.ctx.Err() == nil {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == unix.EAGAIN || err == unix.EINTR {
+					continue
+				}
+				// ENOBUFS: notifications were dropped, so assume a change
+				if err != unix.ENOBUFS {
+					log.Printf("⚠️ Netlink read failed: %v", err)
+					return
+				}
+			}
+			if n == 0 && err == nil {
+				continue
+			}
+			select {
+			case changes <- time.Now():
+			default:
+			}
+		}
+	}()
+	return changes, nil
+}
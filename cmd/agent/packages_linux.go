@@ -0,0 +1,333 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/packages"
+)
+
+const (
+	dpkgStatusFile = "/var/lib/dpkg/status"
+	dpkgInfoDir    = "/var/lib/dpkg/info"
+	rpmDBDir       = "/var/lib/rpm"
+	// packageSettle is how long the package database must stay unchanged
+	// before it is re-read, so a running apt or dnf transaction is reported
+	// once it finishes
+	packageSettle = 10 * time.Second
+	// rpmQueryTimeout bounds a full rpm database query
+	rpmQueryTimeout = 2 * time.Minute
+)
+
+// defaultSuspiciousPackages are installs worth a closer look on a server:
+// scanners, network tools, password crackers and compilers
+var defaultSuspiciousPackages = []string{
+	"nmap", "masscan", "zmap", "netcat*", "ncat", "socat", "hydra", "medusa",
+	"john", "hashcat", "sqlmap", "nikto", "aircrack-ng", "ettercap*", "dsniff",
+	"proxychains*", "tor", "tcpdump", "wireshark*", "tshark", "telnet",
+	"gcc", "gcc-*", "g++", "g++-*", "clang", "clang-*", "build-essential",
+}
+
+// PackageConfig controls package change reporting; the server may override
+// it with the "packages" config section
+type PackageConfig struct {
+	Suspicious []string `json:"suspicious"`
+}
+
+// packageConfig returns the server-provided package config or the defaults
+func packageConfig() PackageConfig {
+	cfg := PackageConfig{Suspicious: defaultSuspiciousPackages}
+	if serverSection("packages", &cfg) {
+		log.Printf("📦 Using server-provided list of %d suspicious packages", len(cfg.Suspicious))
+	}
+	return cfg
+}
+
+// collectPackages reports the installed packages at start and whenever the
+// package database changes, emitting an event per installed, removed,
+// upgraded or downgraded package
+func (sc *SecurityCollector) collectPackages() {
+	manager, dbPath := detectPackageManager()
+	if manager == "" {
+		log.Printf("⚠️ No dpkg or rpm database found, package inventory disabled")
+		return
+	}
+	log.Printf("📦 Starting %s package inventory...", manager)
+
+	cfg := packageConfig()
+	stateFile := filepath.Join(*stateDir, "packages.json")
+	var previous []packages.Package
+	var saved packageState
+	if loadState(stateFile, &saved) && saved.Manager == manager {
+		previous = saved.Packages
+	}
+
+	ticker := time.NewTicker(*packageInterval)
+	defer ticker.Stop()
+
+	var lastMod time.Time
+	reported := false
+	for {
+		mod := packageDBModTime(dbPath)
+		if !reported || (!mod.Equal(lastMod) && time.Since(mod) >= packageSettle) {
+			if pkgs, err := readPackages(sc.ctx, manager); err != nil {
+				log.Printf("Failed to read %s packages: %v", manager, err)
+			} else {
+				lastMod = mod
+				changes := packages.Diff(manager, previous, pkgs)
+				if previous != nil {
+					for _, change := range changes {
+						sc.sendPackageChange(manager, change, cfg)
+					}
+				}
+				if !reported || len(changes) > 0 {
+					sc.sendPackageInventory(manager, pkgs)
+					saveState(stateFile, packageState{Manager: manager, Packages: pkgs})
+				}
+				previous, reported = pkgs, true
+			}
+		}
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendPackageInventory sends the full package list
+func (sc *SecurityCollector) sendPackageInventory(manager string, pkgs []packages.Package) {
+	data, err := json.Marshal(packages.Inventory{CollectedAt: time.Now().UTC(), Manager: manager, Packages: pkgs})
+	if err != nil {
+		log.Printf("Failed to encode package inventory: %v", err)
+		return
+	}
+	sc.sendEvent(packages.Stream, string(data), map[string]string{
+		"event_type": packages.EventInventory,
+		"manager":    manager,
+		"count":      strconv.Itoa(len(pkgs)),
+		"severity":   "info",
+	})
+}
+
+// sendPackageChange sends one package change
+func (sc *SecurityCollector) sendPackageChange(manager string, change packages.Change, cfg PackageConfig) {
+	p := change.Package
+	labels := map[string]string{
+		"event_type": change.Type,
+		"package":    p.Name,
+		"version":    p.Version,
+		"arch":       p.Arch,
+		"source":     p.Source,
+		"manager":    manager,
+		"severity":   "info",
+	}
+
+	var message string
+	switch change.Type {
+	case packages.EventInstalled:
+		message = fmt.Sprintf("Package installed: %s %s", p.Name, p.Version)
+		if matchAny(cfg.Suspicious, p.Name) {
+			labels["suspicious"] = "true"
+			labels["severity"] = "warning"
+			message = "Suspicious package installed: " + p.Name + " " + p.Version
+		}
+	case packages.EventRemoved:
+		message = fmt.Sprintf("Package removed: %s %s", p.Name, p.Version)
+	case packages.EventUpgraded, packages.EventDowngraded:
+		labels["previous_version"] = change.Previous.Version
+		verb := "upgraded"
+		if change.Type == packages.EventDowngraded {
+			// A downgrade can reintroduce fixed vulnerabilities
+			verb = "downgraded"
+			labels["severity"] = "warning"
+		}
+		message = fmt.Sprintf("Package %s: %s %s -> %s", verb, p.Name, change.Previous.Version, p.Version)
+	}
+
+	log.Printf("📦 %s", message)
+	sc.sendEvent(packages.Stream, message, labels)
+}
+
+// detectPackageManager finds the host's package database
+func detectPackageManager() (manager, dbPath string) {
+	if fileExists(dpkgStatusFile) {
+		return packages.ManagerDpkg, dpkgStatusFile
+	}
+	if _, err := exec.LookPath("rpm"); err == nil && fileExists(rpmDBDir) {
+		// Newer releases keep the database in /usr/lib/sysimage/rpm
+		if resolved, err := filepath.EvalSymlinks(rpmDBDir); err == nil {
+			return packages.ManagerRPM, resolved
+		}
+		return packages.ManagerRPM, rpmDBDir
+	}
+	return "", ""
+}
+
+// packageDBModTime returns the latest modification time of the package
+// database file, or of any file in the database directory
+func packageDBModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	latest := info.ModTime()
+	if info.IsDir() {
+		entries, _ := os.ReadDir(path)
+		for _, entry := range entries {
+			if fi, err := entry.Info(); err == nil && fi.ModTime().After(latest) {
+				latest = fi.ModTime()
+			}
+		}
+	}
+	return latest
+}
+
+// readPackages lists the installed packages
+func readPackages(ctx context.Context, manager string) ([]packages.Package, error) {
+	if manager == packages.ManagerRPM {
+		return readRPMPackages(ctx)
+	}
+	return readDpkgStatus(dpkgStatusFile)
+}
+
+// readDpkgStatus parses the installed packages from the dpkg status file
+func readDpkgStatus(path string) ([]packages.Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pkgs []packages.Package
+	var p packages.Package
+	var installed bool
+	flush := func() {
+		if installed && p.Name != "" {
+			p.InstalledAt = dpkgInstallTime(p.Name, p.Arch)
+			pkgs = append(pkgs, p)
+		}
+		p, installed = packages.Package{}, false
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		// Continuation lines belong to multi-line fields such as Description
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Package":
+			p.Name = value
+		case "Version":
+			p.Version = value
+		case "Architecture":
+			p.Arch = value
+		case "Source":
+			// "Source: name (version)" when the versions differ
+			p.Source, _, _ = strings.Cut(value, " ")
+		case "Status":
+			// "want flag status", e.g. "install ok installed"
+			fields := strings.Fields(value)
+			installed = len(fields) == 3 && fields[2] == "installed"
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range pkgs {
+		if pkgs[i].Source == "" {
+			pkgs[i].Source = pkgs[i].Name
+		}
+	}
+	return pkgs, nil
+}
+
+// dpkgInstallTime approximates when a package was installed or last upgraded
+// from its file list, which dpkg rewrites on every unpack
+func dpkgInstallTime(name, arch string) time.Time {
+	for _, list := range []string{name + ":" + arch + ".list", name + ".list"} {
+		if info, err := os.Stat(filepath.Join(dpkgInfoDir, list)); err == nil {
+			return info.ModTime().UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// readRPMPackages queries the rpm database for installed packages
+func readRPMPackages(ctx context.Context) ([]packages.Package, error) {
+	ctx, cancel := context.WithTimeout(ctx, rpmQueryTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "rpm", "-qa", "--queryformat",
+		`%{NAME}\t%{EPOCH}\t%{VERSION}\t%{RELEASE}\t%{ARCH}\t%{INSTALLTIME}\t%{SOURCERPM}\n`).Output()
+	if err != nil {
+		return nil, fmt.Errorf("rpm -qa: %w", err)
+	}
+
+	var pkgs []packages.Package
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		// gpg-pubkey entries are imported signing keys, not packages
+		if len(fields) != 7 || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		name, epoch, ver, rel, arch := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+		p := packages.Package{Name: name, Version: ver + "-" + rel, Arch: arch}
+		if epoch != "(none)" && epoch != "0" {
+			p.Version = epoch + ":" + p.Version
+		}
+		if arch == "(none)" {
+			p.Arch = ""
+		}
+		if ts, err := strconv.ParseInt(fields[5], 10, 64); err == nil {
+			p.InstalledAt = time.Unix(ts, 0).UTC()
+		}
+		// foo-1.2-3.el9.src.rpm -> foo
+		if srpm := strings.TrimSuffix(fields[6], ".src.rpm"); srpm != fields[6] {
+			if i := strings.LastIndexByte(srpm, '-'); i > 0 {
+				if j := strings.LastIndexByte(srpm[:i], '-'); j > 0 {
+					p.Source = srpm[:j]
+				}
+			}
+		}
+		if p.Source == "" {
+			p.Source = name
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// packageState is the last reported package list, kept across restarts so
+// changes made while the agent was down are still reported
+type packageState struct {
+	Manager  string             `json:"manager"`
+	Packages []packages.Package `json:"packages"`
+}
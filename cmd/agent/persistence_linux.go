@@ -0,0 +1,440 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/accounts"
+)
+
+const (
+	// persistenceMaxEntries caps the entries of each location (per home
+	// directory for "~/" patterns) so a runaway directory can't exhaust
+	// memory or crowd out the other locations
+	persistenceMaxEntries = 5000
+	// persistenceMaxContent caps the file content attached to an event
+	persistenceMaxContent = 4096
+	// persistenceHashLimit skips hashing files too large to be scripts
+	persistenceHashLimit = 16 << 20
+)
+
+// persistenceLocation is a glob of files that can make code run
+// automatically; "~/" patterns are expanded for every home directory
+type persistenceLocation struct {
+	category  string
+	pattern   string
+	recursive bool // descend into matched directories (systemd drop-ins, .wants links)
+}
+
+var persistenceLocations = []persistenceLocation{
+	{"cron", "/etc/crontab", false},
+	{"cron", "/etc/anacrontab", false},
+	{"cron", "/etc/cron.d/*", false},
+	{"cron", "/etc/cron.hourly/*", false},
+	{"cron", "/etc/cron.daily/*", false},
+	{"cron", "/etc/cron.weekly/*", false},
+	{"cron", "/etc/cron.monthly/*", false},
+	{"cron", "/var/spool/cron/*", false},
+	{"cron", "/var/spool/cron/crontabs/*", false},
+	{"at", "/var/spool/cron/atjobs/*", false},
+	{"systemd", "/etc/systemd/system", true},
+	{"systemd", "/usr/lib/systemd/system", true},
+	{"systemd", "/lib/systemd/system", true},
+	{"systemd", "/etc/systemd/user", true},
+	{"systemd", "/usr/lib/systemd/user", true},
+	{"systemd", "~/.config/systemd/user", true},
+	{"rc", "/etc/rc.local", false},
+	{"rc", "/etc/rc.d/rc.local", false},
+	{"rc", "/etc/init.d/*", false},
+	{"shell_profile", "/etc/profile", false},
+	{"shell_profile", "/etc/profile.d/*", false},
+	{"shell_profile", "/etc/environment", false},
+	{"shell_profile", "/etc/bash.bashrc", false},
+	{"shell_profile", "/etc/bashrc", false},
+	{"shell_profile", "/etc/zsh/*", false},
+	{"shell_profile", "~/.profile", false},
+	{"shell_profile", "~/.bashrc", false},
+	{"shell_profile", "~/.bash_profile", false},
+	{"shell_profile", "~/.bash_login", false},
+	{"shell_profile", "~/.bash_logout", false},
+	{"shell_profile", "~/.zshrc", false},
+	{"shell_profile", "~/.zprofile", false},
+	{"shell_profile", "~/.zshenv", false},
+	{"shell_profile", "~/.config/fish/config.fish", false},
+	{"ld_preload", "/etc/ld.so.preload", false},
+	{"ld_preload", "/etc/ld.so.conf", false},
+	{"ld_preload", "/etc/ld.so.conf.d/*", false},
+	{"autostart", "/etc/xdg/autostart/*", false},
+	{"autostart", "~/.config/autostart/*", false},
+}
+
+// persistenceEntry is the recorded state of one persistence file or link
+type persistenceEntry struct {
+	Category string `json:"category"`
+	Path     string `json:"path"`
+	Owner    string `json:"owner"`
+	UID      uint32 `json:"uid"`
+	Mode     string `json:"mode"`
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mtime"`
+	Hash     string `json:"sha256,omitempty"`
+	Target   string `json:"target,omitempty"` // symlink target, e.g. an enabled unit
+}
+
+// collectPersistence inventories cron jobs, systemd units and timers, rc
+// scripts, shell profiles, preload configuration and autostart entries, and
+// reports entries that are added, changed or removed
+func (sc *SecurityCollector) collectPersistence() {
+	log.Printf("🧷 Starting persistence location monitoring...")
+
+	stateFile := filepath.Join(*stateDir, "persistence.json")
+	shadow := NewConfigShadow(filepath.Join(*stateDir, "persistence"), nil, *diffMaxSize)
+
+	var previous map[string]persistenceEntry
+	baseline := loadState(stateFile, &previous)
+
+	ticker := time.NewTicker(*persistenceInterval)
+	defer ticker.Stop()
+
+	reported := false
+	warned := make(map[string]bool)
+	for {
+		current, truncated := scanPersistence(previous)
+		for _, loc := range truncated {
+			if !warned[loc.pattern] {
+				warned[loc.pattern] = true
+				log.Printf("⚠️  Persistence location %s has more than %d entries, keeping its previous state", loc.pattern, persistenceMaxEntries)
+			}
+		}
+		holdTruncated(previous, current, truncated)
+		changed := false
+		if baseline {
+			changed = sc.reportPersistenceChanges(previous, current, shadow)
+		} else {
+			for path := range current {
+				shadow.Update(path)
+			}
+		}
+		if !reported {
+			sc.sendPersistenceInventory(current)
+			reported = true
+		}
+		if changed || !baseline {
+			saveState(stateFile, current)
+		}
+		previous, baseline = current, true
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanPersistence records every persistence entry, reusing the previous
+// hash of files whose size and modification time are unchanged. It also
+// returns the locations that hit persistenceMaxEntries and were cut short.
+func scanPersistence(previous map[string]persistenceEntry) (map[string]persistenceEntry, []persistenceLocation) {
+	entries := make(map[string]persistenceEntry)
+	var truncated []persistenceLocation
+	owners := make(map[uint32]string)
+	var homes []string
+	if users, err := accounts.ReadUsers("/"); err == nil {
+		seen := make(map[string]bool)
+		for _, u := range users {
+			owners[uint32(u.UID)] = u.Name
+			if u.Home == "" || u.Home == "/" || seen[u.Home] {
+				continue
+			}
+			seen[u.Home] = true
+			homes = append(homes, u.Home)
+		}
+		sort.Strings(homes)
+	}
+
+	// Entries recorded for the location being scanned
+	count, capped := 0, false
+	add := func(category, path string, info fs.FileInfo) {
+		if count >= persistenceMaxEntries {
+			capped = true
+			return
+		}
+		e := persistenceEntry{
+			Category: category,
+			Path:     path,
+			Mode:     info.Mode().String(),
+			Size:     info.Size(),
+			ModTime:  info.ModTime().UnixNano(),
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			e.UID = st.Uid
+		}
+		if e.Owner = owners[e.UID]; e.Owner == "" {
+			e.Owner = strconv.FormatUint(uint64(e.UID), 10)
+		}
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			e.Target, _ = os.Readlink(path)
+		case info.Mode().IsRegular():
+			if prev, ok := previous[path]; ok && prev.Size == e.Size && prev.ModTime == e.ModTime && prev.Hash != "" {
+				e.Hash = prev.Hash
+			} else if e.Size <= persistenceHashLimit {
+				e.Hash = hashFile(path)
+			}
+		default:
+			return
+		}
+		// Units and their enabling links are more useful split by kind
+		if category == "systemd" && strings.HasSuffix(path, ".timer") {
+			e.Category = "systemd_timer"
+		} else if category == "systemd" {
+			e.Category = "systemd_unit"
+		}
+		if _, ok := entries[path]; !ok {
+			count++
+		}
+		entries[path] = e
+	}
+
+	walked := make(map[string]bool)
+	for _, pattern := range expandPersistencePatterns(homes) {
+		count, capped = 0, false
+		matches, _ := filepath.Glob(pattern.pattern)
+		for _, match := range matches {
+			if capped {
+				break
+			}
+			info, err := os.Lstat(match)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				add(pattern.category, match, info)
+				continue
+			}
+			if !pattern.recursive {
+				continue
+			}
+			// /lib is a link to /usr/lib on merged-/usr systems
+			if real, err := filepath.EvalSymlinks(match); err == nil {
+				if walked[real] {
+					continue
+				}
+				walked[real] = true
+			}
+			filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if capped {
+					return filepath.SkipAll
+				}
+				if err != nil || d.IsDir() {
+					return nil
+				}
+				if info, err := d.Info(); err == nil {
+					add(pattern.category, path, info)
+				}
+				return nil
+			})
+		}
+		if capped {
+			truncated = append(truncated, pattern)
+		}
+	}
+	return entries, truncated
+}
+
+// holdTruncated replaces the partial entries of truncated locations with
+// their previous state, so a location that is only partly scanned is neither
+// diffed nor saved
+func holdTruncated(previous, current map[string]persistenceEntry, truncated []persistenceLocation) {
+	for _, loc := range truncated {
+		for path := range current {
+			if loc.covers(path) {
+				delete(current, path)
+			}
+		}
+		for path, e := range previous {
+			if loc.covers(path) {
+				current[path] = e
+			}
+		}
+	}
+}
+
+// covers reports whether path is recorded under the location
+func (loc persistenceLocation) covers(path string) bool {
+	if ok, _ := filepath.Match(loc.pattern, path); ok {
+		return true
+	}
+	return loc.recursive && strings.HasPrefix(path, loc.pattern+"/")
+}
+
+// expandPersistencePatterns expands "~/" patterns for every home directory
+func expandPersistencePatterns(homes []string) []persistenceLocation {
+	var expanded []persistenceLocation
+	for _, loc := range persistenceLocations {
+		rest, ok := strings.CutPrefix(loc.pattern, "~/")
+		if !ok {
+			expanded = append(expanded, loc)
+			continue
+		}
+		for _, home := range homes {
+			expanded = append(expanded, persistenceLocation{loc.category, filepath.Join(home, rest), loc.recursive})
+		}
+	}
+	return expanded
+}
+
+// reportPersistenceChanges sends an event for every added, modified or
+// removed entry and reports whether anything changed
+func (sc *SecurityCollector) reportPersistenceChanges(previous, current map[string]persistenceEntry, shadow *ConfigShadow) bool {
+	var paths []string
+	for path := range current {
+		paths = append(paths, path)
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changed := false
+	for _, path := range paths {
+		prev, existed := previous[path]
+		cur, exists := current[path]
+		switch {
+		case !existed:
+			changed = true
+			labels := persistenceLabels(cur)
+			if content, ok := shadow.readText(path); ok {
+				labels["content"] = truncateContent(content)
+			}
+			shadow.Update(path)
+			sc.sendPersistenceEvent("persistence_added", labels,
+				fmt.Sprintf("Persistence entry added (%s): %s owned by %s", cur.Category, path, cur.Owner))
+
+		case !exists:
+			changed = true
+			labels := persistenceLabels(prev)
+			if diff := shadow.Diff(path); diff != "" {
+				labels["diff"] = diff
+			}
+			labels["severity"] = "info"
+			sc.sendPersistenceEvent("persistence_removed", labels,
+				fmt.Sprintf("Persistence entry removed (%s): %s", prev.Category, path))
+
+		case prev.Hash != cur.Hash || prev.Target != cur.Target || prev.Mode != cur.Mode || prev.UID != cur.UID:
+			changed = true
+			var what []string
+			if prev.Hash != cur.Hash {
+				what = append(what, "content")
+			}
+			if prev.Target != cur.Target {
+				what = append(what, fmt.Sprintf("target %s -> %s", prev.Target, cur.Target))
+			}
+			if prev.Mode != cur.Mode {
+				what = append(what, fmt.Sprintf("mode %s -> %s", prev.Mode, cur.Mode))
+			}
+			if prev.UID != cur.UID {
+				what = append(what, fmt.Sprintf("owner %s -> %s", prev.Owner, cur.Owner))
+			}
+			labels := persistenceLabels(cur)
+			labels["changes"] = strings.Join(what, ", ")
+			if prev.Hash != cur.Hash {
+				if diff := shadow.Diff(path); diff != "" {
+					labels["diff"] = diff
+				}
+			}
+			sc.sendPersistenceEvent("persistence_modified", labels,
+				fmt.Sprintf("Persistence entry modified (%s): %s (%s)", cur.Category, path, labels["changes"]))
+
+		case prev.ModTime != cur.ModTime || prev.Size != cur.Size:
+			// Touched without a content change; keep the recorded state fresh
+			changed = true
+		}
+	}
+	return changed
+}
+
+// persistenceLabels describes an entry; preload configuration is critical
+// because it injects code into every process
+func persistenceLabels(e persistenceEntry) map[string]string {
+	severity := "warning"
+	if e.Path == "/etc/ld.so.preload" {
+		severity = "critical"
+	}
+	labels := map[string]string{
+		"category": e.Category,
+		"path":     e.Path,
+		"owner":    e.Owner,
+		"uid":      strconv.FormatUint(uint64(e.UID), 10),
+		"mode":     e.Mode,
+		"severity": severity,
+	}
+	if e.Hash != "" {
+		labels["sha256"] = e.Hash
+	}
+	if e.Target != "" {
+		labels["target"] = e.Target
+	}
+	if e.Category == "systemd_timer" && e.Target != "" {
+		labels["enabled"] = "true"
+	}
+	return labels
+}
+
+// sendPersistenceEvent sends one persistence change
+func (sc *SecurityCollector) sendPersistenceEvent(eventType string, labels map[string]string, message string) {
+	labels["event_type"] = eventType
+	log.Printf("🧷 %s", message)
+	sc.sendEvent("persistence", message, labels)
+}
+
+// sendPersistenceInventory sends the list of persistence entries with a
+// count per category
+func (sc *SecurityCollector) sendPersistenceInventory(entries map[string]persistenceEntry) {
+	list := make([]persistenceEntry, 0, len(entries))
+	counts := make(map[string]int)
+	for _, e := range entries {
+		list = append(list, e)
+		counts[e.Category]++
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		log.Printf("Failed to encode persistence inventory: %v", err)
+		return
+	}
+	labels := map[string]string{
+		"event_type": "persistence_inventory",
+		"count":      strconv.Itoa(len(list)),
+		"severity":   "info",
+	}
+	for category, n := range counts {
+		labels["count_"+category] = strconv.Itoa(n)
+	}
+	log.Printf("🧷 Persistence inventory: %d entries", len(list))
+	sc.sendEvent("persistence", string(data), labels)
+}
+
+// truncateContent caps file content attached to an event
+func truncateContent(content string) string {
+	if len(content) > persistenceMaxContent {
+		return content[:persistenceMaxContent] + "\n... truncated\n"
+	}
+	return content
+}
@@ -0,0 +1,511 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/accounts"
+	"github.com/mulutu/security-manager/internal/utmp"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	wtmpPath    = "/var/log/wtmp"
+	btmpPath    = "/var/log/btmp"
+	lastlogPath = "/var/log/lastlog"
+	// clockSkewTolerance is how far a record may go back in time before it
+	// counts as tampering; NTP corrections are far smaller
+	clockSkewTolerance = 5 * time.Minute
+)
+
+// utmpPaths are where glibc keeps the current sessions
+var utmpPaths = []string{"/run/utmp", "/var/run/utmp"}
+
+// loginLogState is how far the agent has read a wtmp-format file
+type loginLogState struct {
+	Inode    uint64    `json:"inode"`
+	Size     int64     `json:"size"`
+	LastTime time.Time `json:"last_time"`
+}
+
+// sessionState is persisted so sessions that outlive an agent restart still
+// get a logout with its duration
+type sessionState struct {
+	Wtmp    loginLogState           `json:"wtmp"`
+	Btmp    loginLogState           `json:"btmp"`
+	Open    map[string]utmp.Record  `json:"open"` // logins awaiting a logout, by tty
+	Lastlog map[string]lastlogEntry `json:"lastlog"`
+}
+
+// activeSession is one entry of the session inventory
+type activeSession struct {
+	User      string    `json:"user"`
+	TTY       string    `json:"tty"`
+	Host      string    `json:"host,omitempty"`
+	LoginTime time.Time `json:"login_time"`
+	PID       int32     `json:"pid"`
+}
+
+// collectSessions reads the binary login records: active sessions from
+// utmp, logins and logouts from wtmp, failed logins from btmp and each
+// user's last login from lastlog. Shrinking, replaced or cleared files,
+// wiped records and timestamps going backwards are reported as tampering.
+func (sc *SecurityCollector) collectSessions() {
+	log.Printf("🪪 Starting login session tracking...")
+
+	stateFile := filepath.Join(*stateDir, "sessions.json")
+	var state sessionState
+	if !loadState(stateFile, &state) {
+		state = sessionState{
+			Wtmp: baselineLoginLog(wtmpPath),
+			Btmp: baselineLoginLog(btmpPath),
+			Open: make(map[string]utmp.Record),
+		}
+		// Sessions already open can still be closed with a duration
+		for _, s := range readActiveSessions() {
+			state.Open[s.TTY] = utmp.Record{Type: utmp.UserProcess, PID: s.PID, Line: s.TTY, User: s.User, Host: s.Host, Time: s.LoginTime}
+		}
+		state.Lastlog, _ = readLastlog()
+		saveState(stateFile, state)
+	}
+	if state.Open == nil {
+		state.Open = make(map[string]utmp.Record)
+	}
+
+	ticker := time.NewTicker(*sessionsInterval)
+	defer ticker.Stop()
+
+	var lastInventory string
+	var lastlogStat string
+	for {
+		changed := false
+
+		records, tampering := readLoginLog(wtmpPath, &state.Wtmp)
+		for _, t := range tampering {
+			sc.sendSessionTamper(wtmpPath, t)
+		}
+		for _, r := range records {
+			sc.handleWtmpRecord(r, state.Open)
+		}
+		changed = changed || len(records) > 0 || len(tampering) > 0
+
+		records, tampering = readLoginLog(btmpPath, &state.Btmp)
+		for _, t := range tampering {
+			sc.sendSessionTamper(btmpPath, t)
+		}
+		for _, r := range records {
+			sc.sendFailedLogin(r)
+		}
+		changed = changed || len(records) > 0 || len(tampering) > 0
+
+		if st := fileStatKey(lastlogPath); st != lastlogStat {
+			if current, ok := readLastlog(); ok {
+				for _, t := range lastlogTampering(state.Lastlog, current) {
+					sc.sendSessionTamper(lastlogPath, t)
+				}
+				state.Lastlog = current
+				lastlogStat = st
+				changed = true
+			}
+		}
+
+		sessions := readActiveSessions()
+		if key := sessionsKey(sessions); key != lastInventory {
+			lastInventory = key
+			sc.sendSessionInventory(sessions)
+		}
+
+		if changed {
+			saveState(stateFile, state)
+		}
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loginTamper describes one sign of tampering with a login record file
+type loginTamper struct {
+	reason   string
+	severity string
+	labels   map[string]string
+}
+
+// baselineLoginLog starts reading a file at its current end so history
+// isn't replayed on first start
+func baselineLoginLog(path string) loginLogState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return loginLogState{}
+	}
+	st := loginLogState{Inode: inodeOf(info), Size: info.Size() - info.Size()%utmp.RecordSize}
+	if st.Size >= utmp.RecordSize {
+		if f, err := os.Open(path); err == nil {
+			raw := make([]byte, utmp.RecordSize)
+			if _, err := f.ReadAt(raw, st.Size-utmp.RecordSize); err == nil {
+				st.LastTime = utmp.ParseRecord(raw).Time
+			}
+			f.Close()
+		}
+	}
+	return st
+}
+
+// readLoginLog returns the records appended to a wtmp-format file since the
+// last read, following logrotate's rename to path.1, and any tampering seen
+func readLoginLog(path string, st *loginLogState) ([]utmp.Record, []loginTamper) {
+	var tampering []loginTamper
+	info, err := os.Stat(path)
+	if err != nil {
+		if st.Inode != 0 && os.IsNotExist(err) {
+			tampering = append(tampering, loginTamper{"deleted", "critical", map[string]string{"previous_size": strconv.FormatInt(st.Size, 10)}})
+			*st = loginLogState{LastTime: st.LastTime}
+		}
+		return nil, tampering
+	}
+
+	var records []utmp.Record
+	inode := inodeOf(info)
+	switch {
+	case st.Inode == 0:
+		// The file appeared: read it from the start
+	case inode != st.Inode:
+		rotated := path + ".1"
+		if prev, err := os.Stat(rotated); err == nil && inodeOf(prev) == st.Inode && prev.Size() >= st.Size {
+			// Rotated by logrotate: finish the old file first
+			r, t := readRecords(rotated, st)
+			records, tampering = append(records, r...), append(tampering, t...)
+		} else {
+			tampering = append(tampering, loginTamper{"replaced", "critical", map[string]string{
+				"previous_size": strconv.FormatInt(st.Size, 10),
+				"size":          strconv.FormatInt(info.Size(), 10),
+			}})
+		}
+		st.Size = 0
+	case info.Size() < st.Size:
+		reason := "truncated"
+		if info.Size() == 0 {
+			reason = "cleared"
+		}
+		tampering = append(tampering, loginTamper{reason, "critical", map[string]string{
+			"previous_size": strconv.FormatInt(st.Size, 10),
+			"size":          strconv.FormatInt(info.Size(), 10),
+		}})
+		// Records before the new end were already reported
+		st.Size = info.Size() - info.Size()%utmp.RecordSize
+	}
+
+	st.Inode = inode
+	r, t := readRecords(path, st)
+	return append(records, r...), append(tampering, t...)
+}
+
+// readRecords reads whole records from st.Size on, advancing st
+func readRecords(path string, st *loginLogState) ([]utmp.Record, []loginTamper) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(st.Size, io.SeekStart); err != nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(f, 64<<20))
+	if err != nil {
+		return nil, nil
+	}
+	data = data[:len(data)-len(data)%utmp.RecordSize]
+
+	var records []utmp.Record
+	var tampering []loginTamper
+	wiped := 0
+	for off := 0; off < len(data); off += utmp.RecordSize {
+		raw := data[off : off+utmp.RecordSize]
+		if utmp.IsZero(raw) {
+			wiped++
+			continue
+		}
+		r := utmp.ParseRecord(raw)
+		if !st.LastTime.IsZero() && r.Time.Before(st.LastTime.Add(-clockSkewTolerance)) {
+			tampering = append(tampering, loginTamper{"time_reversal", "warning", map[string]string{
+				"offset":        strconv.FormatInt(st.Size+int64(off), 10),
+				"record_time":   r.Time.Format(time.RFC3339),
+				"previous_time": st.LastTime.Format(time.RFC3339),
+				"user":          r.User,
+			}})
+		}
+		if r.Time.After(st.LastTime) {
+			st.LastTime = r.Time
+		}
+		records = append(records, r)
+	}
+	if wiped > 0 {
+		tampering = append(tampering, loginTamper{"wiped_records", "critical", map[string]string{
+			"records": strconv.Itoa(wiped),
+		}})
+	}
+	st.Size += int64(len(data))
+	return records, tampering
+}
+
+// handleWtmpRecord turns a wtmp record into login, logout and boot events
+func (sc *SecurityCollector) handleWtmpRecord(r utmp.Record, open map[string]utmp.Record) {
+	switch {
+	case r.Type == utmp.UserProcess:
+		open[r.Line] = r
+		labels := sessionLabels("session_login", r)
+		message := fmt.Sprintf("Login: %s on %s", r.User, r.Line)
+		if r.Host != "" {
+			message += " from " + r.Host
+		}
+		sc.sendSessionEvent(message, labels)
+
+	case r.Type == utmp.DeadProcess:
+		login, ok := open[r.Line]
+		if !ok {
+			return
+		}
+		delete(open, r.Line)
+		sc.sendLogout(login, r.Time, "logout")
+
+	case r.Type == utmp.BootTime || (r.Type == utmp.RunLevel && r.User == "shutdown"):
+		// Sessions still open never logged out: the system went down under them
+		reason := "shutdown"
+		if r.Type == utmp.BootTime {
+			reason = "crash"
+		}
+		var ttys []string
+		for tty := range open {
+			ttys = append(ttys, tty)
+		}
+		sort.Strings(ttys)
+		for _, tty := range ttys {
+			sc.sendLogout(open[tty], r.Time, reason)
+			delete(open, tty)
+		}
+		if r.Type == utmp.BootTime {
+			labels := map[string]string{
+				"event_type": "system_boot",
+				"kernel":     r.Host,
+				"boot_time":  r.Time.Format(time.RFC3339),
+				"severity":   "info",
+			}
+			sc.sendSessionEvent(fmt.Sprintf("System boot at %s (kernel %s)", r.Time.Format(time.RFC3339), r.Host), labels)
+		}
+	}
+}
+
+// sendLogout reports the end of a session with its duration
+func (sc *SecurityCollector) sendLogout(login utmp.Record, at time.Time, reason string) {
+	duration := at.Sub(login.Time)
+	if duration < 0 {
+		duration = 0
+	}
+	labels := sessionLabels("session_logout", login)
+	labels["logout_time"] = at.Format(time.RFC3339)
+	labels["duration_seconds"] = strconv.FormatInt(int64(duration.Seconds()), 10)
+	labels["reason"] = reason
+	sc.sendSessionEvent(fmt.Sprintf("Logout: %s on %s after %v (%s)", login.User, login.Line, duration.Round(time.Second), reason), labels)
+}
+
+// sendFailedLogin reports a btmp record
+func (sc *SecurityCollector) sendFailedLogin(r utmp.Record) {
+	labels := sessionLabels("session_login_failed", r)
+	labels["severity"] = "warning"
+	message := fmt.Sprintf("Failed login: %s on %s", r.User, r.Line)
+	if r.Host != "" {
+		message += " from " + r.Host
+	}
+	sc.sendSessionEvent(message, labels)
+}
+
+// sessionLabels describes a login record
+func sessionLabels(eventType string, r utmp.Record) map[string]string {
+	labels := map[string]string{
+		"event_type": eventType,
+		"user":       r.User,
+		"tty":        r.Line,
+		"login_time": r.Time.Format(time.RFC3339),
+		"severity":   "info",
+		"source":     "wtmp",
+	}
+	if eventType == "session_login_failed" {
+		labels["source"] = "btmp"
+	}
+	if r.Host != "" {
+		labels["source_host"] = r.Host
+	}
+	if r.Addr != nil {
+		labels["source_ip"] = r.Addr.String()
+	}
+	if r.PID > 0 {
+		labels["pid"] = strconv.Itoa(int(r.PID))
+	}
+	return labels
+}
+
+// sendSessionTamper reports a sign of tampering with a login record file
+func (sc *SecurityCollector) sendSessionTamper(path string, t loginTamper) {
+	labels := map[string]string{
+		"event_type": "session_log_tampered",
+		"file":       path,
+		"reason":     t.reason,
+		"severity":   t.severity,
+	}
+	for k, v := range t.labels {
+		labels[k] = v
+	}
+	message := fmt.Sprintf("Login records tampered: %s %s", path, strings.ReplaceAll(t.reason, "_", " "))
+	sc.sendSessionEvent(message, labels)
+}
+
+// sendSessionEvent sends one event on the sessions stream
+func (sc *SecurityCollector) sendSessionEvent(message string, labels map[string]string) {
+	log.Printf("🪪 %s", message)
+	sc.sendEvent("sessions", message, labels)
+}
+
+// readActiveSessions lists the user sessions in utmp whose process is alive
+func readActiveSessions() []activeSession {
+	sessions := []activeSession{}
+	for _, path := range utmpPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, r := range utmp.Parse(data) {
+			if r.Type != utmp.UserProcess || r.User == "" {
+				continue
+			}
+			if err := unix.Kill(int(r.PID), 0); err != nil && err != unix.EPERM {
+				continue // stale entry of a crashed session
+			}
+			sessions = append(sessions, activeSession{User: r.User, TTY: r.Line, Host: r.Host, LoginTime: r.Time, PID: r.PID})
+		}
+		break
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].TTY < sessions[j].TTY })
+	return sessions
+}
+
+func sessionsKey(sessions []activeSession) string {
+	var b strings.Builder
+	for _, s := range sessions {
+		fmt.Fprintf(&b, "%s|%s|%s|%d;", s.User, s.TTY, s.Host, s.PID)
+	}
+	return b.String()
+}
+
+// sendSessionInventory sends the list of active sessions
+func (sc *SecurityCollector) sendSessionInventory(sessions []activeSession) {
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		log.Printf("Failed to encode sessions: %v", err)
+		return
+	}
+	users := make(map[string]bool)
+	for _, s := range sessions {
+		users[s.User] = true
+	}
+	sc.sendEvent("sessions", string(data), map[string]string{
+		"event_type": "session_inventory",
+		"count":      strconv.Itoa(len(sessions)),
+		"users":      strconv.Itoa(len(users)),
+		"severity":   "info",
+	})
+}
+
+// lastlogEntry is one passwd user's last login; Time is zero for users
+// who never logged in
+type lastlogEntry struct {
+	UID  int       `json:"uid"`
+	Time time.Time `json:"time"`
+}
+
+// readLastlog returns the last login of every user in passwd, by user name.
+// It reports false when passwd can't be read.
+func readLastlog() (map[string]lastlogEntry, bool) {
+	users, err := accounts.ReadUsers("/")
+	if err != nil {
+		return nil, false
+	}
+	entries := make(map[string]lastlogEntry, len(users))
+	f, err := os.Open(lastlogPath)
+	if err == nil {
+		defer f.Close()
+	}
+	raw := make([]byte, utmp.LastlogSize)
+	for _, u := range users {
+		e := lastlogEntry{UID: u.UID}
+		if f != nil {
+			if _, err := f.ReadAt(raw, utmp.LastlogOffset(u.UID)); err == nil {
+				if l, ok := utmp.ParseLastlog(raw, u.UID); ok {
+					e.Time = l.Time
+				}
+			}
+		}
+		entries[u.Name] = e
+	}
+	return entries, true
+}
+
+// lastlogTampering reports users whose last login was cleared or moved back
+// in time; a new login only ever moves it forward. Only users in passwd
+// with the same UID both times are compared, so userdel and useradd aren't
+// taken for tampering.
+func lastlogTampering(before, after map[string]lastlogEntry) []loginTamper {
+	var tampering []loginTamper
+	var names []string
+	for name := range before {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prev, cur := before[name], after[name]
+		if _, ok := after[name]; !ok || cur.UID != prev.UID || prev.Time.IsZero() {
+			continue
+		}
+		switch {
+		case cur.Time.IsZero():
+			tampering = append(tampering, loginTamper{"lastlog_cleared", "critical", map[string]string{
+				"user": name, "previous_time": prev.Time.Format(time.RFC3339),
+			}})
+		case cur.Time.Before(prev.Time.Add(-clockSkewTolerance)):
+			tampering = append(tampering, loginTamper{"time_reversal", "warning", map[string]string{
+				"user": name, "record_time": cur.Time.Format(time.RFC3339), "previous_time": prev.Time.Format(time.RFC3339),
+			}})
+		}
+	}
+	return tampering
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// fileStatKey fingerprints a file's size and modification time
+func fileStatKey(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+}
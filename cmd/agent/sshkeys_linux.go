@@ -0,0 +1,220 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/accounts"
+	"github.com/mulutu/security-manager/internal/sshkeys"
+)
+
+const (
+	sshdConfigPath = "/etc/ssh/sshd_config"
+	// maxAuthorizedKeysSize skips files too large to be real key lists
+	maxAuthorizedKeysSize = 1 << 20
+)
+
+// keyFile is an authorized_keys file sshd would consult for a user
+type keyFile struct {
+	user string
+	uid  int
+	path string
+}
+
+// collectAuthorizedKeys reports keys added to or removed from every user's
+// authorized_keys files, and sends the full key list so the server can tell
+// which hosts trust a key
+func (sc *SecurityCollector) collectAuthorizedKeys() {
+	log.Printf("🔑 Starting SSH authorized_keys monitoring...")
+
+	stateFile := filepath.Join(*stateDir, "ssh_keys.json")
+	var previous []sshkeys.Key
+	baseline := loadState(stateFile, &previous)
+
+	ticker := time.NewTicker(*sshKeysInterval)
+	defer ticker.Stop()
+
+	var lastState string
+	reported := false
+	for {
+		files := authorizedKeyFiles()
+		if state := keyFilesState(files); state != lastState {
+			lastState = state
+			keys := readAuthorizedKeys(files)
+
+			changed := false
+			if baseline {
+				changed = sc.reportKeyChanges(previous, keys, files)
+			}
+			if !reported || changed {
+				sc.sendKeyInventory(keys)
+				saveState(stateFile, keys)
+				reported = true
+			}
+			previous, baseline = keys, true
+		}
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// authorizedKeyFiles resolves the AuthorizedKeysFile setting for every user
+func authorizedKeyFiles() []keyFile {
+	users, err := accounts.ReadUsers("/")
+	if err != nil {
+		log.Printf("Failed to read users: %v", err)
+		return nil
+	}
+	patterns := sshkeys.AuthorizedKeysFiles(sshdConfigPath)
+
+	var files []keyFile
+	for _, u := range users {
+		if u.Home == "" {
+			continue
+		}
+		for _, pattern := range patterns {
+			files = append(files, keyFile{user: u.Name, uid: u.UID, path: sshkeys.ExpandPath(pattern, u.Name, u.Home, u.UID)})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].path != files[j].path {
+			return files[i].path < files[j].path
+		}
+		return files[i].user < files[j].user
+	})
+	return files
+}
+
+// keyFilesState fingerprints sshd_config and the existing key files
+func keyFilesState(files []keyFile) string {
+	var state string
+	for _, path := range []string{sshdConfigPath, "/" + accounts.PasswdFile} {
+		if info, err := os.Stat(path); err == nil {
+			state += fmt.Sprintf("%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	for _, f := range files {
+		if info, err := os.Stat(f.path); err == nil {
+			state += fmt.Sprintf("%s:%s:%d:%d;", f.user, f.path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return state
+}
+
+// readAuthorizedKeys reads and fingerprints the keys of all key files
+func readAuthorizedKeys(files []keyFile) []sshkeys.Key {
+	keys := []sshkeys.Key{}
+	for _, f := range files {
+		info, err := os.Stat(f.path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxAuthorizedKeysSize {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			continue
+		}
+		for _, key := range sshkeys.Parse(data) {
+			key.User, key.File = f.user, f.path
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// reportKeyChanges sends an event per added, removed or re-optioned key and
+// reports whether anything changed
+func (sc *SecurityCollector) reportKeyChanges(before, after []sshkeys.Key, files []keyFile) bool {
+	uids := make(map[string]int)
+	for _, f := range files {
+		uids[f.user] = f.uid
+	}
+
+	old := make(map[string]sshkeys.Key, len(before))
+	for _, k := range before {
+		old[k.ID()] = k
+	}
+	changed := false
+	for _, k := range after {
+		uid, known := uids[k.User]
+		severity := "warning"
+		if known && uid == 0 {
+			severity = "critical"
+		}
+
+		prev, ok := old[k.ID()]
+		if !ok {
+			changed = true
+			sc.sendKeyChange(sshkeys.EventAdded, k, severity, fmt.Sprintf("SSH key added for %s in %s: %s %s", k.User, k.File, k.Fingerprint, k.Comment), nil)
+			continue
+		}
+		delete(old, k.ID())
+		if prev.Options != k.Options {
+			// Dropping command= or from= turns a restricted key into a full login
+			changed = true
+			sc.sendKeyChange(sshkeys.EventModified, k, severity, fmt.Sprintf("SSH key options changed for %s in %s: %s (%s -> %s)",
+				k.User, k.File, k.Fingerprint, optionsText(prev.Options), optionsText(k.Options)),
+				map[string]string{"previous_options": prev.Options})
+		}
+	}
+	for _, k := range old {
+		changed = true
+		sc.sendKeyChange(sshkeys.EventRemoved, k, "info", fmt.Sprintf("SSH key removed for %s from %s: %s %s", k.User, k.File, k.Fingerprint, k.Comment), nil)
+	}
+	return changed
+}
+
+// optionsText renders key options for a message
+func optionsText(options string) string {
+	if options == "" {
+		return "no options"
+	}
+	return options
+}
+
+// sendKeyChange sends one key change on the ssh_keys stream
+func (sc *SecurityCollector) sendKeyChange(eventType string, k sshkeys.Key, severity, message string, extra map[string]string) {
+	labels := map[string]string{
+		"event_type":  eventType,
+		"user":        k.User,
+		"file":        k.File,
+		"fingerprint": k.Fingerprint,
+		"key_type":    k.Type,
+		"comment":     k.Comment,
+		"severity":    severity,
+	}
+	if k.Options != "" {
+		labels["options"] = k.Options
+	}
+	for key, value := range extra {
+		labels[key] = value
+	}
+
+	log.Printf("🔑 %s", message)
+	sc.sendEvent(sshkeys.Stream, message, labels)
+}
+
+// sendKeyInventory sends the full list of authorized keys
+func (sc *SecurityCollector) sendKeyInventory(keys []sshkeys.Key) {
+	data, err := json.Marshal(sshkeys.Inventory{Keys: keys})
+	if err != nil {
+		log.Printf("Failed to encode authorized keys: %v", err)
+		return
+	}
+	sc.sendEvent(sshkeys.Stream, string(data), map[string]string{
+		"event_type": sshkeys.EventInventory,
+		"count":      strconv.Itoa(len(keys)),
+		"severity":   "info",
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// loadState decodes a JSON state file into v, reporting whether a usable
+// state was found. Collectors use it to report changes made while the agent
+// was not running.
+func loadState(file string, v any) bool {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Printf("⚠️ Ignoring unusable state file %s: %v", file, err)
+		return false
+	}
+	return true
+}
+
+// saveState atomically writes v as JSON to a state file readable only by
+// the agent
+func saveState(file string, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(file), 0700)
+	}
+	tmp := file + ".tmp"
+	if err == nil {
+		err = os.WriteFile(tmp, data, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		log.Printf("Failed to save state %s: %v", file, err)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/metrics"
+)
+
+// Threshold levels, in escalation order
+const (
+	levelOK = iota
+	levelWarning
+	levelCritical
+)
+
+var levelNames = []string{"ok", "warning", "critical"}
+
+// jsonDuration is a time.Duration that unmarshals from "5m"-style strings
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(parsed)
+	return nil
+}
+
+// ThresholdRule raises warning/critical events for a metric. Match selects
+// mounts, devices or interfaces by glob; the level must hold for For before
+// firing and recovers only once the value drops Hysteresis below it.
+type ThresholdRule struct {
+	Metric     string       `json:"metric"`
+	Match      string       `json:"match,omitempty"`
+	Warning    *float64     `json:"warning,omitempty"`
+	Critical   *float64     `json:"critical,omitempty"`
+	For        jsonDuration `json:"for,omitempty"`
+	Hysteresis float64      `json:"hysteresis,omitempty"`
+}
+
+// metricInfo describes how a metric is named and extracted from a sample
+type metricInfo struct {
+	label  string
+	unit   string
+	values func(s *metrics.Sample) map[string]float64
+}
+
+var thresholdMetrics = map[string]metricInfo{
+	"cpu": {"CPU usage", "%", func(s *metrics.Sample) map[string]float64 {
+		return map[string]float64{"": s.CPU.Usage}
+	}},
+	"memory": {"memory usage", "%", func(s *metrics.Sample) map[string]float64 {
+		return map[string]float64{"": s.Memory.UsagePercent}
+	}},
+	"swap": {"swap usage", "%", func(s *metrics.Sample) map[string]float64 {
+		if s.Memory.SwapTotalBytes == 0 {
+			return nil
+		}
+		return map[string]float64{"": s.Memory.SwapUsagePercent}
+	}},
+	"load1": {"load average", "", func(s *metrics.Sample) map[string]float64 {
+		return map[string]float64{"": s.Load.Load1}
+	}},
+	"disk": {"disk usage", "%", func(s *metrics.Sample) map[string]float64 {
+		values := make(map[string]float64)
+		for _, fs := range s.Filesystems {
+			values[fs.Mount] = fs.UsagePercent
+		}
+		return values
+	}},
+	"inodes": {"inode usage", "%", func(s *metrics.Sample) map[string]float64 {
+		values := make(map[string]float64)
+		for _, fs := range s.Filesystems {
+			if fs.Inodes > 0 {
+				values[fs.Mount] = fs.InodeUsagePercent
+			}
+		}
+		return values
+	}},
+	"disk_util": {"disk utilization", "%", func(s *metrics.Sample) map[string]float64 {
+		values := make(map[string]float64)
+		for _, d := range s.Disks {
+			values[d.Device] = d.UtilPercent
+		}
+		return values
+	}},
+	"net_rx": {"network receive rate", " B/s", func(s *metrics.Sample) map[string]float64 {
+		values := make(map[string]float64)
+		for _, n := range s.Network {
+			values[n.Interface] = n.RxBytesPerSec
+		}
+		return values
+	}},
+	"net_tx": {"network transmit rate", " B/s", func(s *metrics.Sample) map[string]float64 {
+		values := make(map[string]float64)
+		for _, n := range s.Network {
+			values[n.Interface] = n.TxBytesPerSec
+		}
+		return values
+	}},
+	"net_errors": {"network error rate", "/s", func(s *metrics.Sample) map[string]float64 {
+		values := make(map[string]float64)
+		for _, n := range s.Network {
+			values[n.Interface] = n.RxErrorsPerSec + n.TxErrorsPerSec + n.RxDropsPerSec + n.TxDropsPerSec
+		}
+		return values
+	}},
+}
+
+// defaultThresholdRules apply when the server sends no "thresholds" section
+func defaultThresholdRules() []ThresholdRule {
+	level := func(v float64) *float64 { return &v }
+	return []ThresholdRule{
+		{Metric: "cpu", Warning: level(90), Critical: level(97), For: jsonDuration(5 * time.Minute), Hysteresis: 5},
+		{Metric: "memory", Warning: level(90), Critical: level(95), For: jsonDuration(2 * time.Minute), Hysteresis: 3},
+		{Metric: "swap", Warning: level(80), For: jsonDuration(10 * time.Minute), Hysteresis: 5},
+		{Metric: "disk", Warning: level(85), Critical: level(95), Hysteresis: 2},
+		{Metric: "inodes", Warning: level(85), Critical: level(95), Hysteresis: 2},
+	}
+}
+
+// thresholdRules returns the server-provided rules or the defaults
+func thresholdRules() []ThresholdRule {
+	var rules []ThresholdRule
+	if !serverSection("thresholds", &rules) {
+		return defaultThresholdRules()
+	}
+
+	valid := rules[:0]
+	for _, rule := range rules {
+		if _, ok := thresholdMetrics[rule.Metric]; !ok || (rule.Warning == nil && rule.Critical == nil) {
+			log.Printf("⚠️ Ignoring invalid threshold rule for metric %q", rule.Metric)
+			continue
+		}
+		valid = append(valid, rule)
+	}
+	log.Printf("📏 Using %d server-provided threshold rules", len(valid))
+	return valid
+}
+
+// MetricEvent is an event derived from metric samples
+type MetricEvent struct {
+	Message string
+	Labels  map[string]string
+}
+
+// thresholdState tracks one rule for one target
+type thresholdState struct {
+	level      int
+	aboveSince [3]time.Time // when the value started holding each level
+}
+
+// ThresholdEvaluator applies threshold rules to successive samples
+type ThresholdEvaluator struct {
+	rules  []ThresholdRule
+	states map[string]*thresholdState
+}
+
+// NewThresholdEvaluator creates an evaluator for rules
+func NewThresholdEvaluator(rules []ThresholdRule) *ThresholdEvaluator {
+	return &ThresholdEvaluator{rules: rules, states: make(map[string]*thresholdState)}
+}
+
+// Evaluate returns the events caused by a sample
+func (e *ThresholdEvaluator) Evaluate(s *metrics.Sample) []MetricEvent {
+	var events []MetricEvent
+	now := s.Time
+	seen := make(map[string]bool)
+
+	for i, rule := range e.rules {
+		info := thresholdMetrics[rule.Metric]
+		for target, value := range info.values(s) {
+			if rule.Match != "" {
+				if ok, _ := path.Match(rule.Match, target); !ok {
+					continue
+				}
+			}
+
+			key := fmt.Sprintf("%d|%s", i, target)
+			seen[key] = true
+			st := e.states[key]
+			if st == nil {
+				st = &thresholdState{}
+				e.states[key] = st
+			}
+
+			level := st.advance(rule, value, now)
+			if level == st.level {
+				continue
+			}
+			events = append(events, thresholdEvent(rule, info, target, value, st.level, level))
+			st.level = level
+		}
+	}
+
+	// Forget targets that disappeared, e.g. unmounted filesystems
+	for key := range e.states {
+		if !seen[key] {
+			delete(e.states, key)
+		}
+	}
+	return events
+}
+
+// advance updates the level timers for value and returns the level that has
+// held for the rule's minimum duration
+func (st *thresholdState) advance(rule ThresholdRule, value float64, now time.Time) int {
+	limits := [3]*float64{nil, rule.Warning, rule.Critical}
+	effective := levelOK
+
+	for lvl := levelWarning; lvl <= levelCritical; lvl++ {
+		limit := limits[lvl]
+		if limit == nil {
+			continue
+		}
+
+		// Once at or above a level, stay until the value clears the hysteresis band
+		boundary := *limit
+		if st.level >= lvl {
+			boundary -= rule.Hysteresis
+		}
+
+		if value < boundary {
+			st.aboveSince[lvl] = time.Time{}
+			continue
+		}
+		if st.aboveSince[lvl].IsZero() {
+			st.aboveSince[lvl] = now
+		}
+		if st.level >= lvl || now.Sub(st.aboveSince[lvl]) >= time.Duration(rule.For) {
+			effective = lvl
+		}
+	}
+	return effective
+}
+
+// thresholdEvent describes a level transition
+func thresholdEvent(rule ThresholdRule, info metricInfo, target string, value float64, from, to int) MetricEvent {
+	subject := info.label
+	if target != "" {
+		subject += " on " + target
+	}
+	formatted := fmt.Sprintf("%.1f%s", value, info.unit)
+
+	labels := map[string]string{
+		"event_type":     "metric_threshold",
+		"metric":         rule.Metric,
+		"level":          levelNames[to],
+		"previous_level": levelNames[from],
+		"value":          fmt.Sprintf("%.2f", value),
+		"severity":       levelNames[to],
+	}
+	if target != "" {
+		labels["target"] = target
+	}
+
+	if to == levelOK {
+		labels["event_type"] = "metric_threshold_resolved"
+		labels["severity"] = "info"
+		return MetricEvent{
+			Message: fmt.Sprintf("Resolved: %s back to %s (was %s)", subject, formatted, levelNames[from]),
+			Labels:  labels,
+		}
+	}
+
+	limit := rule.Warning
+	if to == levelCritical {
+		limit = rule.Critical
+	}
+	labels["threshold"] = fmt.Sprintf("%g", *limit)
+
+	return MetricEvent{
+		Message: fmt.Sprintf("High %s: %s (%s ≥ %g%s)", subject, formatted, levelNames[to], *limit, strings.TrimSpace(info.unit)),
+		Labels:  labels,
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// agentConfigPrefix prefixes the Authenticate response headers that carry
+// collector configuration to agents
+const agentConfigPrefix = "sm-config-"
+
+// hostGroupHeader is the request metadata key an agent uses to declare its
+// host group
+const hostGroupHeader = "sm-host-group"
+
+// AgentConfig holds the collector configuration pushed to agents at
+// authentication. Sections (e.g. "journal", "thresholds") apply to every
+// agent; each matching host group then overrides whole sections.
+//
+//	{
+//	  "thresholds": [{"metric": "cpu", "warning": 90}],
+//	  "groups": [
+//	    {"name": "db", "hosts": ["db-*"], "config": {"thresholds": [...]}}
+//	  ]
+//	}
+type AgentConfig struct {
+	Sections map[string]json.RawMessage
+	Groups   []HostGroup
+}
+
+// HostGroup applies config sections to agents that declare the group name or
+// whose hostname matches one of the Hosts globs
+type HostGroup struct {
+	Name   string                     `json:"name"`
+	Hosts  []string                   `json:"hosts,omitempty"`
+	Config map[string]json.RawMessage `json:"config"`
+}
+
+// loadAgentConfig reads the agent config file named by AGENT_CONFIG_FILE
+func loadAgentConfig() (*AgentConfig, error) {
+	path := os.Getenv("AGENT_CONFIG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &AgentConfig{}
+	if err := json.Unmarshal(data, &cfg.Sections); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if groups, ok := cfg.Sections["groups"]; ok {
+		if err := json.Unmarshal(groups, &cfg.Groups); err != nil {
+			return nil, fmt.Errorf("parse %s groups: %w", path, err)
+		}
+		delete(cfg.Sections, "groups")
+	}
+	return cfg, nil
+}
+
+// Header encodes the config sections for an agent as gRPC response metadata
+func (c *AgentConfig) Header(hostname, group string) metadata.MD {
+	sections := make(map[string]json.RawMessage, len(c.Sections))
+	for name, raw := range c.Sections {
+		sections[name] = raw
+	}
+	for _, g := range c.Groups {
+		if !g.matches(hostname, group) {
+			continue
+		}
+		for name, raw := range g.Config {
+			sections[name] = raw
+		}
+	}
+
+	md := metadata.MD{}
+	for name, raw := range sections {
+		md.Set(agentConfigPrefix+name, string(raw))
+	}
+	return md
+}
+
+// matches reports whether an agent belongs to the group
+func (g HostGroup) matches(hostname, group string) bool {
+	if group != "" && group == g.Name {
+		return true
+	}
+	for _, pattern := range g.Hosts {
+		if ok, _ := path.Match(pattern, hostname); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHostGroup returns the host group declared in the request metadata
+func requestHostGroup(md metadata.MD) string {
+	if values := md.Get(hostGroupHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+
+	"github.com/mulutu/security-manager/internal/inventory"
+	"github.com/mulutu/security-manager/internal/proto"
+)
+
+// storeInventory saves an inventory event on the agent record
+func (s *ingestServer) storeInventory(event *proto.LogEvent) {
+	inv, err := inventory.Decode(event.Message)
+	if err != nil {
+		log.Printf("⚠️  Invalid inventory from %s/%s: %v", event.OrgId, event.HostId, err)
+		return
+	}
+
+	if err := s.db.UpdateAgentInventory(event.OrgId, event.HostId, []byte(event.Message), inv.CollectedAt, inv.PrimaryIP); err != nil {
+		log.Printf("⚠️  Failed to store inventory: %v", err)
+		return
+	}
+	log.Printf("🗂️  Inventory updated: %s/%s (%s, %s)", event.OrgId, event.HostId, inv.OS.PrettyName, inv.Kernel.Release)
+
+	// The OS release selects which advisories apply
+	if s.vulns != nil {
+		s.vulns.evaluateHost(event.OrgId, event.HostId)
+	}
+}
@@ -12,11 +12,18 @@ import (
 	"time"
 
 	"github.com/mulutu/security-manager/internal/database"
+	"github.com/mulutu/security-manager/internal/inventory"
+	"github.com/mulutu/security-manager/internal/metrics"
+	"github.com/mulutu/security-manager/internal/packages"
 	"github.com/mulutu/security-manager/internal/proto"
+	"github.com/mulutu/security-manager/internal/sshkeys"
 	"github.com/nats-io/nats.go"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 const subjFmt = "logs.%s.%s" // org_id, host_id
@@ -29,23 +36,52 @@ func validateToken(token string) string {
 		return "demo"
 	}
 
-	// Validate production token format: sm_orgid_timestamp_hostid
-	re := regexp.MustCompile(`^sm_([^_]+)_[0-9]+_.+$`)
-	matches := re.FindStringSubmatch(token)
+	orgID, _ := tokenParts(token)
+	return orgID
+}
+
+// Stream metadata keys identifying the agent on StreamEvents, which has no
+// request message of its own
+const (
+	tokenHeader   = "sm-token"
+	agentIDHeader = "sm-agent-id"
+)
 
-	if len(matches) >= 2 {
-		return matches[1] // Return the org_id
+// streamIdentity validates the token sent in stream metadata and returns the
+// org and agent the stream's events must belong to
+func streamIdentity(md metadata.MD) (orgID, hostID string, ok bool) {
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
 	}
+	orgID = validateToken(first(tokenHeader))
+	hostID = first(agentIDHeader)
+	return orgID, hostID, orgID != "" && hostID != ""
+}
 
-	return "" // Invalid token format
+// tokenPattern matches production tokens: sm_orgid_timestamp_hostid
+var tokenPattern = regexp.MustCompile(`^sm_([^_]+)_[0-9]+_(.+)$`)
+
+// tokenParts returns the org ID and host suffix of a production token
+func tokenParts(token string) (orgID, hostID string) {
+	matches := tokenPattern.FindStringSubmatch(token)
+	if len(matches) < 3 {
+		return "", ""
+	}
+	return matches[1], matches[2]
 }
 
 // ─── gRPC server implementation ──────────────────────────────────────────
 
 type ingestServer struct {
 	proto.UnimplementedAgentIngestServer
-	js nats.JetStreamContext
-	db *database.DB
+	js          nats.JetStreamContext
+	db          *database.DB
+	agentConfig *AgentConfig
+	vulns       *vulnMatcher
+	rules       *RulesEngine
 }
 
 func (s *ingestServer) Authenticate(ctx context.Context, req *proto.AuthRequest) (*proto.AuthResponse, error) {
@@ -68,13 +104,31 @@ func (s *ingestServer) Authenticate(ctx context.Context, req *proto.AuthRequest)
 		}, nil
 	}
 
+	// Agents identify themselves with a persistent ID; older agents only
+	// send their hostname
+	hostID := req.AgentId
+	if hostID == "" {
+		hostID = req.Hostname
+	} else if _, tokenHost := tokenParts(req.Token); tokenHost != "" && s.db != nil {
+		// Take over the row an earlier agent version registered under this
+		// token's host instead of creating a duplicate. Only the token's
+		// own host is eligible: the client-supplied hostname would let any
+		// token in the org claim another host's history. Rows keyed by a
+		// different hostname are re-keyed with tools/agent_rekey.
+		if adopted, err := s.db.AdoptLegacyAgent(req.OrgId, hostID, tokenHost); err != nil {
+			log.Printf("⚠️  Legacy agent adoption failed: %v", err)
+		} else if adopted {
+			log.Printf("🔁 Re-keyed legacy agent %s to %s", tokenHost, hostID)
+		}
+	}
+
 	// Auto-register the agent if system info is provided
 	var agentID string
 	var registered bool
-	if req.Hostname != "" && req.IpAddress != "" && s.db != nil {
+	if hostID != "" && req.Hostname != "" && req.IpAddress != "" && s.db != nil {
 		agent, err := s.db.UpsertAgent(
 			req.OrgId,
-			req.Hostname, // Use hostname as hostId
+			hostID,
 			req.Hostname,
 			req.IpAddress,
 			req.OsType,
@@ -93,8 +147,17 @@ func (s *ingestServer) Authenticate(ctx context.Context, req *proto.AuthRequest)
 		}
 	}
 
-	log.Printf("✅ Agent authenticated: org=%s, version=%s, hostname=%s, ip=%s",
-		req.OrgId, req.AgentVersion, req.Hostname, req.IpAddress)
+	log.Printf("✅ Agent authenticated: org=%s, agent=%s, version=%s, hostname=%s, ip=%s",
+		req.OrgId, hostID, req.AgentVersion, req.Hostname, req.IpAddress)
+
+	// Push collector configuration (journal filters, thresholds, ...) to the agent
+	if s.agentConfig != nil {
+		md, _ := metadata.FromIncomingContext(ctx)
+		header := s.agentConfig.Header(req.Hostname, requestHostGroup(md))
+		if err := grpc.SetHeader(ctx, header); err != nil {
+			log.Printf("⚠️  Failed to send agent config: %v", err)
+		}
+	}
 
 	return &proto.AuthResponse{
 		Authenticated:            true,
@@ -105,14 +168,31 @@ func (s *ingestServer) Authenticate(ctx context.Context, req *proto.AuthRequest)
 }
 
 func (s *ingestServer) StreamEvents(stream proto.AgentIngest_StreamEventsServer) error {
-	log.Printf("📡 New stream connection established")
+	// Events are written to the database under their org and host, so the
+	// stream is bound to the identity its token establishes
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	orgID, hostID, ok := streamIdentity(md)
+	if !ok {
+		log.Printf("Stream rejected: missing or invalid token")
+		return status.Error(codes.Unauthenticated, "stream requires a valid token and agent ID")
+	}
+	log.Printf("📡 New stream connection established: %s/%s", orgID, hostID)
 
+	rejected := 0
 	for {
 		event, err := stream.Recv()
 		if err != nil {
 			log.Printf("Stream ended: %v", err)
 			break
 		}
+		if event.OrgId != orgID || event.HostId != hostID {
+			if rejected == 0 {
+				log.Printf("⚠️  Stream %s/%s sent an event for %s/%s, dropping events for other agents",
+					orgID, hostID, event.OrgId, event.HostId)
+			}
+			rejected++
+			continue
+		}
 
 		// Update agent status to ONLINE when we receive events
 		if s.db != nil && event.Stream == "heartbeat" {
@@ -121,13 +201,55 @@ func (s *ingestServer) StreamEvents(stream proto.AgentIngest_StreamEventsServer)
 			}
 		}
 
+		// Persist metric samples for the dashboard history
+		if event.Stream == metrics.Stream {
+			if s.db != nil {
+				s.storeMetricSample(event)
+			}
+			continue
+		}
+
+		// Keep the latest inventory snapshot on the agent record
+		if event.Stream == inventory.Stream {
+			if s.db != nil {
+				s.storeInventory(event)
+			}
+			continue
+		}
+
+		// Keep the installed package list; change events are logged below
+		if event.Stream == packages.Stream && event.Labels["event_type"] == packages.EventInventory {
+			if s.db != nil {
+				s.storePackageInventory(event)
+			}
+			continue
+		}
+
+		// Keep the authorized key list for the fleet-wide key view
+		if event.Stream == sshkeys.Stream && event.Labels["event_type"] == sshkeys.EventInventory {
+			if s.db != nil {
+				s.storeAuthorizedKeys(event)
+			}
+			continue
+		}
+		if event.Stream == sshkeys.Stream && event.Labels["event_type"] == sshkeys.EventAdded && s.db != nil {
+			s.logKeyTrust(event)
+		}
+
 		log.Printf("📊 Event: %s/%s [%s] %s",
 			event.OrgId, event.HostId, event.Stream, event.Message)
 
+		if s.rules != nil {
+			s.rules.processEvent(event)
+		}
+
 		// TODO: Store in ClickHouse
 		// TODO: Publish to NATS for real-time processing
 	}
 
+	if rejected > 0 {
+		log.Printf("⚠️  Dropped %d events from %s/%s for other agents", rejected, orgID, hostID)
+	}
 	return stream.SendAndClose(&proto.Ack{})
 }
 
@@ -164,6 +286,29 @@ func main() {
 		}
 	}()
 
+	// Downsample stored metrics in the background
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	if db != nil {
+		go runMetricRollups(backgroundCtx, db)
+	}
+
+	// Match host packages against imported advisories
+	vulns := newVulnMatcher(db)
+	if vulns != nil {
+		go vulns.run(backgroundCtx)
+	}
+
+	// Match incoming events against the detection rules
+	rules := NewRulesEngine(backgroundCtx, nil, db)
+	log.Printf("🔍 Rules engine running %d rules on incoming events", len(rules.rules))
+
+	// Load collector configuration pushed to agents
+	agentConfig, err := loadAgentConfig()
+	if err != nil {
+		log.Fatalf("Failed to load agent config: %v", err)
+	}
+
 	// TODO: Connect to ClickHouse for event storage
 	// TODO: Connect to NATS for real-time event streaming
 
@@ -195,8 +340,11 @@ func main() {
 
 	// Register our service
 	proto.RegisterAgentIngestServer(s, &ingestServer{
-		js: nil, // TODO: Initialize NATS JetStream
-		db: db,
+		js:          nil, // TODO: Initialize NATS JetStream
+		db:          db,
+		agentConfig: agentConfig,
+		vulns:       vulns,
+		rules:       rules,
 	})
 
 	// Graceful shutdown
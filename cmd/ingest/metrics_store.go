@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/database"
+	"github.com/mulutu/security-manager/internal/metrics"
+	"github.com/mulutu/security-manager/internal/proto"
+)
+
+// rollupInterval is how often rollups and retention run
+const rollupInterval = time.Minute
+
+// rollupLevel describes one rollup resolution and how long it is kept
+type rollupLevel struct {
+	resolution string
+	period     time.Duration
+	retention  time.Duration
+}
+
+// storeMetricSample persists a metrics sample event as a SystemMetric row
+func (s *ingestServer) storeMetricSample(event *proto.LogEvent) {
+	sample, err := metrics.Decode(event.Message)
+	if err != nil {
+		log.Printf("⚠️  Invalid metrics sample from %s/%s: %v", event.OrgId, event.HostId, err)
+		return
+	}
+
+	ts := sample.Time
+	if ts.IsZero() {
+		ts = time.Unix(0, event.TsUnixNs)
+	}
+
+	err = s.db.InsertSystemMetric(event.OrgId, event.HostId, database.SystemMetric{
+		CPUUsage:    sample.CPU.Usage,
+		MemoryUsage: sample.Memory.UsagePercent,
+		DiskUsage:   sample.DiskUsage(),
+		NetworkIn:   sample.NetworkIn(),
+		NetworkOut:  sample.NetworkOut(),
+		Timestamp:   ts,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to store metrics sample: %v", err)
+	}
+}
+
+// runMetricRollups downsamples SystemMetric samples into minute, hour and
+// day rollups and enforces per-resolution retention until ctx ends
+func runMetricRollups(ctx context.Context, db *database.DB) {
+	rawRetention := getEnvDuration("METRICS_RETENTION_RAW", 48*time.Hour)
+	levels := []rollupLevel{
+		{database.ResolutionMinute, time.Minute, getEnvDuration("METRICS_RETENTION_MINUTE", 7*24*time.Hour)},
+		{database.ResolutionHour, time.Hour, getEnvDuration("METRICS_RETENTION_HOUR", 90*24*time.Hour)},
+		{database.ResolutionDay, 24 * time.Hour, getEnvDuration("METRICS_RETENTION_DAY", 2*365*24*time.Hour)},
+	}
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UTC()
+
+		// Recompute the current and previous bucket of each level so late
+		// samples and the finer level's latest buckets are included
+		for _, level := range levels {
+			since := now.Truncate(level.period).Add(-level.period)
+			if _, err := db.RollupSystemMetrics(level.resolution, since); err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+		}
+
+		if _, err := db.PruneSystemMetrics("", now.Add(-rawRetention)); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+		for _, level := range levels {
+			if _, err := db.PruneSystemMetrics(level.resolution, now.Add(-level.retention)); err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getEnvDuration reads a duration from the environment
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("⚠️  Invalid duration for %s: %q", key, value)
+	}
+	return defaultValue
+}
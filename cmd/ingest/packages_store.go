@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+
+	"github.com/mulutu/security-manager/internal/database"
+	"github.com/mulutu/security-manager/internal/packages"
+	"github.com/mulutu/security-manager/internal/proto"
+)
+
+// storePackageInventory replaces the host's stored package list with the
+// inventory carried by the event
+func (s *ingestServer) storePackageInventory(event *proto.LogEvent) {
+	inv, err := packages.Decode(event.Message)
+	if err != nil {
+		log.Printf("⚠️  Invalid package inventory from %s/%s: %v", event.OrgId, event.HostId, err)
+		return
+	}
+
+	pkgs := make([]database.HostPackage, len(inv.Packages))
+	for i, p := range inv.Packages {
+		pkgs[i] = database.HostPackage{Name: p.Name, Version: p.Version, Arch: p.Arch, Source: p.Source, InstalledAt: p.InstalledAt}
+	}
+	if err := s.db.ReplaceHostPackages(event.OrgId, event.HostId, inv.Manager, pkgs); err != nil {
+		log.Printf("⚠️  Failed to store package inventory: %v", err)
+		return
+	}
+	log.Printf("📦 Package inventory updated: %s/%s (%d %s packages)", event.OrgId, event.HostId, len(pkgs), inv.Manager)
+
+	if s.vulns != nil {
+		s.vulns.evaluateHost(event.OrgId, event.HostId)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"log"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/mulutu/security-manager/internal/database"
 	"github.com/mulutu/security-manager/internal/proto"
 	"github.com/nats-io/nats.go"
 	gproto "google.golang.org/protobuf/proto"
@@ -18,8 +20,10 @@ import (
 // RulesEngine handles security detection and response
 type RulesEngine struct {
 	js          nats.JetStreamContext
+	db          *database.DB
 	rules       []DetectionRule
 	alertCounts map[string]int
+	alertStarts map[string]time.Time
 	alertMutex  sync.RWMutex
 	ctx         context.Context
 	mitigations chan MitigationRequest
@@ -37,6 +41,15 @@ type DetectionRule struct {
 	TimeWindow  time.Duration
 	Action      string
 	Enabled     bool
+	// Labels must all match the event's labels; used instead of, or in
+	// addition to, Pattern for agents that send structured events
+	Labels map[string]*regexp.Regexp
+	// Exclude skips events whose labels match every condition in it
+	Exclude map[string]*regexp.Regexp
+	// GroupBy counts matches separately per value of this label (e.g. source_ip)
+	GroupBy string
+	// TargetLabel names the label holding the mitigation target
+	TargetLabel string
 }
 
 // MitigationRequest represents a mitigation action to be taken
@@ -51,18 +64,23 @@ type MitigationRequest struct {
 	RequestID string
 }
 
-// NewRulesEngine creates a new rules engine
-func NewRulesEngine(ctx context.Context, js nats.JetStreamContext) *RulesEngine {
+// NewRulesEngine creates a new rules engine. js may be nil while the ingest
+// service runs without NATS, and db without a database; alerts are then not
+// published or stored.
+func NewRulesEngine(ctx context.Context, js nats.JetStreamContext, db *database.DB) *RulesEngine {
 	engine := &RulesEngine{
 		js:          js,
+		db:          db,
 		rules:       getDefaultRules(),
 		alertCounts: make(map[string]int),
+		alertStarts: make(map[string]time.Time),
 		ctx:         ctx,
 		mitigations: make(chan MitigationRequest, 100),
 	}
 
 	// Start mitigation processor
 	go engine.processMitigations()
+	go engine.evictExpiredCounts()
 
 	return engine
 }
@@ -116,18 +134,45 @@ func (re *RulesEngine) processEvent(event *proto.LogEvent) {
 			continue
 		}
 
-		// Check if pattern matches
-		if rule.Pattern.MatchString(event.Message) {
-			re.handleRuleMatch(rule, event)
+		// Check if pattern and label conditions match
+		if rule.Pattern != nil && !rule.Pattern.MatchString(event.Message) {
+			continue
+		}
+		if !matchLabels(rule.Labels, event.Labels) {
+			continue
+		}
+		if len(rule.Exclude) > 0 && matchLabels(rule.Exclude, event.Labels) {
+			continue
 		}
+		re.handleRuleMatch(rule, event)
 	}
 }
 
+// matchLabels reports whether every label condition matches
+func matchLabels(conditions map[string]*regexp.Regexp, labels map[string]string) bool {
+	for key, re := range conditions {
+		value, ok := labels[key]
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
 // handleRuleMatch processes a rule match and determines actions
 func (re *RulesEngine) handleRuleMatch(rule DetectionRule, event *proto.LogEvent) {
 	alertKey := fmt.Sprintf("%s:%s:%s", rule.ID, event.OrgId, event.HostId)
+	if rule.GroupBy != "" {
+		alertKey += ":" + event.Labels[rule.GroupBy]
+	}
 
 	re.alertMutex.Lock()
+	// Start a new count once the rule's time window has passed
+	now := time.Now()
+	if start, ok := re.alertStarts[alertKey]; !ok || (rule.TimeWindow > 0 && now.Sub(start) > rule.TimeWindow) {
+		re.alertStarts[alertKey] = now
+		re.alertCounts[alertKey] = 0
+	}
 	re.alertCounts[alertKey]++
 	count := re.alertCounts[alertKey]
 	re.alertMutex.Unlock()
@@ -148,12 +193,63 @@ func (re *RulesEngine) handleRuleMatch(rule DetectionRule, event *proto.LogEvent
 		// Reset counter
 		re.alertMutex.Lock()
 		delete(re.alertCounts, alertKey)
+		delete(re.alertStarts, alertKey)
 		re.alertMutex.Unlock()
 	}
 }
 
-// sendAlert sends an alert notification
+// evictExpiredCounts periodically drops counters whose rule window has
+// passed. GroupBy values come from the agent's events, so counters for
+// values that never reach the threshold (one failed login from each of many
+// source IPs) would otherwise pile up. Rules without a window count forever
+// and are left alone.
+func (re *RulesEngine) evictExpiredCounts() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-re.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		windows := make(map[string]time.Duration, len(re.rules))
+		for _, rule := range re.rules {
+			windows[rule.ID] = rule.TimeWindow
+		}
+
+		now := time.Now()
+		re.alertMutex.Lock()
+		for key, start := range re.alertStarts {
+			ruleID, _, _ := strings.Cut(key, ":")
+			if window := windows[ruleID]; window > 0 && now.Sub(start) > window {
+				delete(re.alertCounts, key)
+				delete(re.alertStarts, key)
+			}
+		}
+		re.alertMutex.Unlock()
+	}
+}
+
+// sendAlert stores an alert as a SecurityAlert and publishes it
 func (re *RulesEngine) sendAlert(rule DetectionRule, event *proto.LogEvent, count int) {
+	metadata := alertMetadata(event)
+	if re.db != nil {
+		data, _ := json.Marshal(metadata)
+		_, err := re.db.InsertSecurityAlert(event.OrgId, database.SecurityAlert{
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			Severity: alertSeverity(rule.Severity),
+			Message:  event.Message,
+			HostID:   event.HostId,
+			Metadata: data,
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to store alert %s for %s/%s: %v", rule.ID, event.OrgId, event.HostId, err)
+		}
+	}
+
 	alert := map[string]interface{}{
 		"rule_id":     rule.ID,
 		"rule_name":   rule.Name,
@@ -165,17 +261,57 @@ func (re *RulesEngine) sendAlert(rule DetectionRule, event *proto.LogEvent, coun
 		"stream":      event.Stream,
 		"count":       count,
 		"description": rule.Description,
+		"metadata":    metadata,
 	}
 
 	// Publish alert to NATS
 	subject := fmt.Sprintf("alerts.%s.%s", event.OrgId, rule.Severity)
-	if data, err := json.Marshal(alert); err == nil {
+	if data, err := json.Marshal(alert); err == nil && re.js != nil {
 		re.js.PublishAsync(subject, data)
 	}
 
 	log.Printf("📢 Alert sent: %s - %s", rule.Name, event.Message)
 }
 
+// alertMetadata is the structured context stored in SecurityAlert.metadata
+// and published with each alert: the event's labels, with the process
+// ancestry chain decoded so it can be shown as sshd → bash → curl → sh.
+func alertMetadata(event *proto.LogEvent) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	labels := make(map[string]string, len(event.Labels))
+	for k, v := range event.Labels {
+		labels[k] = v
+	}
+
+	if raw, ok := labels["ancestry"]; ok {
+		var chain []map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &chain); err == nil {
+			metadata["ancestry"] = chain
+			delete(labels, "ancestry")
+		}
+	}
+	if tree, ok := labels["process_tree"]; ok {
+		metadata["process_tree"] = tree
+	}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	return metadata
+}
+
+// alertSeverity maps a rule severity to the AlertSeverity enum
+func alertSeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical":
+		return database.AlertSeverityCritical
+	case "high":
+		return database.AlertSeverityHigh
+	case "low", "info":
+		return database.AlertSeverityLow
+	}
+	return database.AlertSeverityMedium
+}
+
 // executeMitigation triggers a mitigation action
 func (re *RulesEngine) executeMitigation(rule DetectionRule, event *proto.LogEvent) {
 	requestID := fmt.Sprintf("mit_%d", time.Now().UnixNano())
@@ -244,7 +380,9 @@ func (re *RulesEngine) sendMitigationCommand(mitigation MitigationRequest) {
 		}
 	}
 
-	if protoReq != nil {
+	if protoReq != nil && re.js == nil {
+		log.Printf("⚠️ No command channel, mitigation %s not sent", mitigation.RequestID)
+	} else if protoReq != nil {
 		// Send command via NATS
 		subject := fmt.Sprintf("commands.%s.%s", mitigation.OrgID, mitigation.HostID)
 		if data, err := gproto.Marshal(protoReq); err == nil {
@@ -256,6 +394,10 @@ func (re *RulesEngine) sendMitigationCommand(mitigation MitigationRequest) {
 
 // extractTarget extracts the target (IP, PID, etc.) from the event based on the rule
 func (re *RulesEngine) extractTarget(rule DetectionRule, event *proto.LogEvent) string {
+	if rule.TargetLabel != "" && event.Labels[rule.TargetLabel] != "" {
+		return event.Labels[rule.TargetLabel]
+	}
+
 	switch rule.Action {
 	case "block_ip":
 		// Extract IP from message using regex
@@ -281,36 +423,77 @@ func getDefaultRules() []DetectionRule {
 			Name:        "SSH Brute Force Attack",
 			Description: "Multiple failed SSH login attempts detected",
 			Severity:    "critical",
-			Pattern:     regexp.MustCompile(`Failed password for .* from (\d+\.\d+\.\d+\.\d+)`),
 			Stream:      "auth",
 			Threshold:   5,
 			TimeWindow:  5 * time.Minute,
 			Action:      "block_ip",
 			Enabled:     true,
+			// sshd logs one attempt as several lines, so each failed
+			// password or key for an existing user is counted, and each
+			// connection for an unknown user once through its "Invalid
+			// user" line. Hosts without password authentication log
+			// nothing else for unknown users.
+			Labels: map[string]*regexp.Regexp{
+				"program":    regexp.MustCompile(`^sshd(-session)?$`),
+				"event_type": regexp.MustCompile(`^(login_failure|invalid_user)$`),
+				"source_ip":  regexp.MustCompile(`.`),
+			},
+			Exclude: map[string]*regexp.Regexp{
+				"event_type":   regexp.MustCompile(`^login_failure$`),
+				"invalid_user": regexp.MustCompile(`^true$`),
+			},
+			GroupBy:     "source_ip",
+			TargetLabel: "source_ip",
+		},
+		{
+			ID:          "service_brute_force",
+			Name:        "Service Brute Force Attack",
+			Description: "Multiple failed logins against a mail, FTP, database or web service",
+			Severity:    "critical",
+			Stream:      "auth",
+			Threshold:   10,
+			TimeWindow:  5 * time.Minute,
+			Action:      "block_ip",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"service":     regexp.MustCompile(`^(postfix|dovecot|vsftpd|mysql|postgresql|nginx|wordpress)$`),
+				"auth_result": regexp.MustCompile(`^failure$`),
+				"source_ip":   regexp.MustCompile(`.`),
+			},
+			GroupBy:     "source_ip",
+			TargetLabel: "source_ip",
 		},
 		{
 			ID:          "high_cpu_usage",
 			Name:        "High CPU Usage",
-			Description: "CPU usage exceeds 90%",
+			Description: "CPU usage stayed above the agent's threshold",
 			Severity:    "warning",
-			Pattern:     regexp.MustCompile(`High CPU usage: (\d+\.\d+)%`),
 			Stream:      "system",
-			Threshold:   3,
+			Threshold:   1,
 			TimeWindow:  10 * time.Minute,
 			Action:      "",
 			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^metric_threshold$`),
+				"metric":     regexp.MustCompile(`^cpu$`),
+			},
 		},
 		{
 			ID:          "disk_full",
 			Name:        "Disk Space Critical",
-			Description: "Disk usage exceeds 85%",
+			Description: "Filesystem space or inodes reached the critical threshold",
 			Severity:    "critical",
-			Pattern:     regexp.MustCompile(`High disk usage: (\d+\.\d+)%`),
 			Stream:      "system",
 			Threshold:   1,
 			TimeWindow:  1 * time.Minute,
 			Action:      "",
 			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^metric_threshold$`),
+				"metric":     regexp.MustCompile(`^(disk|inodes)$`),
+				"level":      regexp.MustCompile(`^critical$`),
+			},
+			GroupBy: "target",
 		},
 		{
 			ID:          "memory_oom",
@@ -372,6 +555,179 @@ func getDefaultRules() []DetectionRule {
 			Action:      "",
 			Enabled:     true,
 		},
+		{
+			ID:          "reverse_shell",
+			Name:        "Reverse Shell or Web Shell",
+			Description: "Agent heuristics found a shell on a network socket, network code run inline, or a shell spawned by a web server",
+			Severity:    "critical",
+			Stream:      "process",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^suspicious_process$`),
+				"severity":   regexp.MustCompile(`^critical$`),
+			},
+			GroupBy: "pid",
+		},
+		{
+			ID:          "cryptominer",
+			Name:        "Cryptominer Running",
+			Description: "A process matched several cryptominer indicators: sustained CPU, pool connections, miner names or hashes, stratum command lines",
+			Severity:    "critical",
+			Stream:      "process",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^cryptominer_detected$`),
+			},
+			GroupBy: "pid",
+		},
+		{
+			ID:          "suspicious_package_install",
+			Name:        "Suspicious Package Installed",
+			Description: "A scanner, attack tool or compiler was installed",
+			Severity:    "warning",
+			Stream:      "packages",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^package_installed$`),
+				"suspicious": regexp.MustCompile(`^true$`),
+			},
+			GroupBy: "package",
+		},
+		{
+			ID:          "account_privilege_backdoor",
+			Name:        "Privileged Account Backdoor",
+			Description: "A UID 0 account, passwordless account or NOPASSWD sudo rule was created",
+			Severity:    "critical",
+			Stream:      "accounts",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^(uid0_account_created|password_removed|sudo_nopasswd_added)$`),
+			},
+		},
+		{
+			ID:          "privileged_group_member_added",
+			Name:        "User Added to Privileged Group",
+			Description: "A user was added to sudo, wheel or another root-equivalent group",
+			Severity:    "warning",
+			Stream:      "accounts",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^group_member_added$`),
+				"privileged": regexp.MustCompile(`^true$`),
+			},
+			GroupBy: "user",
+		},
+		{
+			ID:          "root_ssh_key_added",
+			Name:        "SSH Key Added for Root",
+			Description: "A key was added to root's authorized_keys",
+			Severity:    "critical",
+			Stream:      "ssh_keys",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^ssh_key_added$`),
+				"user":       regexp.MustCompile(`^root$`),
+			},
+			GroupBy: "fingerprint",
+		},
+		{
+			ID:          "preload_persistence",
+			Name:        "Library Preload Configured",
+			Description: "/etc/ld.so.preload was created or changed, injecting a library into every process",
+			Severity:    "critical",
+			Stream:      "persistence",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^persistence_(added|modified)$`),
+				"path":       regexp.MustCompile(`^/etc/ld\.so\.preload$`),
+			},
+			GroupBy: "path",
+		},
+		{
+			ID:          "untrusted_kernel_module",
+			Name:        "Untrusted Kernel Module Loaded",
+			Description: "An unsigned kernel module, or one not from the installed module tree, was loaded",
+			Severity:    "critical",
+			Stream:      "kernel_modules",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^kernel_module_loaded$`),
+				"signature":  regexp.MustCompile(`^(unsigned|unknown)$`),
+			},
+			GroupBy: "module",
+		},
+		{
+			ID:          "rootkit_indicator",
+			Name:        "Rootkit Indicator Detected",
+			Description: "An integrity check found a hidden process, fileless executable, preloaded library, sniffing interface or hidden file in /dev",
+			Severity:    "critical",
+			Stream:      "integrity",
+			Threshold:   1,
+			TimeWindow:  5 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^integrity_`),
+				"severity":   regexp.MustCompile(`^critical$`),
+			},
+			GroupBy: "check",
+		},
+		{
+			ID:          "suid_in_writable_location",
+			Name:        "SUID Binary in User-Writable Location",
+			Description: "A new SUID/SGID file appeared in a temporary or home directory, or a system directory became world-writable",
+			Severity:    "critical",
+			Stream:      "fs_audit",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^fs_audit_(added|changed)$`),
+				"severity":   regexp.MustCompile(`^critical$`),
+			},
+			GroupBy: "path",
+		},
+		{
+			ID:          "login_records_tampered",
+			Name:        "Login Records Tampered",
+			Description: "wtmp, btmp or lastlog was truncated, cleared, replaced or had records wiped, hiding login history",
+			Severity:    "critical",
+			Stream:      "sessions",
+			Threshold:   1,
+			TimeWindow:  1 * time.Minute,
+			Action:      "",
+			Enabled:     true,
+			Labels: map[string]*regexp.Regexp{
+				"event_type": regexp.MustCompile(`^session_log_tampered$`),
+				"severity":   regexp.MustCompile(`^critical$`),
+			},
+			GroupBy: "file",
+		},
 	}
 }
 
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/mulutu/security-manager/internal/database"
+	"github.com/mulutu/security-manager/internal/proto"
+	"github.com/mulutu/security-manager/internal/sshkeys"
+)
+
+// storeAuthorizedKeys replaces the host's stored authorized keys with the
+// inventory carried by the event
+func (s *ingestServer) storeAuthorizedKeys(event *proto.LogEvent) {
+	var inv sshkeys.Inventory
+	if err := json.Unmarshal([]byte(event.Message), &inv); err != nil {
+		log.Printf("⚠️  Invalid authorized key inventory from %s/%s: %v", event.OrgId, event.HostId, err)
+		return
+	}
+
+	keys := make([]database.AuthorizedKey, len(inv.Keys))
+	for i, k := range inv.Keys {
+		keys[i] = database.AuthorizedKey{
+			User:        k.User,
+			File:        k.File,
+			Fingerprint: k.Fingerprint,
+			KeyType:     k.Type,
+			Comment:     k.Comment,
+			Options:     k.Options,
+		}
+	}
+	if err := s.db.ReplaceAuthorizedKeys(event.OrgId, event.HostId, keys); err != nil {
+		log.Printf("⚠️  Failed to store authorized keys: %v", err)
+		return
+	}
+	log.Printf("🔑 Authorized keys updated: %s/%s (%d keys)", event.OrgId, event.HostId, len(keys))
+}
+
+// logKeyTrust notes how widely a newly added key is already trusted
+func (s *ingestServer) logKeyTrust(event *proto.LogEvent) {
+	fingerprint := event.Labels["fingerprint"]
+	trusted, err := s.db.HostsTrustingKey(event.OrgId, fingerprint)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	hosts := make(map[string]bool)
+	for _, k := range trusted {
+		if k.HostID != event.HostId {
+			hosts[k.HostID] = true
+		}
+	}
+	log.Printf("🔑 Key %s added on %s/%s is also trusted by %d other hosts",
+		fingerprint, event.OrgId, event.HostId, len(hosts))
+}
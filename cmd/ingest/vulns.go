@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/database"
+	"github.com/mulutu/security-manager/internal/osv"
+	"github.com/mulutu/security-manager/internal/packages"
+)
+
+// vulnMatcher matches stored host packages against the OSV advisories
+// imported into ADVISORY_DIR, reloading them when the directory changes
+type vulnMatcher struct {
+	db         *database.DB
+	dir        string
+	advisories atomic.Pointer[osv.Database]
+}
+
+// newVulnMatcher returns a matcher for ADVISORY_DIR, or nil when unset
+func newVulnMatcher(db *database.DB) *vulnMatcher {
+	dir := os.Getenv("ADVISORY_DIR")
+	if dir == "" || db == nil {
+		return nil
+	}
+	return &vulnMatcher{db: db, dir: dir}
+}
+
+// run loads the advisories and re-evaluates every host whenever the advisory
+// files change, until ctx ends
+func (m *vulnMatcher) run(ctx context.Context) {
+	interval := getEnvDuration("ADVISORY_RELOAD_INTERVAL", 5*time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var loaded string
+	for {
+		if state, err := dirState(m.dir); err != nil {
+			log.Printf("⚠️  Failed to scan advisory directory: %v", err)
+		} else if state != loaded {
+			if m.load() {
+				loaded = state
+				m.evaluateAll()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// load replaces the advisory database from the directory
+func (m *vulnMatcher) load() bool {
+	start := time.Now()
+	advisories, err := osv.Load(m.dir)
+	if err != nil {
+		log.Printf("⚠️  Failed to load advisories from %s: %v", m.dir, err)
+		return false
+	}
+	m.advisories.Store(advisories)
+	log.Printf("🛡️  Loaded %d advisories from %s in %v (%d unreadable files skipped)",
+		advisories.Advisories, m.dir, time.Since(start).Round(time.Millisecond), advisories.Skipped)
+	return true
+}
+
+// evaluateAll re-matches every host with a package inventory
+func (m *vulnMatcher) evaluateAll() {
+	hosts, err := m.db.PackageHosts()
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	for _, host := range hosts {
+		m.evaluate(host)
+	}
+}
+
+// evaluateHost re-matches one host after its packages or OS changed
+func (m *vulnMatcher) evaluateHost(orgID, hostID string) {
+	host, err := m.db.PackageHost(orgID, hostID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	if host != nil {
+		m.evaluate(*host)
+	}
+}
+
+// evaluate matches a host's packages and records its findings
+func (m *vulnMatcher) evaluate(host database.PackageHost) {
+	advisories := m.advisories.Load()
+	if advisories == nil {
+		return
+	}
+	eco, ok := osv.HostEcosystem(host.OSID, host.OSVersion)
+	if !ok {
+		return
+	}
+
+	stored, err := m.db.HostPackages(host.OrgID, host.HostID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	pkgs := make([]packages.Package, len(stored))
+	for i, p := range stored {
+		pkgs[i] = packages.Package{Name: p.Name, Version: p.Version, Arch: p.Arch, Source: p.Source}
+	}
+
+	matches := advisories.Match(eco, host.Manager, pkgs)
+	findings := make([]database.VulnerabilityFinding, len(matches))
+	for i, f := range matches {
+		findings[i] = database.VulnerabilityFinding{
+			AdvisoryID:       f.AdvisoryID,
+			Aliases:          f.Aliases,
+			Package:          f.Package,
+			InstalledVersion: f.Version,
+			FixedVersion:     f.FixedVersion,
+			Severity:         f.Severity,
+			Score:            f.Score,
+			Summary:          f.Summary,
+		}
+	}
+
+	resolved, err := m.db.SyncVulnerabilityFindings(host.OrgID, host.HostID, eco.String(), findings)
+	if err != nil {
+		log.Printf("⚠️  Failed to store vulnerability findings: %v", err)
+		return
+	}
+	log.Printf("🛡️  Vulnerabilities: %s/%s (%s) %d open, %d resolved",
+		host.OrgID, host.HostID, eco, len(findings), resolved)
+}
+
+// dirState fingerprints the advisory files so imports are noticed
+func dirState(dir string) (string, error) {
+	var count int
+	var size int64
+	var latest time.Time
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count++
+		size += info.Size()
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return fmt.Sprintf("%d/%d/%d", count, size, latest.UnixNano()), err
+}
@@ -7,6 +7,7 @@ toolchain go1.24.4
 require (
 	github.com/lib/pq v1.10.9
 	github.com/nats-io/nats.go v1.43.0
+	golang.org/x/sys v0.32.0
 	google.golang.org/grpc v1.50.1
 	google.golang.org/protobuf v1.28.1
 )
@@ -19,7 +20,6 @@ require (
 	github.com/nats-io/nuid v1.0.1 // indirect
 	golang.org/x/crypto v0.37.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/sys v0.32.0 // indirect
 	golang.org/x/text v0.24.0 // indirect
 	google.golang.org/genproto v0.0.0-20220617124728-180714bec0ad // indirect
 )
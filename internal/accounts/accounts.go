@@ -0,0 +1,221 @@
+// Package accounts reads local users, groups, password state and sudo rules
+// from passwd, shadow, group and sudoers, and describes the changes between
+// two snapshots as semantic account events.
+package accounts
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Files read by Read, relative to the root
+const (
+	PasswdFile  = "etc/passwd"
+	ShadowFile  = "etc/shadow"
+	GroupFile   = "etc/group"
+	SudoersFile = "etc/sudoers"
+	SudoersDir  = "etc/sudoers.d"
+)
+
+// User is a passwd entry
+type User struct {
+	Name  string `json:"name"`
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	Gecos string `json:"gecos,omitempty"`
+	Home  string `json:"home"`
+	Shell string `json:"shell"`
+}
+
+// Password is the shadow state of an account. The hash itself is never kept;
+// Fingerprint only tells whether it changed.
+type Password struct {
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Locked      bool   `json:"locked"` // hash prefixed with "!" or "*"
+	Empty       bool   `json:"empty"`  // no password required to log in
+	LastChange  string `json:"last_change,omitempty"`
+	Expire      string `json:"expire,omitempty"`
+}
+
+// Group is a group entry with its supplementary members
+type Group struct {
+	Name    string   `json:"name"`
+	GID     int      `json:"gid"`
+	Members []string `json:"members,omitempty"`
+}
+
+// SudoRule is one logical line of a sudoers file
+type SudoRule struct {
+	File     string `json:"file"`
+	Rule     string `json:"rule"`     // whitespace-normalized
+	Subject  string `json:"subject"`  // user, %group or alias the rule is for
+	NoPasswd bool   `json:"nopasswd"` // grants commands without a password
+	Alias    bool   `json:"alias"`    // a *_Alias definition rather than a grant
+}
+
+// Snapshot is the account state of a host. Passwords is nil when shadow was
+// unreadable, in which case password changes are not reported.
+type Snapshot struct {
+	Users     map[string]User     `json:"users"`
+	Groups    map[string]Group    `json:"groups"`
+	Passwords map[string]Password `json:"passwords,omitempty"`
+	Sudo      []SudoRule          `json:"sudo"`
+}
+
+// Read builds a snapshot from the account files under root ("/" on a live
+// host). Missing sudoers files are treated as empty.
+func Read(root string) (*Snapshot, error) {
+	users, err := ReadUsers(root)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{
+		Users:  users,
+		Groups: make(map[string]Group),
+	}
+
+	err = readColonFile(filepath.Join(root, GroupFile), 4, func(f []string) {
+		gid, err := strconv.Atoi(f[2])
+		if err != nil {
+			return
+		}
+		g := Group{Name: f[0], GID: gid}
+		for _, m := range strings.Split(f[3], ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				g.Members = append(g.Members, m)
+			}
+		}
+		sort.Strings(g.Members)
+		snap.Groups[f[0]] = g
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	passwords := make(map[string]Password)
+	err = readColonFile(filepath.Join(root, ShadowFile), 9, func(f []string) {
+		passwords[f[0]] = parsePassword(f)
+	})
+	if err == nil {
+		snap.Passwords = passwords
+	}
+
+	snap.Sudo = readSudoers(root)
+	return snap, nil
+}
+
+// ReadUsers parses the passwd file under root
+func ReadUsers(root string) (map[string]User, error) {
+	users := make(map[string]User)
+	err := readColonFile(filepath.Join(root, PasswdFile), 7, func(f []string) {
+		uid, err1 := strconv.Atoi(f[2])
+		gid, err2 := strconv.Atoi(f[3])
+		if err1 != nil || err2 != nil {
+			return
+		}
+		users[f[0]] = User{Name: f[0], UID: uid, GID: gid, Gecos: f[4], Home: f[5], Shell: f[6]}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// parsePassword summarizes a shadow entry without keeping the hash
+func parsePassword(f []string) Password {
+	hash := f[1]
+	p := Password{LastChange: f[2], Expire: f[7]}
+	switch {
+	case hash == "":
+		p.Empty = true
+	case strings.HasPrefix(hash, "!") || strings.HasPrefix(hash, "*"):
+		p.Locked = true
+	}
+	if hash != "" {
+		// A truncated digest is enough to notice a change
+		sum := sha256.Sum256([]byte(hash))
+		p.Fingerprint = hex.EncodeToString(sum[:8])
+	}
+	return p
+}
+
+// readColonFile calls fn for each colon-separated line with at least n fields
+func readColonFile(path string, n int, fn func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < n || fields[0] == "" {
+			continue
+		}
+		fn(fields)
+	}
+	return scanner.Err()
+}
+
+// readSudoers parses sudoers and the files sudo reads from sudoers.d
+func readSudoers(root string) []SudoRule {
+	rules := parseSudoersFile(filepath.Join(root, SudoersFile), "/"+SudoersFile)
+
+	entries, _ := os.ReadDir(filepath.Join(root, SudoersDir))
+	for _, entry := range entries {
+		name := entry.Name()
+		// sudo skips files containing a dot or ending in "~"
+		if entry.IsDir() || strings.Contains(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		rules = append(rules, parseSudoersFile(filepath.Join(root, SudoersDir, name), "/"+SudoersDir+"/"+name)...)
+	}
+	return rules
+}
+
+// parseSudoersFile returns the rules and alias definitions of one file
+func parseSudoersFile(path, name string) []SudoRule {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var rules []SudoRule
+	text := strings.ReplaceAll(string(data), "\\\n", " ")
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		// Comments, defaults and include directives (only sudoers.d is
+		// followed) grant nothing by themselves
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "@include") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "Defaults") {
+			continue
+		}
+
+		rule := SudoRule{File: name, Rule: strings.Join(fields, " "), Subject: fields[0]}
+		switch fields[0] {
+		case "User_Alias", "Runas_Alias", "Host_Alias", "Cmnd_Alias", "Cmd_Alias":
+			rule.Alias = true
+		default:
+			rule.NoPasswd = strings.Contains(rule.Rule, "NOPASSWD:")
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -0,0 +1,230 @@
+package accounts
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Event types of account changes
+const (
+	EventUserAdded          = "user_added"
+	EventUserRemoved        = "user_removed"
+	EventUserModified       = "user_modified"
+	EventUID0Account        = "uid0_account_created"
+	EventGroupAdded         = "group_added"
+	EventGroupRemoved       = "group_removed"
+	EventGroupMemberAdded   = "group_member_added"
+	EventGroupMemberRemoved = "group_member_removed"
+	EventPasswordChanged    = "password_changed"
+	EventPasswordRemoved    = "password_removed"
+	EventAccountLocked      = "account_locked"
+	EventAccountUnlocked    = "account_unlocked"
+	EventSudoRuleAdded      = "sudo_rule_added"
+	EventSudoRuleRemoved    = "sudo_rule_removed"
+	EventSudoNoPasswdAdded  = "sudo_nopasswd_added"
+)
+
+// PrivilegedGroups are groups whose members can become root
+var PrivilegedGroups = map[string]bool{
+	"root": true, "sudo": true, "wheel": true, "admin": true,
+	"docker": true, "lxd": true, "disk": true, "shadow": true,
+}
+
+// Change is one semantic account change
+type Change struct {
+	Type     string
+	Severity string // "info", "warning" or "critical"
+	Message  string
+	Labels   map[string]string
+}
+
+// Diff describes what changed between two snapshots
+func Diff(old, cur *Snapshot) []Change {
+	var changes []Change
+	add := func(typ, severity string, labels map[string]string, format string, args ...any) {
+		changes = append(changes, Change{Type: typ, Severity: severity, Message: fmt.Sprintf(format, args...), Labels: labels})
+	}
+
+	// Users
+	for _, name := range slices.Sorted(maps.Keys(cur.Users)) {
+		u := cur.Users[name]
+		labels := userLabels(u)
+		prev, existed := old.Users[name]
+		switch {
+		case !existed && u.UID == 0:
+			add(EventUID0Account, "critical", labels, "UID 0 account created: %s (shell %s)", name, u.Shell)
+		case !existed:
+			add(EventUserAdded, "warning", labels, "User added: %s (uid %d, shell %s)", name, u.UID, u.Shell)
+		case prev.UID != 0 && u.UID == 0:
+			labels["previous_uid"] = strconv.Itoa(prev.UID)
+			add(EventUID0Account, "critical", labels, "User %s changed to UID 0 (was %d)", name, prev.UID)
+		case prev != u:
+			var fields []string
+			if prev.UID != u.UID {
+				fields = append(fields, fmt.Sprintf("uid %d -> %d", prev.UID, u.UID))
+			}
+			if prev.GID != u.GID {
+				fields = append(fields, fmt.Sprintf("gid %d -> %d", prev.GID, u.GID))
+			}
+			if prev.Home != u.Home {
+				fields = append(fields, fmt.Sprintf("home %s -> %s", prev.Home, u.Home))
+			}
+			if prev.Shell != u.Shell {
+				fields = append(fields, fmt.Sprintf("shell %s -> %s", prev.Shell, u.Shell))
+				labels["previous_shell"] = prev.Shell
+			}
+			if prev.Gecos != u.Gecos {
+				fields = append(fields, "comment")
+			}
+			severity := "info"
+			// Giving a service account a login shell is a common backdoor
+			if !LoginShell(prev.Shell) && LoginShell(u.Shell) {
+				severity = "warning"
+			}
+			labels["changes"] = strings.Join(fields, ", ")
+			add(EventUserModified, severity, labels, "User %s modified: %s", name, labels["changes"])
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(old.Users)) {
+		if _, ok := cur.Users[name]; !ok {
+			add(EventUserRemoved, "warning", userLabels(old.Users[name]), "User removed: %s", name)
+		}
+	}
+
+	// Groups and memberships
+	for _, name := range slices.Sorted(maps.Keys(cur.Groups)) {
+		g := cur.Groups[name]
+		prev, existed := old.Groups[name]
+		if !existed {
+			add(EventGroupAdded, "info", groupLabels(g), "Group added: %s (gid %d)", name, g.GID)
+		}
+		for _, member := range setDiff(g.Members, prev.Members) {
+			labels := groupLabels(g)
+			labels["user"] = member
+			severity := "info"
+			if PrivilegedGroups[name] {
+				severity = "critical"
+			}
+			add(EventGroupMemberAdded, severity, labels, "User %s added to group %s", member, name)
+		}
+		for _, member := range setDiff(prev.Members, g.Members) {
+			labels := groupLabels(g)
+			labels["user"] = member
+			add(EventGroupMemberRemoved, "info", labels, "User %s removed from group %s", member, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(old.Groups)) {
+		if _, ok := cur.Groups[name]; !ok {
+			add(EventGroupRemoved, "info", groupLabels(old.Groups[name]), "Group removed: %s", name)
+		}
+	}
+
+	// Passwords, only when shadow was readable both times
+	if old.Passwords != nil && cur.Passwords != nil {
+		for _, name := range slices.Sorted(maps.Keys(cur.Passwords)) {
+			p := cur.Passwords[name]
+			prev, existed := old.Passwords[name]
+			if existed && prev.Fingerprint == p.Fingerprint {
+				continue
+			}
+			labels := map[string]string{"user": name}
+			if u, ok := cur.Users[name]; ok {
+				labels["uid"] = strconv.Itoa(u.UID)
+			}
+			switch {
+			case !existed:
+				// A new account created without a password is a backdoor;
+				// other new entries are covered by user_added
+				if p.Empty {
+					add(EventPasswordRemoved, "critical", labels, "Account %s created without a password: login without a password is possible", name)
+				}
+			case p.Empty:
+				add(EventPasswordRemoved, "critical", labels, "Password removed for %s: login without a password is possible", name)
+			case prev.Locked && !p.Locked:
+				add(EventAccountUnlocked, "warning", labels, "Account unlocked: %s", name)
+			case !prev.Locked && p.Locked:
+				add(EventAccountLocked, "info", labels, "Account locked: %s", name)
+			default:
+				add(EventPasswordChanged, "info", labels, "Password changed for %s", name)
+			}
+		}
+	}
+
+	// Sudo rules, compared as a multiset per file
+	count := make(map[SudoRule]int)
+	for _, r := range old.Sudo {
+		count[r]++
+	}
+	for _, r := range cur.Sudo {
+		if count[r] > 0 {
+			count[r]--
+			continue
+		}
+		labels := sudoLabels(r)
+		switch {
+		case r.NoPasswd:
+			add(EventSudoNoPasswdAdded, "critical", labels, "NOPASSWD sudo rule added in %s: %s", r.File, r.Rule)
+		default:
+			add(EventSudoRuleAdded, "warning", labels, "Sudo rule added in %s: %s", r.File, r.Rule)
+		}
+	}
+	for _, r := range old.Sudo {
+		if count[r] > 0 {
+			count[r]--
+			add(EventSudoRuleRemoved, "info", sudoLabels(r), "Sudo rule removed from %s: %s", r.File, r.Rule)
+		}
+	}
+
+	return changes
+}
+
+// LoginShell reports whether a shell allows interactive logins
+func LoginShell(shell string) bool {
+	return shell != "" && !strings.HasSuffix(shell, "/nologin") && !strings.HasSuffix(shell, "/false") &&
+		shell != "/bin/sync"
+}
+
+func userLabels(u User) map[string]string {
+	return map[string]string{
+		"user":  u.Name,
+		"uid":   strconv.Itoa(u.UID),
+		"gid":   strconv.Itoa(u.GID),
+		"home":  u.Home,
+		"shell": u.Shell,
+	}
+}
+
+func groupLabels(g Group) map[string]string {
+	return map[string]string{
+		"group":      g.Name,
+		"gid":        strconv.Itoa(g.GID),
+		"privileged": strconv.FormatBool(PrivilegedGroups[g.Name]),
+	}
+}
+
+func sudoLabels(r SudoRule) map[string]string {
+	return map[string]string{
+		"file":     r.File,
+		"rule":     r.Rule,
+		"subject":  r.Subject,
+		"nopasswd": strconv.FormatBool(r.NoPasswd),
+	}
+}
+
+// setDiff returns the members of a that are not in b
+func setDiff(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var out []string
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
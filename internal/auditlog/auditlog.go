@@ -0,0 +1,356 @@
+// Package auditlog parses Linux audit records and assembles the
+// SYSCALL/EXECVE/CWD/PATH/PROCTITLE records sharing a serial number into
+// single events.
+package auditlog
+
+import (
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AUIDUnset is the login UID of processes that never logged in
+const AUIDUnset = "4294967295"
+
+// Record is a single audit log line
+type Record struct {
+	Type   string
+	Time   time.Time
+	Serial uint64
+	Fields map[string]string
+}
+
+// PathRecord describes one PATH record of an event
+type PathRecord struct {
+	Name     string
+	Nametype string
+	Inode    string
+	Mode     string
+	OUID     string
+}
+
+// Event is a group of records sharing a serial number
+type Event struct {
+	Serial  uint64
+	Time    time.Time
+	Type    string // type of the first record, e.g. SYSCALL or USER_LOGIN
+	Records []*Record
+
+	Syscall   string
+	Success   string
+	Exit      string
+	PID       int
+	PPID      int
+	UID       string
+	AUID      string
+	Session   string
+	TTY       string
+	Comm      string
+	Exe       string
+	Key       string
+	Argv      []string
+	Cwd       string
+	Paths     []PathRecord
+	Proctitle string
+}
+
+var header = regexp.MustCompile(`^(?:node=\S+ )?type=(\S+) msg=audit\((\d+)\.(\d+):(\d+)\):\s*(.*)$`)
+
+// hexFields are string fields auditd logs unquoted, hex-encoded, when the
+// value contains spaces or control characters
+var hexFields = map[string]bool{
+	"name": true, "cwd": true, "proctitle": true, "comm": true, "exe": true,
+	"key": true, "acct": true, "cmd": true, "data": true, "path": true,
+}
+
+var argField = regexp.MustCompile(`^a\d+(\[\d+\])?$`)
+
+// ParseRecord parses one audit.log line
+func ParseRecord(line string) (*Record, bool) {
+	m := header.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if m == nil {
+		return nil, false
+	}
+
+	sec, _ := strconv.ParseInt(m[2], 10, 64)
+	msec, _ := strconv.ParseInt(m[3], 10, 64)
+	serial, _ := strconv.ParseUint(m[4], 10, 64)
+
+	r := &Record{
+		Type:   m[1],
+		Time:   time.Unix(sec, msec*int64(time.Millisecond)),
+		Serial: serial,
+		Fields: make(map[string]string),
+	}
+
+	// ENRICHED format appends translated fields after a group separator
+	body, enriched, _ := strings.Cut(m[5], "\x1d")
+	parseFields(body, r.Fields, r.Type)
+	parseFields(enriched, r.Fields, r.Type)
+	return r, true
+}
+
+// parseFields parses key=value pairs, descending into the quoted msg='...'
+// payload of user-space records
+func parseFields(s string, fields map[string]string, recordType string) {
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ")
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return
+		}
+		key := s[:eq]
+		if sp := strings.IndexByte(key, ' '); sp >= 0 {
+			// Bare word without a value
+			s = s[sp+1:]
+			continue
+		}
+		s = s[eq+1:]
+
+		var value string
+		quoted := false
+		switch {
+		case strings.HasPrefix(s, `"`):
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				end = len(s) - 1
+			}
+			value, s = s[1:end+1], s[min(end+2, len(s)):]
+			quoted = true
+		case strings.HasPrefix(s, `'`):
+			end := strings.IndexByte(s[1:], '\'')
+			if end < 0 {
+				end = len(s) - 1
+			}
+			inner := s[1 : end+1]
+			s = s[min(end+2, len(s)):]
+			if key == "msg" {
+				parseFields(inner, fields, recordType)
+				continue
+			}
+			value, quoted = inner, true
+		default:
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+
+		if !quoted && (hexFields[key] || (recordType == "EXECVE" && argField.MatchString(key))) {
+			value = decodeHex(value, key == "proctitle")
+		}
+		fields[key] = value
+	}
+}
+
+// decodeHex decodes an unquoted hex field, leaving other values untouched
+func decodeHex(value string, nulToSpace bool) string {
+	if value == "" || value == "(null)" || len(value)%2 != 0 {
+		return value
+	}
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	if nulToSpace {
+		return strings.TrimRight(strings.ReplaceAll(string(decoded), "\x00", " "), " ")
+	}
+	return string(decoded)
+}
+
+// standaloneTypes are user-space record types that are never followed by
+// further records of the same serial
+func standalone(recordType string) bool {
+	for _, prefix := range []string{"USER_", "CRED_", "LOGIN", "ANOM_LOGIN", "SERVICE_", "DAEMON_", "ADD_", "DEL_", "GRP_", "CHGRP_", "CHUSER_"} {
+		if strings.HasPrefix(recordType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Assembler groups records into events by serial number
+type Assembler struct {
+	timeout time.Duration
+	pending map[uint64]*Event
+	seen    map[uint64]time.Time // arrival time of each pending event
+}
+
+// NewAssembler creates an assembler that gives up waiting for an event's
+// end-of-event record after timeout
+func NewAssembler(timeout time.Duration) *Assembler {
+	return &Assembler{
+		timeout: timeout,
+		pending: make(map[uint64]*Event),
+		seen:    make(map[uint64]time.Time),
+	}
+}
+
+// Add adds a record and returns any events it completes
+func (a *Assembler) Add(r *Record) []*Event {
+	if r.Type == "EOE" {
+		if ev, ok := a.pending[r.Serial]; ok {
+			delete(a.pending, r.Serial)
+			delete(a.seen, r.Serial)
+			return []*Event{ev.finish()}
+		}
+		return nil
+	}
+
+	ev, ok := a.pending[r.Serial]
+	if !ok {
+		ev = &Event{Serial: r.Serial, Time: r.Time, Type: r.Type}
+		if standalone(r.Type) {
+			ev.Records = []*Record{r}
+			return []*Event{ev.finish()}
+		}
+		a.pending[r.Serial] = ev
+		a.seen[r.Serial] = time.Now()
+	}
+	ev.Records = append(ev.Records, r)
+	return nil
+}
+
+// Flush returns events that have waited longer than the timeout, or all
+// pending events when force is set
+func (a *Assembler) Flush(force bool) []*Event {
+	var done []*Event
+	cutoff := time.Now().Add(-a.timeout)
+	for serial, ev := range a.pending {
+		if force || a.seen[serial].Before(cutoff) {
+			done = append(done, ev.finish())
+			delete(a.pending, serial)
+			delete(a.seen, serial)
+		}
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].Serial < done[j].Serial })
+	return done
+}
+
+// finish derives the summary fields from the collected records
+func (ev *Event) finish() *Event {
+	type arg struct {
+		index int
+		parts map[int]string
+	}
+	args := make(map[int]*arg)
+	argc := -1
+
+	for _, r := range ev.Records {
+		f := r.Fields
+		switch r.Type {
+		case "EXECVE":
+			// Long arguments continue in further EXECVE records without argc
+			if n, err := strconv.Atoi(f["argc"]); err == nil {
+				argc = n
+			}
+			for key, value := range f {
+				if !argField.MatchString(key) {
+					continue
+				}
+				name, part, _ := strings.Cut(strings.TrimSuffix(key[1:], "]"), "[")
+				idx, _ := strconv.Atoi(name)
+				if args[idx] == nil {
+					args[idx] = &arg{index: idx, parts: make(map[int]string)}
+				}
+				p, _ := strconv.Atoi(part)
+				args[idx].parts[p] = value
+			}
+		case "CWD":
+			ev.Cwd = f["cwd"]
+		case "PATH":
+			ev.Paths = append(ev.Paths, PathRecord{
+				Name:     f["name"],
+				Nametype: f["nametype"],
+				Inode:    f["inode"],
+				Mode:     f["mode"],
+				OUID:     f["ouid"],
+			})
+		case "PROCTITLE":
+			ev.Proctitle = f["proctitle"]
+		default:
+			// SYSCALL and user-space records carry the process context
+			set := func(dst *string, key string) {
+				if v, ok := f[key]; ok && *dst == "" {
+					*dst = v
+				}
+			}
+			set(&ev.Syscall, "syscall")
+			set(&ev.Success, "success")
+			if ev.Success == "" {
+				set(&ev.Success, "res")
+			}
+			set(&ev.Exit, "exit")
+			set(&ev.UID, "uid")
+			set(&ev.AUID, "auid")
+			set(&ev.Session, "ses")
+			set(&ev.TTY, "tty")
+			if ev.TTY == "" {
+				set(&ev.TTY, "terminal")
+			}
+			set(&ev.Comm, "comm")
+			set(&ev.Exe, "exe")
+			set(&ev.Key, "key")
+			if ev.PID == 0 {
+				ev.PID, _ = strconv.Atoi(f["pid"])
+			}
+			if ev.PPID == 0 {
+				ev.PPID, _ = strconv.Atoi(f["ppid"])
+			}
+		}
+	}
+
+	if len(args) > 0 {
+		if argc < 0 || argc > len(args) {
+			argc = len(args)
+		}
+		ev.Argv = make([]string, 0, argc)
+		for i := 0; i < argc; i++ {
+			a, ok := args[i]
+			if !ok {
+				continue
+			}
+			parts := make([]int, 0, len(a.parts))
+			for p := range a.parts {
+				parts = append(parts, p)
+			}
+			sort.Ints(parts)
+			var sb strings.Builder
+			for _, p := range parts {
+				sb.WriteString(a.parts[p])
+			}
+			ev.Argv = append(ev.Argv, sb.String())
+		}
+	}
+
+	if ev.Key == "(null)" {
+		ev.Key = ""
+	}
+	return ev
+}
+
+// IsExec reports whether the event records a program execution
+func (ev *Event) IsExec() bool {
+	if len(ev.Argv) > 0 {
+		return true
+	}
+	switch ev.Syscall {
+	case "59", "322", "execve", "execveat": // x86_64
+		return true
+	}
+	return false
+}
+
+// Field returns the first value of key across the event's records
+func (ev *Event) Field(key string) string {
+	for _, r := range ev.Records {
+		if v, ok := r.Fields[key]; ok {
+			return v
+		}
+	}
+	return ""
+}
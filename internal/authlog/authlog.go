@@ -0,0 +1,344 @@
+// Package authlog turns sshd, PAM, sudo, su and systemd-logind syslog lines
+// into structured authentication events.
+package authlog
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types produced by the parser
+const (
+	TypeLoginSuccess     = "login_success"
+	TypeLoginFailure     = "login_failure"
+	TypeLoginAttempt     = "login_attempt"
+	TypeInvalidUser      = "invalid_user"
+	TypeMaxAuthAttempts  = "max_auth_attempts"
+	TypePreauthClose     = "preauth_disconnect"
+	TypeDisconnect       = "disconnect"
+	TypeAuthFailure      = "auth_failure"
+	TypeSessionOpened    = "session_opened"
+	TypeSessionClosed    = "session_closed"
+	TypeSudoCommand      = "sudo_command"
+	TypeSudoFailure      = "sudo_failure"
+	TypeSuccessfulSwitch = "su_success"
+	TypeFailedSwitch     = "su_failure"
+)
+
+// Results
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultInfo    = "info"
+)
+
+// AuthEvent is a structured authentication log record
+type AuthEvent struct {
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host,omitempty"`
+	Program    string    `json:"program"`
+	PID        int       `json:"pid,omitempty"`
+	Type       string    `json:"type"`
+	Result     string    `json:"result"`
+	User       string    `json:"user,omitempty"`
+	TargetUser string    `json:"target_user,omitempty"`
+	SourceIP   string    `json:"source_ip,omitempty"`
+	SourcePort int       `json:"source_port,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	Service    string    `json:"service,omitempty"` // PAM service, e.g. sshd or su-l
+	SessionID  string    `json:"session_id,omitempty"`
+	TTY        string    `json:"tty,omitempty"`
+	Command    string    `json:"command,omitempty"`
+	KeyType    string    `json:"key_type,omitempty"`
+	KeyFP      string    `json:"key_fingerprint,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Invalid    bool      `json:"invalid_user,omitempty"`
+}
+
+var (
+	traditionalHeader = regexp.MustCompile(`^([A-Z][a-z]{2}\s+\d{1,2} \d{2}:\d{2}:\d{2}) (\S+) ([^\s\[:]+)(?:\[(\d+)\])?: (.*)$`)
+	rfc3339Header     = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})) (\S+) ([^\s\[:]+)(?:\[(\d+)\])?: (.*)$`)
+)
+
+// message parses the body of a log line for a given program
+type message struct {
+	re    *regexp.Regexp
+	parse func(m []string, ev *AuthEvent)
+}
+
+var sshdMessages = []message{
+	{
+		regexp.MustCompile(`^Accepted (\S+) for (\S+) from (\S+) port (\d+)(?: ssh2)?(?:: (\S+) (\S+))?`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeLoginSuccess, ResultSuccess
+			ev.Method, ev.User = m[1], m[2]
+			setSource(ev, m[3], m[4])
+			ev.KeyType, ev.KeyFP = m[5], m[6]
+		},
+	},
+	{
+		regexp.MustCompile(`^Failed (\S+) for (invalid user )?(\S*) from (\S+) port (\d+)`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+			ev.Method, ev.Invalid, ev.User = m[1], m[2] != "", m[3]
+			setSource(ev, m[4], m[5])
+		},
+	},
+	{
+		regexp.MustCompile(`^Invalid user (.*?) from (\S+)(?: port (\d+))?$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeInvalidUser, ResultFailure
+			ev.User, ev.Invalid = m[1], true
+			setSource(ev, m[2], m[3])
+		},
+	},
+	{
+		regexp.MustCompile(`^error: maximum authentication attempts exceeded for (invalid user )?(\S*) from (\S+) port (\d+)`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeMaxAuthAttempts, ResultFailure
+			ev.Invalid, ev.User = m[1] != "", m[2]
+			setSource(ev, m[3], m[4])
+			ev.Reason = "maximum authentication attempts exceeded"
+		},
+	},
+	{
+		regexp.MustCompile(`^Disconnecting (invalid user |authenticating user )?(\S*) (\S+) port (\d+): (Too many authentication failures.*?)(?: \[preauth\])?$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeMaxAuthAttempts, ResultFailure
+			ev.Invalid, ev.User = m[1] == "invalid user ", m[2]
+			setSource(ev, m[3], m[4])
+			ev.Reason = m[5]
+		},
+	},
+	{
+		regexp.MustCompile(`^(?:Connection closed|Disconnected|Connection reset) (?:by|from) (?:(invalid user |authenticating user |user )(\S*) )?(\S+) port (\d+)(?::.*?)?( \[preauth\])?$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeDisconnect, ResultInfo
+			if m[5] != "" {
+				ev.Type, ev.Result = TypePreauthClose, ResultFailure
+			}
+			ev.Invalid, ev.User = m[1] == "invalid user ", m[2]
+			setSource(ev, m[3], m[4])
+		},
+	},
+	{
+		regexp.MustCompile(`^Received disconnect from (\S+) port (\d+):\d+: (.*?)( \[preauth\])?$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeDisconnect, ResultInfo
+			if m[4] != "" {
+				ev.Type, ev.Result = TypePreauthClose, ResultFailure
+			}
+			setSource(ev, m[1], m[2])
+			ev.Reason = m[3]
+		},
+	},
+}
+
+var pamMessages = []message{
+	{
+		regexp.MustCompile(`^pam_unix\(([^:]+):session\): session (opened|closed) for user ([^\s(]+)(?:\(uid=\d+\))?(?: by ([^\s(]*)(?:\(uid=\d+\))?)?`),
+		func(m []string, ev *AuthEvent) {
+			ev.Service = m[1]
+			ev.Type, ev.Result = TypeSessionOpened, ResultSuccess
+			if m[2] == "closed" {
+				ev.Type, ev.Result = TypeSessionClosed, ResultInfo
+			}
+			ev.TargetUser, ev.User = m[3], m[4]
+			if ev.User == "" {
+				ev.User = ev.TargetUser
+			}
+		},
+	},
+	{
+		regexp.MustCompile(`^pam_unix\(([^:]+):auth\): authentication failure; (.*)$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Service = m[1]
+			ev.Type, ev.Result = TypeAuthFailure, ResultFailure
+			kv := parseKV(m[2])
+			ev.User = kv["user"]
+			if ruser := kv["ruser"]; ruser != "" {
+				// su/sudo: ruser is the caller, user the account being unlocked
+				ev.User, ev.TargetUser = ruser, kv["user"]
+			}
+			ev.TTY = kv["tty"]
+			setSource(ev, kv["rhost"], "")
+		},
+	},
+	{
+		regexp.MustCompile(`^PAM (\d+) more authentication failures?; (.*)$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeAuthFailure, ResultFailure
+			kv := parseKV(m[2])
+			ev.User = kv["user"]
+			setSource(ev, kv["rhost"], "")
+			ev.Reason = m[1] + " more authentication failures"
+		},
+	},
+}
+
+var sudoMessages = []message{
+	{
+		regexp.MustCompile(`^\s*(\S+) : (?:(.*?) ; )?TTY=(\S+) ; PWD=(.*?) ; USER=(\S+) ;(?: .*? ;)? COMMAND=(.*)$`),
+		func(m []string, ev *AuthEvent) {
+			ev.User, ev.TTY, ev.TargetUser, ev.Command = m[1], m[3], m[5], m[6]
+			ev.Type, ev.Result = TypeSudoCommand, ResultSuccess
+			if m[2] != "" {
+				ev.Type, ev.Result, ev.Reason = TypeSudoFailure, ResultFailure, m[2]
+			}
+		},
+	},
+}
+
+var suMessages = []message{
+	{
+		// Debian/Ubuntu: "(to root) alice on pts/0"
+		regexp.MustCompile(`^\(to (\S+)\) (\S+) on (\S+)$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeSuccessfulSwitch, ResultSuccess
+			ev.TargetUser, ev.User, ev.TTY = m[1], m[2], m[3]
+		},
+	},
+	{
+		regexp.MustCompile(`^FAILED SU \(to (\S+)\) (\S+) on (\S+)$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeFailedSwitch, ResultFailure
+			ev.TargetUser, ev.User, ev.TTY = m[1], m[2], m[3]
+		},
+	},
+	{
+		// util-linux: "+ pts/0 alice:root" / "- pts/0 alice:root"
+		regexp.MustCompile(`^([+-]) (\S+) ([^:\s]+):(\S+)$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeSuccessfulSwitch, ResultSuccess
+			if m[1] == "-" {
+				ev.Type, ev.Result = TypeFailedSwitch, ResultFailure
+			}
+			ev.TTY, ev.User, ev.TargetUser = m[2], m[3], m[4]
+		},
+	},
+}
+
+var logindMessages = []message{
+	{
+		regexp.MustCompile(`^New session (\S+) of user (\S+?)\.?$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeSessionOpened, ResultSuccess
+			ev.SessionID, ev.User = m[1], m[2]
+		},
+	},
+	{
+		regexp.MustCompile(`^Removed session (\S+?)\.?$`),
+		func(m []string, ev *AuthEvent) {
+			ev.Type, ev.Result = TypeSessionClosed, ResultInfo
+			ev.SessionID = m[1]
+		},
+	},
+}
+
+// programMessages selects the message table by syslog program name
+var programMessages = map[string][]message{
+	"sshd":           concat(sshdMessages, pamMessages),
+	"sshd-session":   concat(sshdMessages, pamMessages),
+	"sudo":           concat(sudoMessages, pamMessages),
+	"su":             concat(suMessages, pamMessages),
+	"systemd-logind": logindMessages,
+}
+
+func concat(tables ...[]message) []message {
+	var all []message
+	for _, t := range tables {
+		all = append(all, t...)
+	}
+	return all
+}
+
+// Parse parses a syslog line, resolving yearless timestamps against now
+func Parse(line string) (*AuthEvent, bool) {
+	return ParseWithReference(line, time.Now())
+}
+
+// ParseWithReference parses a syslog line, resolving yearless timestamps
+// against ref. It returns false for lines that aren't authentication events.
+func ParseWithReference(line string, ref time.Time) (*AuthEvent, bool) {
+	ev, body, ok := parseHeader(line, ref)
+	if !ok {
+		return nil, false
+	}
+
+	table, ok := programMessages[ev.Program]
+	if !ok && (strings.HasPrefix(body, "pam_unix(") || strings.HasPrefix(body, "PAM ")) {
+		table = pamMessages
+	}
+
+	for _, msg := range table {
+		if sm := msg.re.FindStringSubmatch(body); sm != nil {
+			msg.parse(sm, ev)
+			return ev, true
+		}
+	}
+	return nil, false
+}
+
+// parseHeader splits a syslog line into a partially filled event and its body
+func parseHeader(line string, ref time.Time) (*AuthEvent, string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+
+	var ts time.Time
+	m := rfc3339Header.FindStringSubmatch(line)
+	if m != nil {
+		ts, _ = time.Parse(time.RFC3339Nano, normalizeOffset(m[1]))
+	} else if m = traditionalHeader.FindStringSubmatch(line); m != nil {
+		ts = parseTraditional(m[1], ref)
+	} else {
+		return nil, "", false
+	}
+
+	ev := &AuthEvent{Time: ts, Host: m[2], Program: m[3]}
+	ev.PID, _ = strconv.Atoi(m[4])
+	return ev, m[5], true
+}
+
+// setSource records the remote address and port if the address is an IP
+func setSource(ev *AuthEvent, host, port string) {
+	host = strings.Trim(host, "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		ev.SourceIP = ip.String()
+	}
+	ev.SourcePort, _ = strconv.Atoi(port)
+}
+
+// parseKV parses PAM's "key=value key=value" trailers where values may be empty
+func parseKV(s string) map[string]string {
+	kv := make(map[string]string)
+	for _, field := range strings.Fields(s) {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			kv[k] = v
+		}
+	}
+	return kv
+}
+
+// parseTraditional parses "Jan  2 15:04:05", picking the year so the result
+// isn't more than a day in the future relative to ref
+func parseTraditional(stamp string, ref time.Time) time.Time {
+	t, err := time.ParseInLocation("Jan 2 15:04:05", strings.Join(strings.Fields(stamp), " "), ref.Location())
+	if err != nil {
+		return time.Time{}
+	}
+	t = t.AddDate(ref.Year(), 0, 0)
+	if t.After(ref.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// normalizeOffset turns "+0000" style offsets into "+00:00"
+func normalizeOffset(stamp string) string {
+	if n := len(stamp); n > 5 && (stamp[n-5] == '+' || stamp[n-5] == '-') {
+		return stamp[:n-2] + ":" + stamp[n-2:]
+	}
+	return stamp
+}
@@ -0,0 +1,376 @@
+package authlog
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parser turns a single log line into an authentication event
+type Parser interface {
+	Parse(line string, ref time.Time) (*AuthEvent, bool)
+}
+
+// ParserFunc adapts a function to the Parser interface
+type ParserFunc func(line string, ref time.Time) (*AuthEvent, bool)
+
+// Parse calls f(line, ref)
+func (f ParserFunc) Parse(line string, ref time.Time) (*AuthEvent, bool) {
+	return f(line, ref)
+}
+
+// Service describes where a service logs authentication attempts and how to
+// parse them
+type Service struct {
+	Name string
+	// Paths lists candidate log files in order of preference; the first entry
+	// matching any file wins and may be a glob matching several files
+	Paths []string
+	// New returns a parser; called once per tailed file so parsers may keep state
+	New func() Parser
+}
+
+// Resolve returns the log files this service should be read from
+func (s Service) Resolve() []string {
+	for _, pattern := range s.Paths {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			return matches
+		}
+	}
+	return nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Service
+)
+
+// Register adds a service parser to the registry, replacing any existing
+// service with the same name
+func Register(s Service) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for i, existing := range registry {
+		if existing.Name == s.Name {
+			registry[i] = s
+			return
+		}
+	}
+	registry = append(registry, s)
+}
+
+// Services returns all registered service parsers
+func Services() []Service {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Service(nil), registry...)
+}
+
+func init() {
+	Register(Service{
+		Name:  "system",
+		Paths: []string{"/var/log/auth.log", "/var/log/secure", "/var/log/messages"},
+		New:   func() Parser { return ParserFunc(ParseWithReference) },
+	})
+	Register(Service{
+		Name:  "mail",
+		Paths: []string{"/var/log/mail.log", "/var/log/maillog"},
+		New:   func() Parser { return ParserFunc(parseMail) },
+	})
+	Register(Service{
+		Name:  "vsftpd",
+		Paths: []string{"/var/log/vsftpd.log"},
+		New:   func() Parser { return ParserFunc(parseVsftpd) },
+	})
+	Register(Service{
+		Name:  "mysql",
+		Paths: []string{"/var/log/mysql/error.log", "/var/log/mysqld.log", "/var/log/mariadb/mariadb.log"},
+		New:   func() Parser { return ParserFunc(parseMySQL) },
+	})
+	Register(Service{
+		Name:  "postgresql",
+		Paths: []string{"/var/log/postgresql/postgresql-*.log", "/var/lib/pgsql/data/log/*.log", "/var/lib/pgsql/*/data/log/*.log"},
+		New:   func() Parser { return newPostgresParser() },
+	})
+	Register(Service{
+		Name:  "nginx",
+		Paths: []string{"/var/log/nginx/error.log"},
+		New:   func() Parser { return ParserFunc(parseNginxError) },
+	})
+	Register(Service{
+		Name:  "wordpress",
+		Paths: []string{"/var/log/nginx/access.log", "/var/log/apache2/access.log", "/var/log/httpd/access_log"},
+		New:   func() Parser { return ParserFunc(parseWordPressAccess) },
+	})
+}
+
+// ─── postfix / dovecot ────────────────────────────────────────────────────
+
+var (
+	postfixSASLFailed = regexp.MustCompile(`^warning: ([^\[\s]*)\[([^\]]+)\]: SASL (\S+) authentication failed(?:: (.*))?$`)
+	dovecotLogin      = regexp.MustCompile(`^(imap|pop3|submission|managesieve)-login: (Login|Disconnected|Aborted login)(?: \(([^)]*)\))?: (.*)$`)
+	saslUsername      = regexp.MustCompile(`sasl_username=(\S+)`)
+)
+
+func parseMail(line string, ref time.Time) (*AuthEvent, bool) {
+	ev, body, ok := parseHeader(line, ref)
+	if !ok {
+		return nil, false
+	}
+
+	switch {
+	case strings.HasPrefix(ev.Program, "postfix/"):
+		m := postfixSASLFailed.FindStringSubmatch(body)
+		if m == nil {
+			return nil, false
+		}
+		ev.Service = "postfix"
+		ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+		ev.Method, ev.Reason = m[3], m[4]
+		setSource(ev, m[2], "")
+		if u := saslUsername.FindStringSubmatch(body); u != nil {
+			ev.User = u[1]
+		}
+		return ev, true
+
+	case ev.Program == "dovecot":
+		m := dovecotLogin.FindStringSubmatch(body)
+		if m == nil {
+			return nil, false
+		}
+		kv := parseDovecotKV(m[4])
+		ev.Service = "dovecot"
+		ev.Method = kv["method"]
+		ev.User = kv["user"]
+		ev.SessionID = kv["session"]
+		setSource(ev, kv["rip"], kv["rport"])
+		switch {
+		case m[2] == "Login":
+			ev.Type, ev.Result = TypeLoginSuccess, ResultSuccess
+		case strings.HasPrefix(m[3], "auth failed"):
+			ev.Type, ev.Result, ev.Reason = TypeLoginFailure, ResultFailure, m[3]
+		case strings.HasPrefix(m[3], "no auth attempts"):
+			return nil, false
+		default:
+			ev.Type, ev.Result, ev.Reason = TypeDisconnect, ResultInfo, m[3]
+		}
+		return ev, true
+	}
+	return nil, false
+}
+
+// parseDovecotKV parses "user=<bob>, method=PLAIN, rip=1.2.3.4, TLS"
+func parseDovecotKV(s string) map[string]string {
+	kv := make(map[string]string)
+	for _, field := range strings.Split(s, ", ") {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			kv[k] = strings.Trim(v, "<>")
+		}
+	}
+	return kv
+}
+
+// ─── vsftpd ───────────────────────────────────────────────────────────────
+
+var (
+	vsftpdTimestamp = regexp.MustCompile(`^\w{3} (\w{3}\s+\d{1,2} \d{2}:\d{2}:\d{2} \d{4}) `)
+	vsftpdLogin     = regexp.MustCompile(`(?:\[pid (\d+)\] )?\[([^\]]*)\] (OK|FAIL) LOGIN: Client "([^"]+)"`)
+)
+
+// parseVsftpd reads vsftpd's own log format, or its syslog lines when
+// syslog_enable is set
+func parseVsftpd(line string, ref time.Time) (*AuthEvent, bool) {
+	ev := &AuthEvent{Program: "vsftpd"}
+	body := line
+	if ts := vsftpdTimestamp.FindStringSubmatch(line); ts != nil {
+		ev.Time, _ = time.ParseInLocation("Jan 2 15:04:05 2006", strings.Join(strings.Fields(ts[1]), " "), ref.Location())
+	} else {
+		var ok bool
+		if ev, body, ok = parseHeader(line, ref); !ok || ev.Program != "vsftpd" {
+			return nil, false
+		}
+	}
+
+	m := vsftpdLogin.FindStringSubmatch(body)
+	if m == nil {
+		return nil, false
+	}
+	if m[1] != "" {
+		ev.PID, _ = strconv.Atoi(m[1])
+	}
+	ev.Service = "vsftpd"
+	ev.User = m[2]
+	ev.Method = "password"
+	ev.Type, ev.Result = TypeLoginSuccess, ResultSuccess
+	if m[3] == "FAIL" {
+		ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+	}
+	setSource(ev, strings.TrimPrefix(m[4], "::ffff:"), "")
+	return ev, true
+}
+
+// ─── MySQL / MariaDB ──────────────────────────────────────────────────────
+
+var (
+	mysqlTimestamp    = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?Z?)\s`)
+	mysqlAccessDenied = regexp.MustCompile(`Access denied for user '([^']*)'@'([^']*)'(?: \(using password: (YES|NO)\))?`)
+)
+
+func parseMySQL(line string, ref time.Time) (*AuthEvent, bool) {
+	m := mysqlAccessDenied.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+
+	ev := &AuthEvent{Program: "mysqld", Service: "mysql"}
+	if ts := mysqlTimestamp.FindStringSubmatch(line); ts != nil {
+		stamp := strings.Replace(ts[1], " ", "T", 1)
+		if strings.HasSuffix(stamp, "Z") {
+			ev.Time, _ = time.Parse(time.RFC3339Nano, stamp)
+		} else {
+			ev.Time, _ = time.ParseInLocation("2006-01-02T15:04:05", stamp, ref.Location())
+		}
+	}
+	ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+	ev.User = m[1]
+	ev.Method = "password"
+	if m[3] == "NO" {
+		ev.Method = "none"
+	}
+	setSource(ev, m[2], "")
+	return ev, true
+}
+
+// ─── PostgreSQL ───────────────────────────────────────────────────────────
+
+var (
+	pgPrefix     = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?) (\S+) \[(\d+)\]`)
+	pgConnection = regexp.MustCompile(`LOG:\s+connection received: host=(\S+)(?: port=(\d+))?`)
+	pgAuthFailed = regexp.MustCompile(`FATAL:\s+(password|md5|scram|Ident|peer|certificate|pam|ldap)?\s*authentication failed for user "([^"]*)"`)
+	pgNoEntry    = regexp.MustCompile(`FATAL:\s+no pg_hba\.conf entry for host "([^"]+)", user "([^"]*)"`)
+	pgClientHost = regexp.MustCompile(`\bhost=(\S+)`)
+)
+
+// postgresParser remembers the client address of each backend PID, because
+// the default log_line_prefix doesn't include it on the failure line
+type postgresParser struct {
+	hosts map[int][2]string
+}
+
+func newPostgresParser() *postgresParser {
+	return &postgresParser{hosts: make(map[int][2]string)}
+}
+
+func (p *postgresParser) Parse(line string, ref time.Time) (*AuthEvent, bool) {
+	prefix := pgPrefix.FindStringSubmatch(line)
+	if prefix == nil {
+		return nil, false
+	}
+	pid, _ := strconv.Atoi(prefix[3])
+
+	if m := pgConnection.FindStringSubmatch(line); m != nil {
+		if len(p.hosts) > 4096 {
+			p.hosts = make(map[int][2]string)
+		}
+		p.hosts[pid] = [2]string{m[1], m[2]}
+		return nil, false
+	}
+
+	ev := &AuthEvent{Program: "postgres", Service: "postgresql", PID: pid}
+	loc, err := time.LoadLocation(prefix[2])
+	if err != nil {
+		loc = ref.Location()
+	}
+	ev.Time, _ = time.ParseInLocation("2006-01-02 15:04:05", prefix[1], loc)
+
+	if m := pgAuthFailed.FindStringSubmatch(line); m != nil {
+		ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+		ev.Method, ev.User = strings.ToLower(m[1]), m[2]
+	} else if m := pgNoEntry.FindStringSubmatch(line); m != nil {
+		ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+		ev.User, ev.Reason = m[2], "no pg_hba.conf entry"
+		setSource(ev, m[1], "")
+		return ev, true
+	} else {
+		return nil, false
+	}
+
+	if h := pgClientHost.FindStringSubmatch(line); h != nil {
+		setSource(ev, h[1], "")
+	} else if h, ok := p.hosts[pid]; ok {
+		setSource(ev, h[0], h[1])
+	}
+	delete(p.hosts, pid)
+	return ev, true
+}
+
+// ─── nginx basic auth ─────────────────────────────────────────────────────
+
+var (
+	nginxErrorPrefix = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[\w+\] (\d+)#\d+:`)
+	nginxBasicAuth   = regexp.MustCompile(`user "([^"]*)"(?:: (password mismatch)| (was not found) in "[^"]*"), client: ([^,]+), server: ([^,]*)(?:, request: "([^"]*)")?`)
+)
+
+func parseNginxError(line string, ref time.Time) (*AuthEvent, bool) {
+	m := nginxBasicAuth.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+
+	ev := &AuthEvent{Program: "nginx", Service: "nginx", Method: "basic"}
+	if prefix := nginxErrorPrefix.FindStringSubmatch(line); prefix != nil {
+		ev.Time, _ = time.ParseInLocation("2006/01/02 15:04:05", prefix[1], ref.Location())
+		ev.PID, _ = strconv.Atoi(prefix[2])
+	}
+	ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+	ev.User = m[1]
+	ev.Reason = m[2]
+	if m[3] != "" {
+		ev.Reason = "user not found"
+		ev.Invalid = true
+	}
+	ev.Command = m[6]
+	setSource(ev, m[4], "")
+	return ev, true
+}
+
+// ─── WordPress ────────────────────────────────────────────────────────────
+
+var wordpressLogin = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "POST (\S*/(wp-login\.php|xmlrpc\.php))(?:\?\S*)? HTTP/[\d.]+" (\d{3}) `)
+
+// parseWordPressAccess reads combined-format access logs. A POST to
+// wp-login.php that re-renders the form (200) is a failed login, a redirect
+// (302) a successful one. xmlrpc.php answers 200 whether or not the
+// credentials were right, so its POSTs are reported as attempts with no
+// result, leaving legitimate Jetpack and app clients out of brute-force
+// counting.
+func parseWordPressAccess(line string, ref time.Time) (*AuthEvent, bool) {
+	m := wordpressLogin.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+
+	ev := &AuthEvent{Program: "httpd", Service: "wordpress", Command: "POST " + m[3]}
+	ev.Time, _ = time.Parse("02/Jan/2006:15:04:05 -0700", m[2])
+	setSource(ev, m[1], "")
+
+	status, _ := strconv.Atoi(m[5])
+	switch {
+	case m[4] == "xmlrpc.php":
+		ev.Method = "xmlrpc"
+		ev.Type, ev.Result = TypeLoginAttempt, ResultInfo
+	case status == 302:
+		ev.Method = "form"
+		ev.Type, ev.Result = TypeLoginSuccess, ResultSuccess
+	case status == 200 || status == 401 || status == 403:
+		ev.Method = "form"
+		ev.Type, ev.Result = TypeLoginFailure, ResultFailure
+	default:
+		return nil, false
+	}
+	return ev, true
+}
@@ -0,0 +1,42 @@
+package database
+
+import "fmt"
+
+// Alert severities (AlertSeverity enum)
+const (
+	AlertSeverityLow      = "LOW"
+	AlertSeverityMedium   = "MEDIUM"
+	AlertSeverityHigh     = "HIGH"
+	AlertSeverityCritical = "CRITICAL"
+)
+
+// SecurityAlert is an alert raised by a detection rule
+type SecurityAlert struct {
+	RuleID   string
+	RuleName string
+	Severity string // one of the AlertSeverity values
+	Message  string
+	HostID   string
+	Metadata []byte // JSON, stored as is
+}
+
+// InsertSecurityAlert stores a new active alert and returns its ID
+func (db *DB) InsertSecurityAlert(orgID string, a SecurityAlert) (string, error) {
+	var metadata interface{}
+	if len(a.Metadata) > 0 {
+		metadata = string(a.Metadata)
+	}
+
+	query := `
+		INSERT INTO "SecurityAlert" (id, "organizationId", "ruleName", "ruleId", severity, message, "hostId", status, metadata, "createdAt", "updatedAt")
+		VALUES (gen_random_uuid(), $1, $2, $3, $4::"AlertSeverity", $5, NULLIF($6, ''), 'ACTIVE', $7::jsonb, NOW(), NOW())
+		RETURNING id
+	`
+
+	var id string
+	err := db.conn.QueryRow(query, orgID, a.RuleName, a.RuleID, a.Severity, a.Message, a.HostID, metadata).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert security alert: %w", err)
+	}
+	return id, nil
+}
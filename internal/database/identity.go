@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// hostScopedTables hold rows keyed by ("organizationId", "hostId") that
+// follow an agent when it is re-keyed or merged
+var hostScopedTables = []string{"SecurityEvent", "SecurityAlert", "SystemMetric", "SystemMetricRollup", "HostPackage", "VulnerabilityFinding", "AuthorizedKey"}
+
+// agentExists reports whether an agent row exists
+func agentExists(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, orgID, hostID string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM "Agent" WHERE "organizationId" = $1 AND "hostId" = $2)`, orgID, hostID).Scan(&exists)
+	return exists, err
+}
+
+// RekeyAgent changes an agent's host ID, moving its events, alerts and
+// metrics along with it
+func (db *DB) RekeyAgent(orgID, oldHostID, newHostID string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin re-key: %w", err)
+	}
+	defer tx.Rollback()
+
+	if exists, err := agentExists(tx, orgID, newHostID); err != nil {
+		return fmt.Errorf("failed to check agent: %w", err)
+	} else if exists {
+		return fmt.Errorf("agent %s/%s already exists; merge instead", orgID, newHostID)
+	}
+
+	result, err := tx.Exec(`UPDATE "Agent" SET "hostId" = $1, "updatedAt" = NOW() WHERE "organizationId" = $2 AND "hostId" = $3`,
+		newHostID, orgID, oldHostID)
+	if err != nil {
+		return fmt.Errorf("failed to re-key agent: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("agent not found: %s/%s", orgID, oldHostID)
+	}
+
+	if err := moveHostRows(tx, orgID, oldHostID, newHostID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit re-key: %w", err)
+	}
+
+	log.Printf("✅ Agent re-keyed: %s/%s -> %s", orgID, oldHostID, newHostID)
+	return nil
+}
+
+// MergeAgents folds the agent fromHostID into intoHostID: its history moves
+// to the surviving agent, which keeps its own details but inherits missing
+// ones, and the old row is deleted
+func (db *DB) MergeAgents(orgID, fromHostID, intoHostID string) error {
+	if fromHostID == intoHostID {
+		return fmt.Errorf("cannot merge agent %s into itself", fromHostID)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, hostID := range []string{fromHostID, intoHostID} {
+		if exists, err := agentExists(tx, orgID, hostID); err != nil {
+			return fmt.Errorf("failed to check agent: %w", err)
+		} else if !exists {
+			return fmt.Errorf("agent not found: %s/%s", orgID, hostID)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE "Agent" AS dst
+		SET name = COALESCE(dst.name, src.name),
+			"ipAddress" = COALESCE(dst."ipAddress", src."ipAddress"),
+			"osInfo" = COALESCE(dst."osInfo", src."osInfo"),
+			config = COALESCE(dst.config, src.config),
+			inventory = COALESCE(dst.inventory, src.inventory),
+			"inventoryAt" = COALESCE(dst."inventoryAt", src."inventoryAt"),
+			"createdAt" = LEAST(dst."createdAt", src."createdAt"),
+			"updatedAt" = NOW()
+		FROM "Agent" AS src
+		WHERE dst."organizationId" = $1 AND dst."hostId" = $2
+			AND src."organizationId" = $1 AND src."hostId" = $3
+	`, orgID, intoHostID, fromHostID)
+	if err != nil {
+		return fmt.Errorf("failed to merge agent details: %w", err)
+	}
+
+	// Rollup buckets both agents have cannot be combined exactly; keep the
+	// surviving agent's and let the next rollup pass recompute them
+	_, err = tx.Exec(`
+		DELETE FROM "SystemMetricRollup" AS src
+		USING "SystemMetricRollup" AS dst
+		WHERE src."organizationId" = $1 AND src."hostId" = $2
+			AND dst."organizationId" = $1 AND dst."hostId" = $3
+			AND src.resolution = dst.resolution AND src.bucket = dst.bucket
+	`, orgID, fromHostID, intoHostID)
+	if err != nil {
+		return fmt.Errorf("failed to drop overlapping rollups: %w", err)
+	}
+
+	// The surviving agent's packages, findings and keys are the current ones
+	for _, table := range []string{"HostPackage", "VulnerabilityFinding", "AuthorizedKey"} {
+		query := fmt.Sprintf(`
+			DELETE FROM %[1]q
+			WHERE "organizationId" = $1 AND "hostId" = $2
+				AND EXISTS (SELECT 1 FROM %[1]q WHERE "organizationId" = $1 AND "hostId" = $3)
+		`, table)
+		if _, err := tx.Exec(query, orgID, fromHostID, intoHostID); err != nil {
+			return fmt.Errorf("failed to drop merged %s rows: %w", table, err)
+		}
+	}
+
+	if err := moveHostRows(tx, orgID, fromHostID, intoHostID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM "Agent" WHERE "organizationId" = $1 AND "hostId" = $2`, orgID, fromHostID); err != nil {
+		return fmt.Errorf("failed to delete merged agent: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	log.Printf("✅ Agent merged: %s/%s -> %s", orgID, fromHostID, intoHostID)
+	return nil
+}
+
+// AdoptLegacyAgent re-keys the first existing agent row registered under a
+// legacy host ID to agentID, unless agentID is already registered. It
+// reports whether a row was adopted.
+func (db *DB) AdoptLegacyAgent(orgID, agentID string, legacyHostIDs ...string) (bool, error) {
+	if exists, err := agentExists(db.conn, orgID, agentID); err != nil || exists {
+		return false, err
+	}
+
+	for _, legacy := range legacyHostIDs {
+		if legacy == "" || legacy == agentID {
+			continue
+		}
+		exists, err := agentExists(db.conn, orgID, legacy)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return true, db.RekeyAgent(orgID, legacy, agentID)
+		}
+	}
+	return false, nil
+}
+
+// moveHostRows re-points host-scoped rows from one host ID to another
+func moveHostRows(tx *sql.Tx, orgID, fromHostID, toHostID string) error {
+	for _, table := range hostScopedTables {
+		query := fmt.Sprintf(`UPDATE %q SET "hostId" = $1 WHERE "organizationId" = $2 AND "hostId" = $3`, table)
+		if _, err := tx.Exec(query, toHostID, orgID, fromHostID); err != nil {
+			return fmt.Errorf("failed to move %s rows: %w", table, err)
+		}
+	}
+	return nil
+}
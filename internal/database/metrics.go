@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Metric rollup resolutions (MetricResolution enum)
+const (
+	ResolutionMinute = "MINUTE"
+	ResolutionHour   = "HOUR"
+	ResolutionDay    = "DAY"
+)
+
+// SystemMetric is one raw metric sample of a host
+type SystemMetric struct {
+	CPUUsage    float64
+	MemoryUsage float64
+	DiskUsage   float64
+	NetworkIn   float64
+	NetworkOut  float64
+	Timestamp   time.Time
+}
+
+// rollupUnits maps each resolution to its date_trunc unit
+var rollupUnits = map[string]string{
+	ResolutionMinute: "minute",
+	ResolutionHour:   "hour",
+	ResolutionDay:    "day",
+}
+
+// rollupSources maps each coarser resolution to the one it is built from
+var rollupSources = map[string]string{
+	ResolutionHour: ResolutionMinute,
+	ResolutionDay:  ResolutionHour,
+}
+
+// InsertSystemMetric stores a raw metric sample
+func (db *DB) InsertSystemMetric(orgID, hostID string, m SystemMetric) error {
+	query := `
+		INSERT INTO "SystemMetric" (id, "organizationId", "hostId", "cpuUsage", "memoryUsage", "diskUsage", "networkIn", "networkOut", "timestamp")
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := db.conn.Exec(query, orgID, hostID, m.CPUUsage, m.MemoryUsage, m.DiskUsage, m.NetworkIn, m.NetworkOut, m.Timestamp.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert system metric: %w", err)
+	}
+	return nil
+}
+
+// RollupSystemMetrics (re)computes the rollup buckets of a resolution that
+// start at or after since. Minute buckets aggregate raw samples; hour and
+// day buckets aggregate the next finer rollup, weighting averages by count.
+func (db *DB) RollupSystemMetrics(resolution string, since time.Time) (int64, error) {
+	unit, ok := rollupUnits[resolution]
+	if !ok {
+		return 0, fmt.Errorf("unknown metric resolution: %s", resolution)
+	}
+
+	var query string
+	if source, ok := rollupSources[resolution]; ok {
+		query = fmt.Sprintf(`
+			INSERT INTO "SystemMetricRollup" (id, "organizationId", "hostId", resolution, bucket, "sampleCount",
+				"cpuMin", "cpuAvg", "cpuMax", "memoryMin", "memoryAvg", "memoryMax", "diskMin", "diskAvg", "diskMax",
+				"networkInMin", "networkInAvg", "networkInMax", "networkOutMin", "networkOutAvg", "networkOutMax", "updatedAt")
+			SELECT gen_random_uuid(), "organizationId", "hostId", $1::"MetricResolution", date_trunc('%s', bucket), SUM("sampleCount"),
+				MIN("cpuMin"), SUM("cpuAvg" * "sampleCount") / SUM("sampleCount"), MAX("cpuMax"),
+				MIN("memoryMin"), SUM("memoryAvg" * "sampleCount") / SUM("sampleCount"), MAX("memoryMax"),
+				MIN("diskMin"), SUM("diskAvg" * "sampleCount") / SUM("sampleCount"), MAX("diskMax"),
+				MIN("networkInMin"), SUM("networkInAvg" * "sampleCount") / SUM("sampleCount"), MAX("networkInMax"),
+				MIN("networkOutMin"), SUM("networkOutAvg" * "sampleCount") / SUM("sampleCount"), MAX("networkOutMax"),
+				NOW()
+			FROM "SystemMetricRollup"
+			WHERE resolution = '%s' AND bucket >= $2
+			GROUP BY "organizationId", "hostId", date_trunc('%s', bucket)
+			%s
+		`, unit, source, unit, rollupConflict)
+	} else {
+		query = fmt.Sprintf(`
+			INSERT INTO "SystemMetricRollup" (id, "organizationId", "hostId", resolution, bucket, "sampleCount",
+				"cpuMin", "cpuAvg", "cpuMax", "memoryMin", "memoryAvg", "memoryMax", "diskMin", "diskAvg", "diskMax",
+				"networkInMin", "networkInAvg", "networkInMax", "networkOutMin", "networkOutAvg", "networkOutMax", "updatedAt")
+			SELECT gen_random_uuid(), "organizationId", "hostId", $1::"MetricResolution", date_trunc('%s', "timestamp"), COUNT(*),
+				MIN("cpuUsage"), AVG("cpuUsage"), MAX("cpuUsage"),
+				MIN("memoryUsage"), AVG("memoryUsage"), MAX("memoryUsage"),
+				MIN("diskUsage"), AVG("diskUsage"), MAX("diskUsage"),
+				MIN("networkIn"), AVG("networkIn"), MAX("networkIn"),
+				MIN("networkOut"), AVG("networkOut"), MAX("networkOut"),
+				NOW()
+			FROM "SystemMetric"
+			WHERE "timestamp" >= $2
+			GROUP BY "organizationId", "hostId", date_trunc('%s', "timestamp")
+			%s
+		`, unit, unit, rollupConflict)
+	}
+
+	result, err := db.conn.Exec(query, resolution, since.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to roll up %s metrics: %w", resolution, err)
+	}
+	return result.RowsAffected()
+}
+
+// rollupConflict refreshes buckets that were already aggregated
+const rollupConflict = `
+	ON CONFLICT ("organizationId", "hostId", resolution, bucket)
+	DO UPDATE SET
+		"sampleCount" = EXCLUDED."sampleCount",
+		"cpuMin" = EXCLUDED."cpuMin", "cpuAvg" = EXCLUDED."cpuAvg", "cpuMax" = EXCLUDED."cpuMax",
+		"memoryMin" = EXCLUDED."memoryMin", "memoryAvg" = EXCLUDED."memoryAvg", "memoryMax" = EXCLUDED."memoryMax",
+		"diskMin" = EXCLUDED."diskMin", "diskAvg" = EXCLUDED."diskAvg", "diskMax" = EXCLUDED."diskMax",
+		"networkInMin" = EXCLUDED."networkInMin", "networkInAvg" = EXCLUDED."networkInAvg", "networkInMax" = EXCLUDED."networkInMax",
+		"networkOutMin" = EXCLUDED."networkOutMin", "networkOutAvg" = EXCLUDED."networkOutAvg", "networkOutMax" = EXCLUDED."networkOutMax",
+		"updatedAt" = NOW()
+`
+
+// PruneSystemMetrics deletes raw samples (empty resolution) or rollups of a
+// resolution older than before
+func (db *DB) PruneSystemMetrics(resolution string, before time.Time) (int64, error) {
+	var result sql.Result
+	var err error
+	if resolution == "" {
+		result, err = db.conn.Exec(`DELETE FROM "SystemMetric" WHERE "timestamp" < $1`, before.UTC())
+	} else {
+		result, err = db.conn.Exec(`DELETE FROM "SystemMetricRollup" WHERE resolution = $1::"MetricResolution" AND bucket < $2`, resolution, before.UTC())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune %s metrics: %w", resolution, err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// HostPackage is one installed package of a host
+type HostPackage struct {
+	Name        string
+	Version     string
+	Arch        string
+	Source      string
+	InstalledAt time.Time
+}
+
+// ReplaceHostPackages stores a host's full package inventory, replacing the
+// previous one
+func (db *DB) ReplaceHostPackages(orgID, hostID, manager string, pkgs []HostPackage) error {
+	names := make([]string, len(pkgs))
+	versions := make([]string, len(pkgs))
+	arches := make([]string, len(pkgs))
+	sources := make([]string, len(pkgs))
+	installed := make([]string, len(pkgs))
+	for i, p := range pkgs {
+		names[i], versions[i], arches[i], sources[i] = p.Name, p.Version, p.Arch, p.Source
+		if !p.InstalledAt.IsZero() {
+			installed[i] = p.InstalledAt.UTC().Format(time.RFC3339)
+		}
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin package update: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM "HostPackage" WHERE "organizationId" = $1 AND "hostId" = $2`, orgID, hostID); err != nil {
+		return fmt.Errorf("failed to clear host packages: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO "HostPackage" (id, "organizationId", "hostId", manager, name, version, arch, source, "installedAt", "updatedAt")
+		SELECT gen_random_uuid(), $1, $2, $3, p.name, p.version, p.arch, NULLIF(p.source, ''), NULLIF(p.installed, '')::timestamptz, NOW()
+		FROM unnest($4::text[], $5::text[], $6::text[], $7::text[], $8::text[]) AS p(name, version, arch, source, installed)
+		ON CONFLICT ("organizationId", "hostId", name, arch) DO NOTHING
+	`, orgID, hostID, manager, pq.Array(names), pq.Array(versions), pq.Array(arches), pq.Array(sources), pq.Array(installed))
+	if err != nil {
+		return fmt.Errorf("failed to insert host packages: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit package update: %w", err)
+	}
+	return nil
+}
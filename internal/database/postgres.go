@@ -192,3 +192,30 @@ func (db *DB) GetAgent(orgID, hostID string) (*Agent, error) {
 
 	return &agent, nil
 }
+
+// UpdateAgentInventory stores the latest inventory snapshot on the agent record
+// and refreshes the agent's primary IP address when the snapshot has one
+func (db *DB) UpdateAgentInventory(orgID, hostID string, inventory []byte, collectedAt time.Time, primaryIP string) error {
+	query := `
+		UPDATE "Agent"
+		SET inventory = $1::jsonb, "inventoryAt" = $2, "ipAddress" = COALESCE(NULLIF($3, ''), "ipAddress"),
+			"lastSeen" = NOW(), "updatedAt" = NOW()
+		WHERE "organizationId" = $4 AND "hostId" = $5
+	`
+
+	result, err := db.conn.Exec(query, string(inventory), collectedAt.UTC(), primaryIP, orgID, hostID)
+	if err != nil {
+		return fmt.Errorf("failed to update agent inventory: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("agent not found: %s/%s", orgID, hostID)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AuthorizedKey is an SSH key trusted by a user's authorized_keys file
+type AuthorizedKey struct {
+	HostID      string
+	User        string
+	File        string
+	Fingerprint string
+	KeyType     string
+	Comment     string
+	Options     string
+	FirstSeen   time.Time
+}
+
+// ReplaceAuthorizedKeys stores a host's full authorized key list. Keys seen
+// before keep their firstSeen time; keys no longer present are deleted.
+func (db *DB) ReplaceAuthorizedKeys(orgID, hostID string, keys []AuthorizedKey) error {
+	var users, files, fingerprints, types, comments, options []string
+	ids := []string{} // an empty array, not NULL, so every row is deleted
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		// A key listed twice in one file is stored once
+		id := k.User + "\x1f" + k.File + "\x1f" + k.Fingerprint
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		users, files, fingerprints = append(users, k.User), append(files, k.File), append(fingerprints, k.Fingerprint)
+		types, comments, options = append(types, k.KeyType), append(comments, k.Comment), append(options, k.Options)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin authorized key update: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM "AuthorizedKey"
+		WHERE "organizationId" = $1 AND "hostId" = $2
+			AND NOT ("user" || chr(31) || file || chr(31) || fingerprint = ANY($3::text[]))
+	`, orgID, hostID, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to delete removed authorized keys: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO "AuthorizedKey" (id, "organizationId", "hostId", "user", file, fingerprint, "keyType", comment, options, "firstSeen", "updatedAt")
+		SELECT gen_random_uuid(), $1, $2, k.usr, k.file, k.fingerprint, k.type, NULLIF(k.comment, ''), NULLIF(k.options, ''), NOW(), NOW()
+		FROM unnest($3::text[], $4::text[], $5::text[], $6::text[], $7::text[], $8::text[])
+			AS k(usr, file, fingerprint, type, comment, options)
+		ON CONFLICT ("organizationId", "hostId", "user", file, fingerprint) DO UPDATE
+		SET "keyType" = EXCLUDED."keyType", comment = EXCLUDED.comment, options = EXCLUDED.options, "updatedAt" = NOW()
+	`, orgID, hostID, pq.Array(users), pq.Array(files), pq.Array(fingerprints), pq.Array(types), pq.Array(comments), pq.Array(options))
+	if err != nil {
+		return fmt.Errorf("failed to upsert authorized keys: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit authorized key update: %w", err)
+	}
+	return nil
+}
+
+// HostsTrustingKey lists every host and user of an organization whose
+// authorized_keys files contain the key with the given fingerprint
+func (db *DB) HostsTrustingKey(orgID, fingerprint string) ([]AuthorizedKey, error) {
+	rows, err := db.conn.Query(`
+		SELECT "hostId", "user", file, fingerprint, "keyType", COALESCE(comment, ''), COALESCE(options, ''), "firstSeen"
+		FROM "AuthorizedKey"
+		WHERE "organizationId" = $1 AND fingerprint = $2
+		ORDER BY "hostId", "user", file
+	`, orgID, fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query authorized keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []AuthorizedKey
+	for rows.Next() {
+		var k AuthorizedKey
+		if err := rows.Scan(&k.HostID, &k.User, &k.File, &k.Fingerprint, &k.KeyType, &k.Comment, &k.Options, &k.FirstSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan authorized key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
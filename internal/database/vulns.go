@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// PackageHost is a host with a stored package inventory, with the OS
+// release from its latest host inventory
+type PackageHost struct {
+	OrgID     string
+	HostID    string
+	Manager   string
+	OSID      string
+	OSVersion string
+}
+
+// VulnerabilityFinding is an installed package affected by an advisory
+type VulnerabilityFinding struct {
+	AdvisoryID       string
+	Aliases          []string
+	Package          string
+	InstalledVersion string
+	FixedVersion     string
+	Severity         string
+	Score            float64
+	Summary          string
+}
+
+// packageHostsQuery lists hosts with packages; callers append a filter
+const packageHostsQuery = `
+	SELECT DISTINCT p."organizationId", p."hostId", p.manager,
+		COALESCE(a.inventory->'os'->>'id', ''), COALESCE(a.inventory->'os'->>'version', '')
+	FROM "HostPackage" p
+	LEFT JOIN "Agent" a ON a."organizationId" = p."organizationId" AND a."hostId" = p."hostId"
+`
+
+// PackageHosts lists every host with a stored package inventory
+func (db *DB) PackageHosts() ([]PackageHost, error) {
+	rows, err := db.conn.Query(packageHostsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list package hosts: %w", err)
+	}
+	return scanPackageHosts(rows)
+}
+
+// PackageHost returns one host's package manager and OS release, or nil when
+// it has no stored package inventory
+func (db *DB) PackageHost(orgID, hostID string) (*PackageHost, error) {
+	rows, err := db.conn.Query(packageHostsQuery+` WHERE p."organizationId" = $1 AND p."hostId" = $2`, orgID, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package host: %w", err)
+	}
+	hosts, err := scanPackageHosts(rows)
+	if err != nil || len(hosts) == 0 {
+		return nil, err
+	}
+	return &hosts[0], nil
+}
+
+// scanPackageHosts reads packageHostsQuery rows
+func scanPackageHosts(rows *sql.Rows) ([]PackageHost, error) {
+	defer rows.Close()
+	var hosts []PackageHost
+	for rows.Next() {
+		var h PackageHost
+		if err := rows.Scan(&h.OrgID, &h.HostID, &h.Manager, &h.OSID, &h.OSVersion); err != nil {
+			return nil, fmt.Errorf("failed to scan package host: %w", err)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, rows.Err()
+}
+
+// HostPackages returns a host's stored package inventory
+func (db *DB) HostPackages(orgID, hostID string) ([]HostPackage, error) {
+	rows, err := db.conn.Query(`
+		SELECT name, version, arch, COALESCE(source, '')
+		FROM "HostPackage"
+		WHERE "organizationId" = $1 AND "hostId" = $2
+	`, orgID, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host packages: %w", err)
+	}
+	defer rows.Close()
+
+	var pkgs []HostPackage
+	for rows.Next() {
+		var p HostPackage
+		if err := rows.Scan(&p.Name, &p.Version, &p.Arch, &p.Source); err != nil {
+			return nil, fmt.Errorf("failed to scan host package: %w", err)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, rows.Err()
+}
+
+// SyncVulnerabilityFindings records a host's current findings: new ones are
+// opened, existing ones refreshed (reopened if they had been resolved), and
+// open findings no longer present are resolved. It returns how many were
+// resolved.
+func (db *DB) SyncVulnerabilityFindings(orgID, hostID, ecosystem string, findings []VulnerabilityFinding) (int64, error) {
+	n := len(findings)
+	advisories, aliases, pkgs := make([]string, n), make([]string, n), make([]string, n)
+	installed, fixed, severities, summaries := make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	scores := make([]float64, n)
+	keys := make([]string, n)
+	for i, f := range findings {
+		advisories[i], aliases[i], pkgs[i] = f.AdvisoryID, strings.Join(f.Aliases, ","), f.Package
+		installed[i], fixed[i], severities[i], summaries[i] = f.InstalledVersion, f.FixedVersion, f.Severity, f.Summary
+		scores[i] = f.Score
+		keys[i] = f.AdvisoryID + "/" + f.Package
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin findings update: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO "VulnerabilityFinding" (id, "organizationId", "hostId", "advisoryId", aliases, package,
+			"installedVersion", "fixedVersion", severity, score, summary, ecosystem, "firstSeen", "lastSeen", "updatedAt")
+		SELECT gen_random_uuid(), $1, $2, f.advisory, string_to_array(NULLIF(f.aliases, ''), ','), f.package,
+			f.installed, NULLIF(f.fixed, ''), f.severity, NULLIF(f.score, 0), NULLIF(f.summary, ''), $3, NOW(), NOW(), NOW()
+		FROM unnest($4::text[], $5::text[], $6::text[], $7::text[], $8::text[], $9::text[], $10::float8[], $11::text[])
+			AS f(advisory, aliases, package, installed, fixed, severity, score, summary)
+		ON CONFLICT ("organizationId", "hostId", "advisoryId", package) DO UPDATE
+		SET aliases = EXCLUDED.aliases, "installedVersion" = EXCLUDED."installedVersion",
+			"fixedVersion" = EXCLUDED."fixedVersion", severity = EXCLUDED.severity, score = EXCLUDED.score,
+			summary = EXCLUDED.summary, ecosystem = EXCLUDED.ecosystem, "lastSeen" = NOW(),
+			"firstSeen" = CASE WHEN "VulnerabilityFinding"."resolvedAt" IS NULL THEN "VulnerabilityFinding"."firstSeen" ELSE NOW() END,
+			"resolvedAt" = NULL, "updatedAt" = NOW()
+	`, orgID, hostID, ecosystem, pq.Array(advisories), pq.Array(aliases), pq.Array(pkgs), pq.Array(installed),
+		pq.Array(fixed), pq.Array(severities), pq.Array(scores), pq.Array(summaries))
+	if err != nil {
+		return 0, fmt.Errorf("failed to upsert vulnerability findings: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE "VulnerabilityFinding"
+		SET "resolvedAt" = NOW(), "updatedAt" = NOW()
+		WHERE "organizationId" = $1 AND "hostId" = $2 AND "resolvedAt" IS NULL
+			AND NOT ("advisoryId" || '/' || package = ANY($3::text[]))
+	`, orgID, hostID, pq.Array(keys))
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve vulnerability findings: %w", err)
+	}
+	resolved, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit findings update: %w", err)
+	}
+	return resolved, nil
+}
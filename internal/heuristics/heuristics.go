@@ -0,0 +1,209 @@
+// Package heuristics flags suspicious processes: reverse shells, interpreters
+// running inline code, shells spawned by services and binaries executed from
+// temporary directories.
+package heuristics
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Process is what the heuristics know about a running process
+type Process struct {
+	PID     int
+	PPID    int
+	Start   uint64 // start time in clock ticks after boot; tells reused PIDs apart
+	Name    string // comm, at most 15 characters
+	Exe     string
+	Cmdline []string
+	UID     int
+	User    string
+	// StdioSockets maps stdin/stdout/stderr (0-2) to the remote address of
+	// the TCP or UDP socket they are connected to
+	StdioSockets map[int]string
+}
+
+// Finding is one heuristic that matched a process
+type Finding struct {
+	Heuristic string
+	Severity  string
+	Reason    string
+}
+
+var shellNames = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true, "mksh": true,
+	"ash": true, "fish": true, "tcsh": true, "csh": true,
+}
+
+// inlineCodeFlags are the flags that make an interpreter run code given on
+// its command line, by interpreter name without a version suffix
+var inlineCodeFlags = map[string][]string{
+	"python": {"-c"},
+	"perl":   {"-e", "-E"},
+	"ruby":   {"-e"},
+	"php":    {"-r"},
+	"node":   {"-e", "--eval", "-p", "--print"},
+	"nodejs": {"-e", "--eval", "-p", "--print"},
+	"lua":    {"-e"},
+}
+
+// inlineCodeIndicators in inline code point at a network shell rather than a
+// one-liner from a script
+var inlineCodeIndicators = []string{
+	"socket", "/dev/tcp", "/dev/udp", "pty.spawn", "subprocess", "dup2", "fsockopen",
+	"TCPSocket", "IO::Socket", "child_process", "net.connect", "base64", "exec(", "system(",
+}
+
+// webUsers run web servers and application servers
+var webUsers = map[string]bool{
+	"www-data": true, "apache": true, "nginx": true, "httpd": true, "http": true,
+	"lighttpd": true, "wwwrun": true, "caddy": true, "tomcat": true, "jetty": true,
+}
+
+// databaseUsers run database servers
+var databaseUsers = map[string]bool{
+	"mysql": true, "postgres": true, "mongodb": true, "redis": true, "oracle": true,
+	"mssql": true, "elasticsearch": true, "cassandra": true, "couchdb": true, "clickhouse": true,
+}
+
+// webServers and databaseServers are the process names of those services
+var webServers = []string{"nginx", "apache2", "httpd", "php-fpm", "lighttpd", "caddy", "uwsgi", "gunicorn"}
+var databaseServers = []string{"mysqld", "mariadbd", "postgres", "mongod", "redis-server"}
+
+// tempExecDirs are world-writable directories binaries shouldn't run from
+var tempExecDirs = []string{"/tmp/", "/var/tmp/", "/dev/shm/"}
+
+// ProgramName returns the name heuristics match on: the executable's base
+// name, or comm for processes whose executable can't be read
+func (p Process) ProgramName() string {
+	if p.Exe != "" {
+		return filepath.Base(strings.TrimSuffix(p.Exe, " (deleted)"))
+	}
+	return p.Name
+}
+
+// IsShell reports whether the process is a shell
+func (p Process) IsShell() bool {
+	return shellNames[p.ProgramName()] || shellNames[p.Name]
+}
+
+// Interpreter returns the name and inline code flags of an interpreter
+// process. Names match exactly apart from a version suffix (python3.11,
+// php8.2), so php-fpm or a uwsgi binary are not interpreters.
+func (p Process) Interpreter() (string, []string) {
+	name := strings.TrimRight(p.ProgramName(), "0123456789.")
+	if flags, ok := inlineCodeFlags[name]; ok {
+		return name, flags
+	}
+	return "", nil
+}
+
+// Evaluate runs the heuristics on a process; ancestors lists its
+// parent, grandparent and so on
+func Evaluate(p Process, ancestors []Process) []Finding {
+	var findings []Finding
+	interpreter, flags := p.Interpreter()
+	shellLike := p.IsShell() || interpreter != ""
+
+	// Shell with its standard streams on a network socket
+	if shellLike && len(p.StdioSockets) > 0 {
+		var streams []string
+		for fd := 0; fd <= 2; fd++ {
+			if remote, ok := p.StdioSockets[fd]; ok {
+				streams = append(streams, fmt.Sprintf("fd %d -> %s", fd, remote))
+			}
+		}
+		findings = append(findings, Finding{
+			Heuristic: "reverse_shell",
+			Severity:  "critical",
+			Reason:    fmt.Sprintf("%s has standard streams connected to the network (%s)", p.ProgramName(), strings.Join(streams, ", ")),
+		})
+	} else if cmdline := strings.Join(p.Cmdline, " "); p.IsShell() && (strings.Contains(cmdline, "/dev/tcp/") || strings.Contains(cmdline, "/dev/udp/")) {
+		findings = append(findings, Finding{
+			Heuristic: "reverse_shell",
+			Severity:  "critical",
+			Reason:    fmt.Sprintf("%s redirects through /dev/tcp or /dev/udp", p.ProgramName()),
+		})
+	}
+
+	// Interpreter running code from its command line
+	inlineCode := false
+	if interpreter != "" {
+		for i, arg := range p.Cmdline {
+			if i == 0 || !slices.Contains(flags, arg) {
+				continue
+			}
+			code := ""
+			if i+1 < len(p.Cmdline) {
+				code = p.Cmdline[i+1]
+			}
+			severity := "warning"
+			for _, indicator := range inlineCodeIndicators {
+				if strings.Contains(code, indicator) {
+					severity = "critical"
+					break
+				}
+			}
+			findings = append(findings, Finding{
+				Heuristic: "inline_interpreter",
+				Severity:  severity,
+				Reason:    fmt.Sprintf("%s runs inline code with %s", interpreter, arg),
+			})
+			inlineCode = true
+			break
+		}
+	}
+
+	// Shell spawned by a web server or database. Interpreters only count
+	// when running inline code: application workers (gunicorn, node, PHP)
+	// run as the service user all the time.
+	if p.IsShell() || inlineCode {
+		switch parent := serviceAncestor(ancestors, webServers); {
+		case webUsers[p.User]:
+			findings = append(findings, Finding{"service_shell", "critical", fmt.Sprintf("%s running as web server user %s", p.ProgramName(), p.User)})
+		case parent != "":
+			findings = append(findings, Finding{"service_shell", "critical", fmt.Sprintf("%s spawned by web server %s", p.ProgramName(), parent)})
+		case databaseUsers[p.User]:
+			findings = append(findings, Finding{"service_shell", "warning", fmt.Sprintf("%s running as database user %s", p.ProgramName(), p.User)})
+		default:
+			if parent := serviceAncestor(ancestors, databaseServers); parent != "" {
+				findings = append(findings, Finding{"service_shell", "warning", fmt.Sprintf("%s spawned by database %s", p.ProgramName(), parent)})
+			}
+		}
+	}
+
+	// Binary executed from a world-writable temporary directory
+	exe := strings.TrimSuffix(p.Exe, " (deleted)")
+	for _, dir := range tempExecDirs {
+		if !strings.HasPrefix(exe, dir) {
+			continue
+		}
+		severity := "warning"
+		if dir == "/dev/shm/" || webUsers[p.User] {
+			severity = "critical"
+		}
+		findings = append(findings, Finding{
+			Heuristic: "temp_exec",
+			Severity:  severity,
+			Reason:    fmt.Sprintf("executable runs from %s", strings.TrimSuffix(dir, "/")),
+		})
+		break
+	}
+
+	return findings
+}
+
+// serviceAncestor returns the first ancestor whose name starts with one of
+// the given service names
+func serviceAncestor(ancestors []Process, services []string) string {
+	for _, a := range ancestors {
+		for _, s := range services {
+			if strings.HasPrefix(a.ProgramName(), s) || strings.HasPrefix(a.Name, s) {
+				return a.ProgramName()
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+// Package inventory defines the host inventory snapshot agents send on the
+// "inventory" stream. The event message carries the JSON-encoded Inventory.
+package inventory
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stream is the event stream inventory snapshots are sent on
+const Stream = "inventory"
+
+// Event types of inventory events
+const (
+	EventSnapshot = "inventory_snapshot"
+	EventUpdate   = "inventory_update"
+)
+
+// Inventory describes a host's hardware, OS and network configuration
+type Inventory struct {
+	CollectedAt      time.Time   `json:"collected_at"`
+	Hostname         string      `json:"hostname"`
+	MachineID        string      `json:"machine_id,omitempty"`
+	OS               OSInfo      `json:"os"`
+	Kernel           KernelInfo  `json:"kernel"`
+	CPU              CPUInfo     `json:"cpu"`
+	MemoryBytes      uint64      `json:"memory_bytes"`
+	SwapBytes        uint64      `json:"swap_bytes"`
+	Disks            []Disk      `json:"disks,omitempty"`
+	Mounts           []Mount     `json:"mounts,omitempty"`
+	Interfaces       []Interface `json:"interfaces,omitempty"`
+	Routes           []Route     `json:"routes,omitempty"`
+	PrimaryIP        string      `json:"primary_ip"`
+	DefaultInterface string      `json:"default_interface,omitempty"`
+	BootTime         time.Time   `json:"boot_time"`
+	UptimeSeconds    float64     `json:"uptime_seconds"`
+	Virtualization   string      `json:"virtualization"` // "none", "kvm", "vmware", ...
+	Container        string      `json:"container"`      // "none", "docker", "lxc", ...
+	Timezone         string      `json:"timezone"`
+	AgentVersion     string      `json:"agent_version"`
+}
+
+// OSInfo identifies the distribution from os-release
+type OSInfo struct {
+	ID         string `json:"id"`
+	Version    string `json:"version"`
+	PrettyName string `json:"pretty_name"`
+}
+
+// KernelInfo is the uname of the host
+type KernelInfo struct {
+	Release      string `json:"release"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+}
+
+// CPUInfo describes the processors
+type CPUInfo struct {
+	Model   string `json:"model"`
+	Vendor  string `json:"vendor,omitempty"`
+	Sockets int    `json:"sockets"`
+	Cores   int    `json:"cores"`
+	Threads int    `json:"threads"`
+	MHz     int    `json:"mhz,omitempty"`
+}
+
+// Disk is a whole block device
+type Disk struct {
+	Name       string `json:"name"`
+	SizeBytes  uint64 `json:"size_bytes"`
+	Model      string `json:"model,omitempty"`
+	Serial     string `json:"serial,omitempty"`
+	Rotational bool   `json:"rotational"`
+	Removable  bool   `json:"removable"`
+}
+
+// Mount is a mounted filesystem backed by a device
+type Mount struct {
+	Mount      string `json:"mount"`
+	Device     string `json:"device"`
+	Type       string `json:"type"`
+	TotalBytes uint64 `json:"total_bytes"`
+	ReadOnly   bool   `json:"read_only"`
+}
+
+// Interface is a network interface and its addresses
+type Interface struct {
+	Name string   `json:"name"`
+	MAC  string   `json:"mac,omitempty"`
+	MTU  int      `json:"mtu"`
+	Up   bool     `json:"up"`
+	IPv4 []string `json:"ipv4,omitempty"`
+	IPv6 []string `json:"ipv6,omitempty"`
+	// Default marks the interface carrying the preferred default route
+	Default bool `json:"default,omitempty"`
+}
+
+// Route is a kernel routing table entry
+type Route struct {
+	Family      string `json:"family"` // "ipv4" or "ipv6"
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	Interface   string `json:"interface"`
+	Metric      int    `json:"metric"`
+}
+
+// Decode parses an inventory event message
+func Decode(message string) (*Inventory, error) {
+	var inv Inventory
+	if err := json.Unmarshal([]byte(message), &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
@@ -0,0 +1,252 @@
+// Package kmod parses the kernel's list of loaded modules, its taint mask and
+// the kernel log lines written when modules are loaded, and tells whether a
+// module file carries an appended signature.
+package kmod
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Stream is the event stream kernel module events are sent on
+const Stream = "kernel_modules"
+
+// Event types of kernel module events
+const (
+	EventLoaded       = "kernel_module_loaded"
+	EventUnloaded     = "kernel_module_unloaded"
+	EventTaintChanged = "kernel_taint_changed"
+	EventLog          = "kernel_module_log"
+)
+
+// Signature states of a module file
+const (
+	Signed   = "signed"
+	Unsigned = "unsigned"
+	Unknown  = "unknown"
+)
+
+// signatureMagic ends every module with an appended signature
+const signatureMagic = "~Module signature appended~\n"
+
+// Module is one entry of /proc/modules
+type Module struct {
+	Name     string   `json:"name"`
+	Size     int64    `json:"size"`
+	RefCount int      `json:"refcount"`
+	Deps     []string `json:"deps,omitempty"`
+	State    string   `json:"state"`
+	Taint    string   `json:"taint,omitempty"` // e.g. "OE"
+}
+
+// ParseModules reads the /proc/modules format:
+//
+//	name size refcount deps state address [(taint)]
+func ParseModules(r io.Reader) ([]Module, error) {
+	var modules []Module
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		m := Module{Name: fields[0], State: fields[4]}
+		m.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+		m.RefCount, _ = strconv.Atoi(fields[2])
+		if fields[3] != "-" {
+			for _, dep := range strings.Split(fields[3], ",") {
+				// [permanent] and [unsafe] mark how the module unloads
+				if dep != "" && !strings.HasPrefix(dep, "[") {
+					m.Deps = append(m.Deps, dep)
+				}
+			}
+		}
+		if last := fields[len(fields)-1]; len(fields) > 6 && strings.HasPrefix(last, "(") {
+			m.Taint = strings.Trim(last, "()")
+		}
+		modules = append(modules, m)
+	}
+	return modules, scanner.Err()
+}
+
+// Taint is one bit of the kernel taint mask
+type Taint struct {
+	Bit         int
+	Flag        string
+	Description string
+}
+
+// Taints lists the taint bits documented in the kernel's tainted-kernels.rst
+var Taints = []Taint{
+	{0, "P", "proprietary module was loaded"},
+	{1, "F", "module was force loaded"},
+	{2, "S", "kernel running on an out of specification system"},
+	{3, "R", "module was force unloaded"},
+	{4, "M", "processor reported a machine check exception"},
+	{5, "B", "bad page referenced or unexpected page flags"},
+	{6, "U", "taint requested by userspace"},
+	{7, "D", "kernel died recently (oops or BUG)"},
+	{8, "A", "ACPI table overridden by user"},
+	{9, "W", "kernel issued a warning"},
+	{10, "C", "staging driver was loaded"},
+	{11, "I", "workaround for platform firmware bug applied"},
+	{12, "O", "externally built (out-of-tree) module was loaded"},
+	{13, "E", "unsigned module was loaded"},
+	{14, "L", "soft lockup occurred"},
+	{15, "K", "kernel has been live patched"},
+	{16, "X", "auxiliary taint, defined for distributions"},
+	{17, "T", "kernel was built with the struct randomization plugin"},
+	{18, "N", "an in-kernel test has been run"},
+}
+
+// TaintFlags returns the taints set in a taint mask, lowest bit first
+func TaintFlags(mask uint64) []Taint {
+	var set []Taint
+	for _, t := range Taints {
+		if mask&(1<<t.Bit) != 0 {
+			set = append(set, t)
+		}
+	}
+	return set
+}
+
+// TaintString renders a taint mask as its flag letters, e.g. "OE"
+func TaintString(mask uint64) string {
+	var b strings.Builder
+	for _, t := range TaintFlags(mask) {
+		b.WriteString(t.Flag)
+	}
+	return b.String()
+}
+
+// TaintDescriptions describes each taint set in a mask
+func TaintDescriptions(mask uint64) []string {
+	var descriptions []string
+	for _, t := range TaintFlags(mask) {
+		descriptions = append(descriptions, t.Flag+": "+t.Description)
+	}
+	return descriptions
+}
+
+// moduleLogPatterns match kernel messages about loading a module; the first
+// group is the module name where the kernel prints one
+var moduleLogPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(\S+): module verification failed`),
+	regexp.MustCompile(`^(\S+): loading out-of-tree module taints kernel`),
+	regexp.MustCompile(`^(\S+): module license '.*' taints kernel`),
+	regexp.MustCompile(`^(\S+): module is from the staging directory`),
+	regexp.MustCompile(`^(\S+): module has bad taint`),
+	regexp.MustCompile(`^(\S+): Unknown symbol`),
+	regexp.MustCompile(`^()Lockdown: .*: unsigned module loading is restricted`),
+	regexp.MustCompile(`^()Disabling lock debugging due to kernel taint`),
+}
+
+// LogModule reports whether a kernel message is about module loading and
+// returns the module it names, if any
+func LogModule(message string) (string, bool) {
+	for _, re := range moduleLogPatterns {
+		if m := re.FindStringSubmatch(message); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// NormalizeName maps a module file or alias name to the form /proc/modules
+// uses, where dashes become underscores
+func NormalizeName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// ReadModulesDep maps module names to their files from a modules.dep file,
+// e.g. /lib/modules/<release>/modules.dep
+func ReadModulesDep(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	files := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		file, _, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		name, _, _ := strings.Cut(filepath.Base(file), ".ko")
+		files[NormalizeName(name)] = file
+	}
+	return files, scanner.Err()
+}
+
+// SignatureStatus reports whether a module file has an appended signature.
+// Uncompressed and gzip-compressed modules are checked directly; other
+// compression formats return Unknown.
+func SignatureStatus(path string) string {
+	var data []byte
+	var err error
+	switch {
+	case strings.HasSuffix(path, ".ko"):
+		data, err = readTail(path, len(signatureMagic))
+	case strings.HasSuffix(path, ".ko.gz"):
+		data, err = readGzip(path)
+	default:
+		return Unknown
+	}
+	if err != nil {
+		return Unknown
+	}
+	if bytes.HasSuffix(data, []byte(signatureMagic)) {
+		return Signed
+	}
+	return Unsigned
+}
+
+// readTail returns the last n bytes of a file
+func readTail(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(n) {
+		return io.ReadAll(f)
+	}
+	buf := make([]byte, n)
+	_, err = f.ReadAt(buf, info.Size()-int64(n))
+	return buf, err
+}
+
+// readGzip decompresses a gzip file, capped at 256MB
+func readGzip(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, 256<<20))
+}
@@ -0,0 +1,139 @@
+// Package metrics defines the structured system metric samples agents send
+// on the "metrics" stream. The event message carries the JSON-encoded Sample.
+package metrics
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stream is the event stream metric samples are sent on
+const Stream = "metrics"
+
+// EventType labels metric sample events
+const EventType = "metrics_sample"
+
+// Sample is one periodic snapshot of host metrics. Rates are per second over
+// IntervalSeconds; they are zero in the first sample after agent start.
+type Sample struct {
+	Time            time.Time    `json:"time"`
+	IntervalSeconds float64      `json:"interval_seconds"`
+	CPU             CPUStats     `json:"cpu"`
+	Cores           []CPUStats   `json:"cores,omitempty"`
+	Memory          MemoryStats  `json:"memory"`
+	Load            LoadStats    `json:"load"`
+	Disks           []DiskIO     `json:"disks,omitempty"`
+	Filesystems     []Filesystem `json:"filesystems,omitempty"`
+	Network         []NetIO      `json:"network,omitempty"`
+}
+
+// CPUStats holds CPU time percentages for one core or all cores
+type CPUStats struct {
+	Name   string  `json:"name"`
+	Usage  float64 `json:"usage"`
+	User   float64 `json:"user"`
+	System float64 `json:"system"`
+	IOWait float64 `json:"iowait"`
+	Steal  float64 `json:"steal"`
+	Idle   float64 `json:"idle"`
+}
+
+// MemoryStats holds memory and swap usage from /proc/meminfo
+type MemoryStats struct {
+	TotalBytes       uint64  `json:"total_bytes"`
+	AvailableBytes   uint64  `json:"available_bytes"`
+	FreeBytes        uint64  `json:"free_bytes"`
+	BuffersBytes     uint64  `json:"buffers_bytes"`
+	CachedBytes      uint64  `json:"cached_bytes"`
+	UsedBytes        uint64  `json:"used_bytes"`
+	UsagePercent     float64 `json:"usage_percent"`
+	SwapTotalBytes   uint64  `json:"swap_total_bytes"`
+	SwapFreeBytes    uint64  `json:"swap_free_bytes"`
+	SwapUsagePercent float64 `json:"swap_usage_percent"`
+}
+
+// LoadStats holds /proc/loadavg
+type LoadStats struct {
+	Load1     float64 `json:"load1"`
+	Load5     float64 `json:"load5"`
+	Load15    float64 `json:"load15"`
+	Running   int     `json:"running"`
+	Processes int     `json:"processes"`
+}
+
+// DiskIO holds block device throughput from /proc/diskstats
+type DiskIO struct {
+	Device           string  `json:"device"`
+	ReadsPerSec      float64 `json:"reads_per_sec"`
+	WritesPerSec     float64 `json:"writes_per_sec"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	UtilPercent      float64 `json:"util_percent"`
+}
+
+// Filesystem holds space and inode usage of a mounted filesystem
+type Filesystem struct {
+	Mount             string  `json:"mount"`
+	Device            string  `json:"device"`
+	Type              string  `json:"type"`
+	TotalBytes        uint64  `json:"total_bytes"`
+	AvailableBytes    uint64  `json:"available_bytes"`
+	UsedBytes         uint64  `json:"used_bytes"`
+	UsagePercent      float64 `json:"usage_percent"`
+	Inodes            uint64  `json:"inodes"`
+	InodesFree        uint64  `json:"inodes_free"`
+	InodeUsagePercent float64 `json:"inode_usage_percent"`
+}
+
+// NetIO holds interface throughput from /proc/net/dev
+type NetIO struct {
+	Interface       string  `json:"interface"`
+	RxBytesPerSec   float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec   float64 `json:"tx_bytes_per_sec"`
+	RxPacketsPerSec float64 `json:"rx_packets_per_sec"`
+	TxPacketsPerSec float64 `json:"tx_packets_per_sec"`
+	RxErrorsPerSec  float64 `json:"rx_errors_per_sec"`
+	TxErrorsPerSec  float64 `json:"tx_errors_per_sec"`
+	RxDropsPerSec   float64 `json:"rx_drops_per_sec"`
+	TxDropsPerSec   float64 `json:"tx_drops_per_sec"`
+}
+
+// Decode parses a metric sample event message
+func Decode(message string) (*Sample, error) {
+	var s Sample
+	if err := json.Unmarshal([]byte(message), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DiskUsage returns the usage of the root filesystem, or the fullest
+// filesystem when / is not reported
+func (s *Sample) DiskUsage() float64 {
+	var fullest float64
+	for _, fs := range s.Filesystems {
+		if fs.Mount == "/" {
+			return fs.UsagePercent
+		}
+		fullest = max(fullest, fs.UsagePercent)
+	}
+	return fullest
+}
+
+// NetworkIn returns the received bytes per second across all interfaces
+func (s *Sample) NetworkIn() float64 {
+	var total float64
+	for _, n := range s.Network {
+		total += n.RxBytesPerSec
+	}
+	return total
+}
+
+// NetworkOut returns the transmitted bytes per second across all interfaces
+func (s *Sample) NetworkOut() float64 {
+	var total float64
+	for _, n := range s.Network {
+		total += n.TxBytesPerSec
+	}
+	return total
+}
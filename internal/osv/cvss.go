@@ -0,0 +1,94 @@
+package osv
+
+import (
+	"math"
+	"strings"
+)
+
+// cvss3Weights are the CVSS v3.x base metric weights; PR depends on scope
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// CVSS3Score computes the base score of a CVSS v3.0/v3.1 vector such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"
+func CVSS3Score(vector string) (float64, bool) {
+	metrics := make(map[string]string)
+	for _, part := range strings.Split(vector, "/") {
+		if k, v, ok := strings.Cut(part, ":"); ok {
+			metrics[k] = v
+		}
+	}
+
+	changed := metrics["S"] == "C"
+	if metrics["S"] != "U" && !changed {
+		return 0, false
+	}
+
+	value := make(map[string]float64)
+	for metric, weights := range cvss3Weights {
+		w, ok := weights[metrics[metric]]
+		if !ok {
+			return 0, false
+		}
+		value[metric] = w
+	}
+	switch pr := metrics["PR"]; {
+	case pr == "N":
+		value["PR"] = 0.85
+	case pr == "L" && changed:
+		value["PR"] = 0.68
+	case pr == "L":
+		value["PR"] = 0.62
+	case pr == "H" && changed:
+		value["PR"] = 0.5
+	case pr == "H":
+		value["PR"] = 0.27
+	default:
+		return 0, false
+	}
+
+	iss := 1 - (1-value["C"])*(1-value["I"])*(1-value["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+	exploitability := 8.22 * value["AV"] * value["AC"] * value["PR"] * value["UI"]
+
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// roundUp rounds up to one decimal as defined by CVSS v3.1
+func roundUp(x float64) float64 {
+	i := math.Round(x * 100000)
+	if math.Mod(i, 10000) == 0 {
+		return i / 100000
+	}
+	return (math.Floor(i/10000) + 1) / 10
+}
+
+// CVSS3Rating maps a base score to its qualitative rating
+func CVSS3Rating(score float64) string {
+	switch {
+	case score >= 9:
+		return "critical"
+	case score >= 7:
+		return "high"
+	case score >= 4:
+		return "medium"
+	case score > 0:
+		return "low"
+	}
+	return "unknown"
+}
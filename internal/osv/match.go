@@ -0,0 +1,258 @@
+package osv
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mulutu/security-manager/internal/packages"
+)
+
+// Ecosystem identifies a distribution release in OSV terms
+type Ecosystem struct {
+	Name    string // "Debian", "Ubuntu", "AlmaLinux", "Rocky Linux", "Red Hat"
+	Release string // "12", "22.04", "9"
+}
+
+// HostEcosystem maps an os-release ID and VERSION_ID to the OSV ecosystem of
+// the distribution's security advisories
+func HostEcosystem(osID, version string) (Ecosystem, bool) {
+	major, _, _ := strings.Cut(version, ".")
+	switch osID {
+	case "debian":
+		return Ecosystem{"Debian", major}, major != ""
+	case "ubuntu":
+		return Ecosystem{"Ubuntu", version}, version != ""
+	case "almalinux":
+		return Ecosystem{"AlmaLinux", major}, major != ""
+	case "rocky":
+		return Ecosystem{"Rocky Linux", major}, major != ""
+	case "rhel":
+		return Ecosystem{"Red Hat", major}, major != ""
+	}
+	return Ecosystem{}, false
+}
+
+// String renders the ecosystem as "Name:Release"
+func (e Ecosystem) String() string {
+	return e.Name + ":" + e.Release
+}
+
+// matches reports whether an advisory ecosystem such as "Ubuntu:22.04:LTS"
+// or "Red Hat:enterprise_linux:9::appstream" covers the release. Paid
+// extended-support streams (Ubuntu Pro) are not matched.
+func (e Ecosystem) matches(ecosystem string) bool {
+	parts := strings.Split(ecosystem, ":")
+	if parts[0] != e.Name {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+	for _, part := range parts[1:] {
+		if part == "Pro" {
+			return false
+		}
+	}
+	for _, part := range parts[1:] {
+		if part == e.Release {
+			return true
+		}
+	}
+	return false
+}
+
+// Database indexes advisories by ecosystem name and package name
+type Database struct {
+	// Advisories and Skipped count the loaded and unreadable files
+	Advisories int
+	Skipped    int
+
+	byPackage map[string][]entry
+}
+
+// entry is one affected package of an advisory
+type entry struct {
+	advisory *Advisory
+	affected *Affected
+}
+
+// NewDatabase returns an empty advisory database
+func NewDatabase() *Database {
+	return &Database{byPackage: make(map[string][]entry)}
+}
+
+// Add indexes an advisory; withdrawn advisories are ignored
+func (db *Database) Add(adv *Advisory) {
+	if adv.Withdrawn != nil {
+		return
+	}
+	db.Advisories++
+	for i := range adv.Affected {
+		aff := &adv.Affected[i]
+		name, _, _ := strings.Cut(aff.Package.Ecosystem, ":")
+		key := name + "/" + aff.Package.Name
+		db.byPackage[key] = append(db.byPackage[key], entry{adv, aff})
+	}
+}
+
+// Finding is an installed package affected by an advisory
+type Finding struct {
+	AdvisoryID   string
+	Aliases      []string
+	Package      string
+	Version      string
+	FixedVersion string // empty when no fix is available
+	Severity     string // "critical", "high", "medium", "low" or "unknown"
+	Score        float64
+	Summary      string
+}
+
+// Match returns the findings for packages installed on a release. Packages
+// are looked up by binary and source name, since distribution advisories are
+// usually published per source package. A package installed for several
+// architectures yields one finding per advisory.
+func (db *Database) Match(eco Ecosystem, manager string, pkgs []packages.Package) []Finding {
+	var findings []Finding
+	seen := make(map[string]bool) // advisory/package
+	for _, p := range pkgs {
+		for _, name := range []string{p.Name, p.Source} {
+			if name == "" {
+				continue
+			}
+			for _, e := range db.byPackage[eco.Name+"/"+name] {
+				key := e.advisory.ID + "/" + p.Name
+				if seen[key] || !eco.matches(e.affected.Package.Ecosystem) {
+					continue
+				}
+				affected, fixed := e.affected.affects(manager, p.Version)
+				if !affected {
+					continue
+				}
+				seen[key] = true
+
+				severity, score := e.advisory.severity(e.affected)
+				findings = append(findings, Finding{
+					AdvisoryID:   e.advisory.ID,
+					Aliases:      e.advisory.Aliases,
+					Package:      p.Name,
+					Version:      p.Version,
+					FixedVersion: fixed,
+					Severity:     severity,
+					Score:        score,
+					Summary:      e.advisory.Summary,
+				})
+			}
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Package != findings[j].Package {
+			return findings[i].Package < findings[j].Package
+		}
+		return findings[i].AdvisoryID < findings[j].AdvisoryID
+	})
+	return findings
+}
+
+// affects reports whether version is affected, and the earliest fixed
+// version above it if one is published
+func (a *Affected) affects(manager, version string) (affected bool, fixed string) {
+	cmp := func(x, y string) int { return packages.CompareVersions(manager, x, y) }
+
+	for _, v := range a.Versions {
+		if v == version {
+			affected = true
+		}
+	}
+
+	for _, r := range a.Ranges {
+		if r.Type != "ECOSYSTEM" {
+			continue
+		}
+
+		// Walk the events in version order; "0" introduces from the start
+		events := append([]Event(nil), r.Events...)
+		at := func(e Event) string { return e.Introduced + e.Fixed + e.LastAffected }
+		sort.SliceStable(events, func(i, j int) bool {
+			if events[i].Introduced == "0" {
+				return events[j].Introduced != "0"
+			}
+			if events[j].Introduced == "0" {
+				return false
+			}
+			return cmp(at(events[i]), at(events[j])) < 0
+		})
+
+		inRange := false
+		for _, e := range events {
+			switch {
+			case e.Introduced != "":
+				if e.Introduced == "0" || cmp(version, e.Introduced) >= 0 {
+					inRange = true
+				}
+			case e.Fixed != "":
+				if cmp(version, e.Fixed) >= 0 {
+					inRange = false
+				} else if inRange && fixed == "" {
+					fixed = e.Fixed
+				}
+			case e.LastAffected != "":
+				if cmp(version, e.LastAffected) > 0 {
+					inRange = false
+				}
+			}
+		}
+		if inRange {
+			affected = true
+		} else if !affected {
+			fixed = ""
+		}
+	}
+	return affected, fixed
+}
+
+// severity rates an advisory for one package: the distribution's own rating
+// when published, otherwise the CVSS v3 base score
+func (adv *Advisory) severity(aff *Affected) (string, float64) {
+	var score float64
+	for _, list := range [][]Severity{aff.Severity, adv.Severity} {
+		for _, s := range list {
+			if strings.HasPrefix(s.Type, "CVSS_V3") {
+				if v, ok := CVSS3Score(s.Score); ok && v > score {
+					score = v
+				}
+			}
+		}
+	}
+
+	ratings := []string{aff.EcosystemSpecific.Severity, aff.EcosystemSpecific.Urgency,
+		aff.DatabaseSpecific.Severity, adv.DatabaseSpecific.Severity}
+	for _, list := range [][]Severity{aff.Severity, adv.Severity} {
+		for _, s := range list {
+			if !strings.HasPrefix(s.Type, "CVSS") {
+				ratings = append(ratings, s.Score)
+			}
+		}
+	}
+	for _, r := range ratings {
+		if level := normalizeSeverity(r); level != "" {
+			return level, score
+		}
+	}
+	return CVSS3Rating(score), score
+}
+
+// normalizeSeverity maps distribution ratings onto critical/high/medium/low
+func normalizeSeverity(rating string) string {
+	switch strings.ToLower(strings.TrimSpace(rating)) {
+	case "critical":
+		return "critical"
+	case "high", "important":
+		return "high"
+	case "medium", "moderate":
+		return "medium"
+	case "low", "negligible", "unimportant":
+		return "low"
+	}
+	return ""
+}
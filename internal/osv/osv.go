@@ -0,0 +1,128 @@
+// Package osv loads advisories in the OSV format (https://ossf.github.io/osv-schema/)
+// from a local mirror and matches installed distribution packages against
+// them. Mirrors are directories of advisory .json files or the per-ecosystem
+// all.zip dumps, so matching works fully offline.
+package osv
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Advisory is the subset of an OSV record used for matching
+type Advisory struct {
+	ID               string     `json:"id"`
+	Summary          string     `json:"summary"`
+	Aliases          []string   `json:"aliases"`
+	Modified         time.Time  `json:"modified"`
+	Withdrawn        *time.Time `json:"withdrawn"`
+	Severity         []Severity `json:"severity"`
+	Affected         []Affected `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Severity is a typed severity score, e.g. a CVSS_V3 vector or a distro
+// rating ("Ubuntu": "medium")
+type Severity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// Affected lists the affected versions of one package in one ecosystem
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"` // "Debian:12", "Ubuntu:22.04:LTS", ...
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges            []Range    `json:"ranges"`
+	Versions          []string   `json:"versions"`
+	Severity          []Severity `json:"severity"`
+	EcosystemSpecific struct {
+		Urgency  string `json:"urgency"`
+		Severity string `json:"severity"`
+	} `json:"ecosystem_specific"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Range is a sequence of introduced/fixed events over ordered versions
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event is one boundary of an affected range
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+// Load reads every advisory under dir: .json files and .zip archives of them
+func Load(dir string) (*Database, error) {
+	db := NewDatabase()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			db.addReader(f)
+		case ".zip":
+			return db.addZip(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// addZip loads the advisories of an OSV dump archive
+func (db *Database) addZip(path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		if !strings.HasSuffix(strings.ToLower(file.Name), ".json") {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("open %s in %s: %w", file.Name, path, err)
+		}
+		db.addReader(r)
+		r.Close()
+	}
+	return nil
+}
+
+// addReader decodes one advisory file; files that are not advisories are
+// counted and skipped rather than failing the whole import
+func (db *Database) addReader(r io.Reader) {
+	var adv Advisory
+	if err := json.NewDecoder(r).Decode(&adv); err != nil || adv.ID == "" {
+		db.Skipped++
+		return
+	}
+	db.Add(&adv)
+}
@@ -0,0 +1,101 @@
+// Package packages defines the installed-package inventory agents send on
+// the "packages" stream. Inventory events carry the JSON-encoded Inventory;
+// change events carry a readable message and describe the package in labels.
+package packages
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Stream is the event stream package events are sent on
+const Stream = "packages"
+
+// Event types of package events
+const (
+	EventInventory  = "package_inventory"
+	EventInstalled  = "package_installed"
+	EventRemoved    = "package_removed"
+	EventUpgraded   = "package_upgraded"
+	EventDowngraded = "package_downgraded"
+)
+
+// Package managers
+const (
+	ManagerDpkg = "dpkg"
+	ManagerRPM  = "rpm"
+)
+
+// Package is one installed package
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"` // [epoch:]version[-release]
+	Arch    string `json:"arch,omitempty"`
+	// Source is the source package (dpkg) or source RPM name, which is what
+	// distribution advisories are usually keyed by
+	Source      string    `json:"source,omitempty"`
+	InstalledAt time.Time `json:"installed_at,omitempty"`
+}
+
+// Key identifies a package across inventories; multiarch systems may have the
+// same name installed for several architectures
+func (p Package) Key() string {
+	return p.Name + ":" + p.Arch
+}
+
+// Inventory is the full list of installed packages of a host
+type Inventory struct {
+	CollectedAt time.Time `json:"collected_at"`
+	Manager     string    `json:"manager"`
+	Packages    []Package `json:"packages"`
+}
+
+// Change is a package installed, removed, upgraded or downgraded between two
+// inventories
+type Change struct {
+	Type     string   // one of the Event* change types
+	Package  Package  // the package now, or as it was when removed
+	Previous *Package // the replaced package for upgrades and downgrades
+}
+
+// Diff compares two package lists of the same manager
+func Diff(manager string, before, after []Package) []Change {
+	old := make(map[string]Package, len(before))
+	for _, p := range before {
+		old[p.Key()] = p
+	}
+
+	var changes []Change
+	for _, p := range after {
+		prev, ok := old[p.Key()]
+		delete(old, p.Key())
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: EventInstalled, Package: p})
+		case prev.Version != p.Version:
+			change := Change{Type: EventUpgraded, Package: p, Previous: &prev}
+			if CompareVersions(manager, p.Version, prev.Version) < 0 {
+				change.Type = EventDowngraded
+			}
+			changes = append(changes, change)
+		}
+	}
+	for _, p := range old {
+		changes = append(changes, Change{Type: EventRemoved, Package: p})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Package.Key() < changes[j].Package.Key()
+	})
+	return changes
+}
+
+// Decode parses a package inventory event message
+func Decode(message string) (*Inventory, error) {
+	var inv Inventory
+	if err := json.Unmarshal([]byte(message), &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
@@ -0,0 +1,208 @@
+package packages
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions orders two versions of a package manager, returning -1, 0
+// or 1. Versions are "[epoch:]version[-release]".
+func CompareVersions(manager, a, b string) int {
+	if a == b {
+		return 0
+	}
+	if manager == ManagerRPM {
+		return compareEVR(a, b, rpmvercmp)
+	}
+	return compareEVR(a, b, dpkgvercmp)
+}
+
+// compareEVR compares epoch, then version, then release with cmp
+func compareEVR(a, b string, cmp func(a, b string) int) int {
+	ea, va, ra := splitEVR(a)
+	eb, vb, rb := splitEVR(b)
+	if ea != eb {
+		if ea < eb {
+			return -1
+		}
+		return 1
+	}
+	if c := cmp(va, vb); c != 0 {
+		return c
+	}
+	return cmp(ra, rb)
+}
+
+// splitEVR splits "[epoch:]version[-release]"; the release is everything
+// after the last hyphen
+func splitEVR(s string) (epoch int, version, release string) {
+	if e, rest, ok := strings.Cut(s, ":"); ok {
+		epoch, _ = strconv.Atoi(e)
+		s = rest
+	}
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		return epoch, s[:i], s[i+1:]
+	}
+	return epoch, s, ""
+}
+
+// dpkgvercmp implements dpkg's version part comparison: alternating
+// non-digit runs (letters before other characters, '~' before everything,
+// even the end) and numeric runs
+func dpkgvercmp(a, b string) int {
+	order := func(s string, i int) int {
+		if i >= len(s) {
+			return 0
+		}
+		c := s[i]
+		switch {
+		case c == '~':
+			return -1
+		case isDigit(c):
+			return 0
+		case isAlpha(c):
+			return int(c)
+		default:
+			return int(c) + 256
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			oa, ob := order(a, i), order(b, j)
+			if oa != ob {
+				return sign(oa - ob)
+			}
+			i++
+			j++
+		}
+
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		first := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if first == 0 {
+				first = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if first != 0 {
+			return sign(first)
+		}
+	}
+	return 0
+}
+
+// rpmvercmp implements rpm's version comparison: alphanumeric segments
+// compared pairwise, numbers beating letters, '~' sorting before and '^'
+// after the end of a version
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	for len(a) > 0 || len(b) > 0 {
+		a = strings.TrimLeftFunc(a, isRPMSeparator)
+		b = strings.TrimLeftFunc(b, isRPMSeparator)
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			switch {
+			case a == "":
+				return -1
+			case b == "":
+				return 1
+			case a[0] != '^':
+				return 1
+			case b[0] != '^':
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := isDigit(a[0])
+		segment := func(s string) (string, string) {
+			n := 0
+			for n < len(s) && (numeric && isDigit(s[n]) || !numeric && isAlpha(s[n])) {
+				n++
+			}
+			return s[:n], s[n:]
+		}
+		var sa, sb string
+		sa, a = segment(a)
+		sb, b = segment(b)
+		if sb == "" {
+			// Different segment types: numbers are newer
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		if numeric {
+			sa = strings.TrimLeft(sa, "0")
+			sb = strings.TrimLeft(sb, "0")
+			if len(sa) != len(sb) {
+				return sign(len(sa) - len(sb))
+			}
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+
+	if a == "" && b == "" {
+		return 0
+	}
+	if a == "" {
+		return -1
+	}
+	return 1
+}
+
+// isRPMSeparator reports whether r separates rpm version segments
+func isRPMSeparator(r rune) bool {
+	if r >= 0x80 {
+		return true
+	}
+	return !isDigit(byte(r)) && !isAlpha(byte(r)) && r != '~' && r != '^'
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isAlpha(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
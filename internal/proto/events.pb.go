@@ -112,11 +112,13 @@ type AuthRequest struct {
 	Token        string                 `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"`
 	AgentVersion string                 `protobuf:"bytes,3,opt,name=agent_version,json=agentVersion,proto3" json:"agent_version,omitempty"`
 	// Auto-registration fields
-	Hostname      string   `protobuf:"bytes,4,opt,name=hostname,proto3" json:"hostname,omitempty"`
-	IpAddress     string   `protobuf:"bytes,5,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
-	OsType        string   `protobuf:"bytes,6,opt,name=os_type,json=osType,proto3" json:"os_type,omitempty"`
-	OsVersion     string   `protobuf:"bytes,7,opt,name=os_version,json=osVersion,proto3" json:"os_version,omitempty"`
-	Capabilities  []string `protobuf:"bytes,8,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	Hostname     string   `protobuf:"bytes,4,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	IpAddress    string   `protobuf:"bytes,5,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
+	OsType       string   `protobuf:"bytes,6,opt,name=os_type,json=osType,proto3" json:"os_type,omitempty"`
+	OsVersion    string   `protobuf:"bytes,7,opt,name=os_version,json=osVersion,proto3" json:"os_version,omitempty"`
+	Capabilities []string `protobuf:"bytes,8,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	// Persistent agent ID; the hostname is used when empty
+	AgentId       string `protobuf:"bytes,9,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -207,6 +209,13 @@ func (x *AuthRequest) GetCapabilities() []string {
 	return nil
 }
 
+func (x *AuthRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
 type AuthResponse struct {
 	state                    protoimpl.MessageState `protogen:"open.v1"`
 	Authenticated            bool                   `protobuf:"varint,1,opt,name=authenticated,proto3" json:"authenticated,omitempty"`
@@ -606,7 +615,7 @@ const file_internal_proto_events_proto_rawDesc = "" +
 	"\x06labels\x18\x06 \x03(\v2\x1b.proto.LogEvent.LabelsEntryR\x06labels\x1a9\n" +
 	"\vLabelsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xf6\x01\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x91\x02\n" +
 	"\vAuthRequest\x12\x15\n" +
 	"\x06org_id\x18\x01 \x01(\tR\x05orgId\x12\x14\n" +
 	"\x05token\x18\x02 \x01(\tR\x05token\x12#\n" +
@@ -617,7 +626,8 @@ const file_internal_proto_events_proto_rawDesc = "" +
 	"\aos_type\x18\x06 \x01(\tR\x06osType\x12\x1d\n" +
 	"\n" +
 	"os_version\x18\a \x01(\tR\tosVersion\x12\"\n" +
-	"\fcapabilities\x18\b \x03(\tR\fcapabilities\"\xd2\x01\n" +
+	"\fcapabilities\x18\b \x03(\tR\fcapabilities\x12\x19\n" +
+	"\bagent_id\x18\t \x01(\tR\aagentId\"\xd2\x01\n" +
 	"\fAuthResponse\x12$\n" +
 	"\rauthenticated\x18\x01 \x01(\bR\rauthenticated\x12#\n" +
 	"\rerror_message\x18\x02 \x01(\tR\ferrorMessage\x12<\n" +
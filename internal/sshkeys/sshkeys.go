@@ -0,0 +1,220 @@
+// Package sshkeys parses OpenSSH authorized_keys files and the
+// AuthorizedKeysFile setting of sshd_config, and fingerprints keys the way
+// ssh-keygen -l does (SHA256:<unpadded base64>).
+package sshkeys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Stream is the event stream authorized key events are sent on
+const Stream = "ssh_keys"
+
+// Event types of authorized key events
+const (
+	EventInventory = "ssh_key_inventory"
+	EventAdded     = "ssh_key_added"
+	EventRemoved   = "ssh_key_removed"
+	EventModified  = "ssh_key_modified" // same key, different options
+)
+
+// DefaultAuthorizedKeysFiles is sshd's default AuthorizedKeysFile
+var DefaultAuthorizedKeysFiles = []string{".ssh/authorized_keys", ".ssh/authorized_keys2"}
+
+// Key is one key trusted by an authorized_keys file
+type Key struct {
+	User        string `json:"user"`
+	File        string `json:"file"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	Comment     string `json:"comment,omitempty"`
+	Options     string `json:"options,omitempty"` // e.g. command="...",no-pty
+}
+
+// Inventory is the full set of authorized keys of a host
+type Inventory struct {
+	Keys []Key `json:"keys"`
+}
+
+// ID identifies a key entry across snapshots. Options are not part of it, so
+// a restriction added or lifted shows up as a modified key.
+func (k Key) ID() string {
+	return k.User + "\x00" + k.File + "\x00" + k.Fingerprint
+}
+
+// Parse reads the keys of an authorized_keys file; invalid lines are skipped
+func Parse(data []byte) []Key {
+	var keys []Key
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if key, ok := ParseLine(scanner.Text()); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ParseLine parses "[options] type base64 [comment]"
+func ParseLine(line string) (Key, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Key{}, false
+	}
+
+	var options string
+	if fields := strings.Fields(line); !isKeyType(fields[0]) {
+		// Options run until the first whitespace outside quotes
+		quoted := false
+		end := len(line)
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if c == '\\' && quoted && i+1 < len(line) {
+				i++
+				continue
+			}
+			if c == '"' {
+				quoted = !quoted
+			}
+			if !quoted && (c == ' ' || c == '\t') {
+				end = i
+				break
+			}
+		}
+		options, line = line[:end], strings.TrimSpace(line[end:])
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !isKeyType(fields[0]) {
+		return Key{}, false
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || embeddedType(blob) != fields[0] {
+		return Key{}, false
+	}
+
+	return Key{
+		Type:        fields[0],
+		Fingerprint: Fingerprint(blob),
+		Comment:     strings.Join(fields[2:], " "),
+		Options:     options,
+	}, true
+}
+
+// Fingerprint returns the SHA256 fingerprint of a public key blob
+func Fingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// isKeyType reports whether s names an OpenSSH public key or certificate type
+func isKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-sha2-") ||
+		strings.HasPrefix(s, "sk-ssh-") || strings.HasPrefix(s, "sk-ecdsa-")
+}
+
+// embeddedType returns the key type stored at the start of a key blob
+func embeddedType(blob []byte) string {
+	if len(blob) < 4 {
+		return ""
+	}
+	n := binary.BigEndian.Uint32(blob)
+	if uint64(n) > uint64(len(blob)-4) {
+		return ""
+	}
+	return string(blob[4 : 4+n])
+}
+
+// AuthorizedKeysFiles returns the AuthorizedKeysFile patterns configured in
+// sshd_config, following Include. As in sshd the first value wins; settings
+// inside Match blocks apply conditionally and are ignored.
+func AuthorizedKeysFiles(configPath string) []string {
+	if files, ok := authorizedKeysSetting(configPath, filepath.Dir(configPath), 0); ok {
+		return files
+	}
+	return DefaultAuthorizedKeysFiles
+}
+
+// authorizedKeysSetting scans one config file for AuthorizedKeysFile
+func authorizedKeysSetting(path, baseDir string, depth int) ([]string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil || depth > 8 {
+		return nil, false
+	}
+
+	inMatch := false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// "Keyword=value" is also accepted
+		if k, v, ok := strings.Cut(fields[0], "="); ok {
+			fields = append([]string{k}, append(strings.Fields(v), fields[1:]...)...)
+		}
+		keyword := strings.ToLower(fields[0])
+
+		switch {
+		case keyword == "match":
+			inMatch = !(len(fields) == 2 && strings.EqualFold(fields[1], "all"))
+		case inMatch:
+		case keyword == "include":
+			for _, pattern := range fields[1:] {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(baseDir, pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, inc := range matches {
+					if files, ok := authorizedKeysSetting(inc, baseDir, depth+1); ok {
+						return files, true
+					}
+				}
+			}
+		case keyword == "authorizedkeysfile" && len(fields) > 1:
+			if strings.EqualFold(fields[1], "none") {
+				return nil, true
+			}
+			return fields[1:], true
+		}
+	}
+	return nil, false
+}
+
+// ExpandPath resolves an AuthorizedKeysFile pattern for a user: %h, %u, %U
+// and %% are substituted and relative paths are taken from the home directory
+func ExpandPath(pattern, user, home string, uid int) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'h':
+			b.WriteString(home)
+		case 'u':
+			b.WriteString(user)
+		case 'U':
+			b.WriteString(strconv.Itoa(uid))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	path := b.String()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(home, path)
+	}
+	return filepath.Clean(path)
+}
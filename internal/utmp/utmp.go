@@ -0,0 +1,133 @@
+// Package utmp parses the binary login records of glibc Linux systems: utmp
+// (current sessions), wtmp (login history), btmp (failed logins) and
+// lastlog (each user's most recent login).
+package utmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// Record types (ut_type)
+const (
+	Empty        = 0
+	RunLevel     = 1
+	BootTime     = 2
+	NewTime      = 3
+	OldTime      = 4
+	InitProcess  = 5
+	LoginProcess = 6
+	UserProcess  = 7
+	DeadProcess  = 8
+	Accounting   = 9
+)
+
+// RecordSize is sizeof(struct utmp) on 64-bit Linux, where the time
+// fields are 32-bit for compatibility with 32-bit programs
+const RecordSize = 384
+
+// LastlogSize is sizeof(struct lastlog)
+const LastlogSize = 292
+
+// Record is one utmp, wtmp or btmp entry
+type Record struct {
+	Type    int16     `json:"type"`
+	PID     int32     `json:"pid"`
+	Line    string    `json:"line"` // tty without /dev/, e.g. pts/0
+	ID      string    `json:"id,omitempty"`
+	User    string    `json:"user"`
+	Host    string    `json:"host,omitempty"`
+	Session int32     `json:"session,omitempty"`
+	Time    time.Time `json:"time"`
+	Addr    net.IP    `json:"addr,omitempty"`
+}
+
+// IsZero reports whether the record has been wiped: every byte zero, as
+// left by log cleaners that blank entries instead of removing them
+func IsZero(raw []byte) bool {
+	for _, b := range raw {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse decodes consecutive records; a trailing partial record is ignored
+func Parse(data []byte) []Record {
+	records := make([]Record, 0, len(data)/RecordSize)
+	for off := 0; off+RecordSize <= len(data); off += RecordSize {
+		records = append(records, ParseRecord(data[off:off+RecordSize]))
+	}
+	return records
+}
+
+// ParseRecord decodes one record of RecordSize bytes
+func ParseRecord(raw []byte) Record {
+	le := binary.LittleEndian
+	r := Record{
+		Type:    int16(le.Uint16(raw[0:2])),
+		PID:     int32(le.Uint32(raw[4:8])),
+		Line:    cString(raw[8:40]),
+		ID:      cString(raw[40:44]),
+		User:    cString(raw[44:76]),
+		Host:    cString(raw[76:332]),
+		Session: int32(le.Uint32(raw[336:340])),
+	}
+	sec := int64(int32(le.Uint32(raw[340:344])))
+	usec := int64(int32(le.Uint32(raw[344:348])))
+	r.Time = time.Unix(sec, usec*1000).UTC()
+
+	// ut_addr_v6 holds an IPv4 address in its first word, or a full IPv6 address
+	addr := raw[348:364]
+	switch {
+	case IsZero(addr):
+	case IsZero(addr[4:]):
+		r.Addr = net.IPv4(addr[0], addr[1], addr[2], addr[3])
+	default:
+		r.Addr = net.IP(bytes.Clone(addr))
+	}
+	return r
+}
+
+// Lastlog is one user's most recent login
+type Lastlog struct {
+	UID  int       `json:"uid"`
+	Time time.Time `json:"time"`
+	Line string    `json:"line,omitempty"`
+	Host string    `json:"host,omitempty"`
+}
+
+// LastlogOffset is where uid's entry starts; the file is indexed by UID and
+// sparse, so users who never logged in have a zero entry or none at all
+func LastlogOffset(uid int) int64 {
+	return int64(uid) * LastlogSize
+}
+
+// ParseLastlog decodes one lastlog entry of LastlogSize bytes, reporting
+// false for an empty entry
+func ParseLastlog(raw []byte, uid int) (Lastlog, bool) {
+	if len(raw) < LastlogSize {
+		return Lastlog{}, false
+	}
+	sec := int64(int32(binary.LittleEndian.Uint32(raw[0:4])))
+	if sec == 0 {
+		return Lastlog{}, false
+	}
+	return Lastlog{
+		UID:  uid,
+		Time: time.Unix(sec, 0).UTC(),
+		Line: cString(raw[4:36]),
+		Host: cString(raw[36:292]),
+	}, true
+}
+
+// cString returns a NUL-padded field as a string
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/mulutu/security-manager/internal/database"
+)
+
+// Re-keys or merges agent records, e.g. to fold a duplicate created by a
+// hostname change into the agent's persistent ID. Uses DATABASE_URL.
+//
+//	go run ./tools/agent_rekey -org ORG -from web-01 -to 5f0c…
+//	go run ./tools/agent_rekey -org ORG -from web-01 -to 5f0c… -merge
+
+func main() {
+	var (
+		orgID = flag.String("org", "", "organization ID (required)")
+		from  = flag.String("from", "", "host ID to re-key or merge away (required)")
+		to    = flag.String("to", "", "new host ID, or the agent to merge into (required)")
+		merge = flag.Bool("merge", false, "merge into an existing agent instead of renaming")
+	)
+	flag.Parse()
+
+	if *orgID == "" || *from == "" || *to == "" {
+		flag.Usage()
+		log.Fatalln("-org, -from and -to are required")
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	defer db.Close()
+
+	if *merge {
+		err = db.MergeAgents(*orgID, *from, *to)
+	} else {
+		err = db.RekeyAgent(*orgID, *from, *to)
+	}
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
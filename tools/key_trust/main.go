@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mulutu/security-manager/internal/database"
+)
+
+// Lists every host and user that trusts an SSH key, by the fingerprint
+// printed by ssh-keygen -l. Uses DATABASE_URL.
+//
+//	go run ./tools/key_trust -org ORG -fingerprint SHA256:XJDh…
+
+func main() {
+	var (
+		orgID       = flag.String("org", "", "organization ID (required)")
+		fingerprint = flag.String("fingerprint", "", "key fingerprint, e.g. SHA256:... (required)")
+	)
+	flag.Parse()
+
+	if *orgID == "" || *fingerprint == "" {
+		flag.Usage()
+		log.Fatalln("-org and -fingerprint are required")
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	defer db.Close()
+
+	keys, err := db.HostsTrustingKey(*orgID, *fingerprint)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if len(keys) == 0 {
+		fmt.Printf("No host trusts %s\n", *fingerprint)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tUSER\tFILE\tCOMMENT\tOPTIONS\tFIRST SEEN")
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", k.HostID, k.User, k.File, k.Comment, k.Options, k.FirstSeen.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+}
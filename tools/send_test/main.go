@@ -6,6 +6,7 @@ import (
 
 	pb "github.com/mulutu/security-manager/internal/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -16,7 +17,8 @@ func main() {
 	}
 	defer conn.Close()
 
-	stream, _ := pb.NewAgentIngestClient(conn).StreamEvents(context.Background())
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "sm-token", "sm_tok_demo123", "sm-agent-id", "vm1")
+	stream, _ := pb.NewAgentIngestClient(conn).StreamEvents(ctx)
 
 	_ = stream.Send(&pb.LogEvent{
 		OrgId:    "demo",
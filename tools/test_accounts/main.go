@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mulutu/security-manager/internal/accounts"
+)
+
+// Golden-file check for account change detection: every case directory under
+// -dir holds a before/ and an after/ root with etc/passwd, shadow, group and
+// sudoers files. Both are read as snapshots, diffed, and the changes are
+// compared with <case>.golden (one JSON change per line). Run with -update
+// after an intentional change.
+
+var (
+	dir    = flag.String("dir", "internal/accounts/testdata", "directory with <case>/before, <case>/after and <case>.golden")
+	update = flag.Bool("update", false, "rewrite golden files instead of comparing")
+)
+
+// goldenChange is one account change as stored in a golden file
+type goldenChange struct {
+	Type     string            `json:"type"`
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Labels   map[string]string `json:"labels"`
+}
+
+func main() {
+	flag.Parse()
+
+	befores, err := filepath.Glob(filepath.Join(*dir, "*", "before"))
+	if err != nil || len(befores) == 0 {
+		log.Fatalf("no cases found in %s", *dir)
+	}
+
+	failed := 0
+	for _, before := range befores {
+		sample := filepath.Dir(before)
+		got, err := render(sample)
+		if err != nil {
+			log.Fatalf("%s: %v", sample, err)
+		}
+
+		golden := sample + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				log.Fatalf("write %s: %v", golden, err)
+			}
+			log.Printf("📝 Updated %s", golden)
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			log.Printf("❌ %s: %v", golden, err)
+			failed++
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			log.Printf("❌ %s does not match %s", sample, golden)
+			reportMismatch(got, want)
+			failed++
+			continue
+		}
+		log.Printf("✅ %s", sample)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d cases failed", failed, len(befores))
+	}
+}
+
+// render diffs a case's before and after snapshots
+func render(sample string) ([]byte, error) {
+	old, err := accounts.Read(filepath.Join(sample, "before"))
+	if err != nil {
+		return nil, err
+	}
+	cur, err := accounts.Read(filepath.Join(sample, "after"))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	for _, c := range accounts.Diff(old, cur) {
+		data, err := json.Marshal(goldenChange{Type: c.Type, Severity: c.Severity, Message: c.Message, Labels: c.Labels})
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// reportMismatch prints the first differing golden line
+func reportMismatch(got, want []byte) {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			log.Printf("   golden line %d\n   want: %s\n   got:  %s", i+1, w, g)
+			return
+		}
+	}
+}
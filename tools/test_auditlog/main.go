@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/auditlog"
+)
+
+// Golden-file check for the audit log parser: every *.log sample under -dir
+// is parsed record by record and assembled into events, which are compared
+// with the matching *.golden file (one JSON event per line, in the order the
+// assembler completes them). Events still pending at the end of a sample
+// are flushed last. Run with -update after an intentional parser change.
+
+var (
+	dir    = flag.String("dir", "internal/auditlog/testdata", "directory with *.log samples and *.golden files")
+	update = flag.Bool("update", false, "rewrite golden files instead of comparing")
+)
+
+// goldenRecord is one record of an event with its decoded fields
+type goldenRecord struct {
+	Type   string            `json:"type"`
+	Fields map[string]string `json:"fields"`
+}
+
+// goldenEvent is an assembled event with its derived fields
+type goldenEvent struct {
+	Serial    uint64                `json:"serial"`
+	Time      string                `json:"time"`
+	Type      string                `json:"type"`
+	Exec      bool                  `json:"exec,omitempty"`
+	Syscall   string                `json:"syscall,omitempty"`
+	Success   string                `json:"success,omitempty"`
+	Exit      string                `json:"exit,omitempty"`
+	PID       int                   `json:"pid,omitempty"`
+	PPID      int                   `json:"ppid,omitempty"`
+	UID       string                `json:"uid,omitempty"`
+	AUID      string                `json:"auid,omitempty"`
+	Session   string                `json:"session,omitempty"`
+	TTY       string                `json:"tty,omitempty"`
+	Comm      string                `json:"comm,omitempty"`
+	Exe       string                `json:"exe,omitempty"`
+	Key       string                `json:"key,omitempty"`
+	Argv      []string              `json:"argv,omitempty"`
+	Cwd       string                `json:"cwd,omitempty"`
+	Paths     []auditlog.PathRecord `json:"paths,omitempty"`
+	Proctitle string                `json:"proctitle,omitempty"`
+	Records   []goldenRecord        `json:"records"`
+}
+
+func main() {
+	flag.Parse()
+
+	samples, err := filepath.Glob(filepath.Join(*dir, "*.log"))
+	if err != nil || len(samples) == 0 {
+		log.Fatalf("no samples found in %s", *dir)
+	}
+
+	failed := 0
+	for _, sample := range samples {
+		got, err := render(sample)
+		if err != nil {
+			log.Fatalf("%s: %v", sample, err)
+		}
+
+		golden := strings.TrimSuffix(sample, ".log") + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				log.Fatalf("write %s: %v", golden, err)
+			}
+			log.Printf("📝 Updated %s", golden)
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			log.Printf("❌ %s: %v", golden, err)
+			failed++
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			log.Printf("❌ %s does not match %s", sample, golden)
+			reportMismatch(got, want)
+			failed++
+			continue
+		}
+		log.Printf("✅ %s", sample)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d samples failed", failed, len(samples))
+	}
+}
+
+// render assembles a sample's records and returns its golden representation
+func render(sample string) ([]byte, error) {
+	f, err := os.Open(sample)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	asm := auditlog.NewAssembler(time.Hour)
+	var events []*auditlog.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r, ok := auditlog.ParseRecord(scanner.Text()); ok {
+			events = append(events, asm.Add(r)...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	events = append(events, asm.Flush(true)...)
+
+	var out bytes.Buffer
+	for _, ev := range events {
+		data, err := json.Marshal(goldenFor(ev))
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// goldenFor flattens an event, rendering its time in UTC
+func goldenFor(ev *auditlog.Event) goldenEvent {
+	g := goldenEvent{
+		Serial:    ev.Serial,
+		Time:      ev.Time.UTC().Format(time.RFC3339Nano),
+		Type:      ev.Type,
+		Exec:      ev.IsExec(),
+		Syscall:   ev.Syscall,
+		Success:   ev.Success,
+		Exit:      ev.Exit,
+		PID:       ev.PID,
+		PPID:      ev.PPID,
+		UID:       ev.UID,
+		AUID:      ev.AUID,
+		Session:   ev.Session,
+		TTY:       ev.TTY,
+		Comm:      ev.Comm,
+		Exe:       ev.Exe,
+		Key:       ev.Key,
+		Argv:      ev.Argv,
+		Cwd:       ev.Cwd,
+		Paths:     ev.Paths,
+		Proctitle: ev.Proctitle,
+	}
+	for _, r := range ev.Records {
+		g.Records = append(g.Records, goldenRecord{Type: r.Type, Fields: r.Fields})
+	}
+	return g
+}
+
+// reportMismatch prints the first differing golden line
+func reportMismatch(got, want []byte) {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			log.Printf("   golden line %d\n   want: %s\n   got:  %s", i+1, w, g)
+			return
+		}
+	}
+}
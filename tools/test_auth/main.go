@@ -8,6 +8,7 @@ import (
 	pb "github.com/mulutu/security-manager/internal/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -57,7 +58,8 @@ func main() {
 	// Test 3: Send a test event (if authenticated)
 	if authResp.Authenticated {
 		log.Println("\n📤 Testing event streaming...")
-		stream, err := client.StreamEvents(context.Background())
+		streamCtx := metadata.AppendToOutgoingContext(context.Background(), "sm-token", "sm_tok_demo123", "sm-agent-id", "test-host")
+		stream, err := client.StreamEvents(streamCtx)
 		if err != nil {
 			log.Fatalf("stream failed: %v", err)
 		}
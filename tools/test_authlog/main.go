@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mulutu/security-manager/internal/authlog"
+)
+
+// Golden-file check for the auth log parsers: every <service>-*.log sample
+// under -dir is parsed with the registered parser for <service> and compared
+// with the matching *.golden file (one JSON event per parsed line). Run with
+// -update after an intentional parser change.
+
+var (
+	dir    = flag.String("dir", "internal/authlog/testdata", "directory with *.log samples and *.golden files")
+	update = flag.Bool("update", false, "rewrite golden files instead of comparing")
+)
+
+// reference resolves yearless syslog timestamps deterministically
+var reference = time.Date(2024, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+type goldenEntry struct {
+	Line  int                `json:"line"`
+	Event *authlog.AuthEvent `json:"event"`
+}
+
+func main() {
+	flag.Parse()
+
+	samples, err := filepath.Glob(filepath.Join(*dir, "*.log"))
+	if err != nil || len(samples) == 0 {
+		log.Fatalf("no samples found in %s", *dir)
+	}
+
+	failed := 0
+	for _, sample := range samples {
+		got, err := render(sample)
+		if err != nil {
+			log.Fatalf("%s: %v", sample, err)
+		}
+
+		golden := strings.TrimSuffix(sample, ".log") + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				log.Fatalf("write %s: %v", golden, err)
+			}
+			log.Printf("📝 Updated %s", golden)
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			log.Printf("❌ %s: %v", golden, err)
+			failed++
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			log.Printf("❌ %s does not match %s", sample, golden)
+			reportMismatch(got, want)
+			failed++
+			continue
+		}
+		log.Printf("✅ %s", sample)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d samples failed", failed, len(samples))
+	}
+}
+
+// render parses a sample and returns its golden representation
+func render(sample string) ([]byte, error) {
+	f, err := os.Open(sample)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	name, _, _ := strings.Cut(filepath.Base(sample), "-")
+	parser, err := parserFor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		ev, ok := parser.Parse(scanner.Text(), reference)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(goldenEntry{Line: n, Event: ev})
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), scanner.Err()
+}
+
+// parserFor returns a fresh parser for a registered service
+func parserFor(name string) (authlog.Parser, error) {
+	for _, svc := range authlog.Services() {
+		if svc.Name == name {
+			return svc.New(), nil
+		}
+	}
+	return nil, fmt.Errorf("no parser registered for service %q", name)
+}
+
+// reportMismatch prints the first differing golden line
+func reportMismatch(got, want []byte) {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			log.Printf("   golden line %d\n   want: %s\n   got:  %s", i+1, w, g)
+			return
+		}
+	}
+}
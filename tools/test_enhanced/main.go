@@ -10,6 +10,7 @@ import (
 	pb "github.com/mulutu/security-manager/internal/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -53,7 +54,8 @@ func main() {
 
 	// Test 2: Event Streaming
 	fmt.Printf("📡 Testing event streaming...\n")
-	stream, err := client.StreamEvents(ctx)
+	streamCtx := metadata.AppendToOutgoingContext(ctx, "sm-token", *token, "sm-agent-id", *hostID)
+	stream, err := client.StreamEvents(streamCtx)
 	if err != nil {
 		log.Fatalf("❌ Stream creation failed: %v", err)
 	}
@@ -73,14 +75,14 @@ func main() {
 		},
 		{
 			stream:   "system",
-			message:  "High CPU usage: 95.2%",
-			labels:   map[string]string{"severity": "warning", "cpu_usage": "95.2"},
+			message:  "High CPU usage: 95.2% (warning ≥ 90%)",
+			labels:   map[string]string{"severity": "warning", "event_type": "metric_threshold", "metric": "cpu", "level": "warning", "value": "95.20"},
 			expected: "Should trigger high CPU alert",
 		},
 		{
 			stream:   "system",
-			message:  "High disk usage: 92.1%",
-			labels:   map[string]string{"severity": "critical", "disk_usage": "92.1"},
+			message:  "High disk usage on /: 96.1% (critical ≥ 95%)",
+			labels:   map[string]string{"severity": "critical", "event_type": "metric_threshold", "metric": "disk", "level": "critical", "target": "/", "value": "96.10"},
 			expected: "Should trigger disk full alert",
 		},
 		{
@@ -206,7 +208,7 @@ func main() {
 
 	// Test 4: System Metrics
 	fmt.Printf("📊 Testing system metrics...\n")
-	metricsStream, err := client.StreamEvents(ctx)
+	metricsStream, err := client.StreamEvents(streamCtx)
 	if err != nil {
 		log.Printf("❌ Metrics stream creation failed: %v", err)
 	} else {
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mulutu/security-manager/internal/heuristics"
+)
+
+// Golden-file check for the process heuristics: every *.json sample under
+// -dir is a list of processes with their ancestors, each evaluated and
+// compared with the matching *.golden file (one JSON line of findings per
+// process). Run with -update after an intentional heuristics change.
+
+var (
+	dir    = flag.String("dir", "internal/heuristics/testdata", "directory with *.json samples and *.golden files")
+	update = flag.Bool("update", false, "rewrite golden files instead of comparing")
+)
+
+// sampleCase is one process of a sample file
+type sampleCase struct {
+	Name      string               `json:"name"`
+	Process   heuristics.Process   `json:"process"`
+	Ancestors []heuristics.Process `json:"ancestors"`
+}
+
+// goldenFinding is one finding as stored in a golden file
+type goldenFinding struct {
+	Heuristic string `json:"heuristic"`
+	Severity  string `json:"severity"`
+	Reason    string `json:"reason"`
+}
+
+// goldenResult is the findings for one process
+type goldenResult struct {
+	Name     string          `json:"name"`
+	Findings []goldenFinding `json:"findings"`
+}
+
+func main() {
+	flag.Parse()
+
+	samples, err := filepath.Glob(filepath.Join(*dir, "*.json"))
+	if err != nil || len(samples) == 0 {
+		log.Fatalf("no samples found in %s", *dir)
+	}
+
+	failed := 0
+	for _, sample := range samples {
+		got, err := render(sample)
+		if err != nil {
+			log.Fatalf("%s: %v", sample, err)
+		}
+
+		golden := strings.TrimSuffix(sample, ".json") + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				log.Fatalf("write %s: %v", golden, err)
+			}
+			log.Printf("📝 Updated %s", golden)
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			log.Printf("❌ %s: %v", golden, err)
+			failed++
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			log.Printf("❌ %s does not match %s", sample, golden)
+			reportMismatch(got, want)
+			failed++
+			continue
+		}
+		log.Printf("✅ %s", sample)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d samples failed", failed, len(samples))
+	}
+}
+
+// render evaluates every process of a sample
+func render(sample string) ([]byte, error) {
+	data, err := os.ReadFile(sample)
+	if err != nil {
+		return nil, err
+	}
+	var cases []sampleCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	for _, c := range cases {
+		result := goldenResult{Name: c.Name, Findings: []goldenFinding{}}
+		for _, f := range heuristics.Evaluate(c.Process, c.Ancestors) {
+			result.Findings = append(result.Findings, goldenFinding{Heuristic: f.Heuristic, Severity: f.Severity, Reason: f.Reason})
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// reportMismatch prints the first differing golden line
+func reportMismatch(got, want []byte) {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			log.Printf("   golden line %d\n   want: %s\n   got:  %s", i+1, w, g)
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mulutu/security-manager/internal/kmod"
+)
+
+// Golden-file check for the loaded module parser: every *.modules sample
+// under -dir is a captured /proc/modules, parsed and compared with the
+// matching *.golden file (one JSON module per line). Run with -update after
+// an intentional parser change.
+
+var (
+	dir    = flag.String("dir", "internal/kmod/testdata", "directory with *.modules samples and *.golden files")
+	update = flag.Bool("update", false, "rewrite golden files instead of comparing")
+)
+
+func main() {
+	flag.Parse()
+
+	samples, err := filepath.Glob(filepath.Join(*dir, "*.modules"))
+	if err != nil || len(samples) == 0 {
+		log.Fatalf("no samples found in %s", *dir)
+	}
+
+	failed := 0
+	for _, sample := range samples {
+		got, err := render(sample)
+		if err != nil {
+			log.Fatalf("%s: %v", sample, err)
+		}
+
+		golden := strings.TrimSuffix(sample, ".modules") + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				log.Fatalf("write %s: %v", golden, err)
+			}
+			log.Printf("📝 Updated %s", golden)
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			log.Printf("❌ %s: %v", golden, err)
+			failed++
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			log.Printf("❌ %s does not match %s", sample, golden)
+			reportMismatch(got, want)
+			failed++
+			continue
+		}
+		log.Printf("✅ %s", sample)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d samples failed", failed, len(samples))
+	}
+}
+
+// render parses a sample and returns its golden representation
+func render(sample string) ([]byte, error) {
+	f, err := os.Open(sample)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	modules, err := kmod.ParseModules(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	for _, m := range modules {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// reportMismatch prints the first differing golden line
+func reportMismatch(got, want []byte) {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			log.Printf("   golden line %d\n   want: %s\n   got:  %s", i+1, w, g)
+			return
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	pb "github.com/mulutu/security-manager/internal/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -58,7 +59,8 @@ func main() {
 
 	// Test streaming connection
 	fmt.Printf("🔄 Testing streaming connection...\n")
-	stream, err := client.StreamEvents(ctx)
+	streamCtx := metadata.AppendToOutgoingContext(ctx, "sm-token", *token, "sm-agent-id", "test-host")
+	stream, err := client.StreamEvents(streamCtx)
 	if err != nil {
 		log.Fatalf("❌ Stream creation failed: %v", err)
 	}
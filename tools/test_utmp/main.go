@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mulutu/security-manager/internal/utmp"
+)
+
+// Golden-file check for the login record parsers: every *.wtmp and *.btmp
+// sample under -dir is a run of utmp records and every *.lastlog sample a
+// lastlog file, parsed and compared with <sample>.golden (one JSON record
+// per line). Run with -update after an intentional parser change.
+
+var (
+	dir    = flag.String("dir", "internal/utmp/testdata", "directory with *.wtmp, *.btmp and *.lastlog samples and *.golden files")
+	update = flag.Bool("update", false, "rewrite golden files instead of comparing")
+)
+
+// goldenRecord is one utmp record as stored in a golden file
+type goldenRecord struct {
+	utmp.Record
+	Wiped bool `json:"wiped,omitempty"`
+}
+
+func main() {
+	flag.Parse()
+
+	var samples []string
+	for _, pattern := range []string{"*.wtmp", "*.btmp", "*.lastlog"} {
+		matches, _ := filepath.Glob(filepath.Join(*dir, pattern))
+		samples = append(samples, matches...)
+	}
+	if len(samples) == 0 {
+		log.Fatalf("no samples found in %s", *dir)
+	}
+
+	failed := 0
+	for _, sample := range samples {
+		got, err := render(sample)
+		if err != nil {
+			log.Fatalf("%s: %v", sample, err)
+		}
+
+		golden := sample + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				log.Fatalf("write %s: %v", golden, err)
+			}
+			log.Printf("📝 Updated %s", golden)
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			log.Printf("❌ %s: %v", golden, err)
+			failed++
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			log.Printf("❌ %s does not match %s", sample, golden)
+			reportMismatch(got, want)
+			failed++
+			continue
+		}
+		log.Printf("✅ %s", sample)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d samples failed", failed, len(samples))
+	}
+}
+
+// render parses a sample and returns its golden representation
+func render(sample string) ([]byte, error) {
+	data, err := os.ReadFile(sample)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []interface{}
+	if strings.HasSuffix(sample, ".lastlog") {
+		// Entries are found by UID, the way the agent reads them
+		for uid := 0; utmp.LastlogOffset(uid)+utmp.LastlogSize <= int64(len(data)); uid++ {
+			off := utmp.LastlogOffset(uid)
+			if l, ok := utmp.ParseLastlog(data[off:off+utmp.LastlogSize], uid); ok {
+				lines = append(lines, l)
+			}
+		}
+	} else {
+		for i, r := range utmp.Parse(data) {
+			raw := data[i*utmp.RecordSize : (i+1)*utmp.RecordSize]
+			lines = append(lines, goldenRecord{Record: r, Wiped: utmp.IsZero(raw)})
+		}
+	}
+
+	var out bytes.Buffer
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// reportMismatch prints the first differing golden line
+func reportMismatch(got, want []byte) {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			log.Printf("   golden line %d\n   want: %s\n   got:  %s", i+1, w, g)
+			return
+		}
+	}
+}
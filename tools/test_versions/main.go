@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mulutu/security-manager/internal/osv"
+	"github.com/mulutu/security-manager/internal/packages"
+)
+
+// Golden-file check for package version ordering and advisory matching.
+// Every <manager>-*.txt sample under -dir holds pairs of versions, one pair
+// per line, which are compared with that manager's rules and checked against
+// the matching *.golden file ("a < b", "a = b" or "a > b"). Every *.json
+// sample under -osv-dir holds advisories and installed packages of one
+// release; the golden file lists the resulting findings. Run with -update
+// after an intentional change.
+
+var (
+	dir    = flag.String("dir", "internal/packages/testdata", "directory with *.txt samples and *.golden files")
+	osvDir = flag.String("osv-dir", "internal/osv/testdata", "directory with *.json advisory samples and *.golden files")
+	update = flag.Bool("update", false, "rewrite golden files instead of comparing")
+)
+
+// matchSample is one advisory matching scenario
+type matchSample struct {
+	Ecosystem  osv.Ecosystem      `json:"ecosystem"`
+	Manager    string             `json:"manager"`
+	Packages   []packages.Package `json:"packages"`
+	Advisories []osv.Advisory     `json:"advisories"`
+}
+
+func main() {
+	flag.Parse()
+
+	orderings, err := filepath.Glob(filepath.Join(*dir, "*.txt"))
+	if err != nil || len(orderings) == 0 {
+		log.Fatalf("no samples found in %s", *dir)
+	}
+	matches, err := filepath.Glob(filepath.Join(*osvDir, "*.json"))
+	if err != nil || len(matches) == 0 {
+		log.Fatalf("no samples found in %s", *osvDir)
+	}
+
+	samples := append(orderings, matches...)
+	failed := 0
+	for _, sample := range samples {
+		render := renderOrdering
+		if filepath.Ext(sample) == ".json" {
+			render = renderMatches
+		}
+		got, err := render(sample)
+		if err != nil {
+			log.Fatalf("%s: %v", sample, err)
+		}
+		if !checkGolden(sample, got) {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d samples failed", failed, len(samples))
+	}
+}
+
+// checkGolden compares a rendered sample with its golden file, or rewrites
+// the golden file with -update
+func checkGolden(sample string, got []byte) bool {
+	golden := strings.TrimSuffix(sample, filepath.Ext(sample)) + ".golden"
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			log.Fatalf("write %s: %v", golden, err)
+		}
+		log.Printf("📝 Updated %s", golden)
+		return true
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		log.Printf("❌ %s: %v", golden, err)
+		return false
+	}
+	if !bytes.Equal(got, want) {
+		log.Printf("❌ %s does not match %s", sample, golden)
+		reportMismatch(got, want)
+		return false
+	}
+	log.Printf("✅ %s", sample)
+	return true
+}
+
+// renderOrdering compares each pair of a sample. A pair that orders
+// differently when swapped renders as "a ? b" so the golden file catches it.
+func renderOrdering(sample string) ([]byte, error) {
+	f, err := os.Open(sample)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manager, _, _ := strings.Cut(filepath.Base(sample), "-")
+	if manager != packages.ManagerDpkg && manager != packages.ManagerRPM {
+		return nil, fmt.Errorf("unknown package manager %q", manager)
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pair := strings.Fields(line)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("line %d: want two versions", n)
+		}
+
+		c := packages.CompareVersions(manager, pair[0], pair[1])
+		op := "?"
+		if packages.CompareVersions(manager, pair[1], pair[0]) == -c {
+			op = [...]string{"<", "=", ">"}[c+1]
+		}
+		fmt.Fprintf(&out, "%s %s %s\n", pair[0], op, pair[1])
+	}
+	return out.Bytes(), scanner.Err()
+}
+
+// renderMatches matches a sample's packages against its advisories, one
+// finding per line
+func renderMatches(sample string) ([]byte, error) {
+	data, err := os.ReadFile(sample)
+	if err != nil {
+		return nil, err
+	}
+	var s matchSample
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	db := osv.NewDatabase()
+	for i := range s.Advisories {
+		db.Add(&s.Advisories[i])
+	}
+
+	var out bytes.Buffer
+	for _, f := range db.Match(s.Ecosystem, s.Manager, s.Packages) {
+		fixed := f.FixedVersion
+		if fixed == "" {
+			fixed = "-"
+		}
+		fmt.Fprintf(&out, "%s %s %s fixed=%s severity=%s\n", f.Package, f.Version, f.AdvisoryID, fixed, f.Severity)
+	}
+	return out.Bytes(), nil
+}
+
+// reportMismatch prints the first differing golden line
+func reportMismatch(got, want []byte) {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			log.Printf("   golden line %d\n   want: %s\n   got:  %s", i+1, w, g)
+			return
+		}
+	}
+}